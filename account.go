@@ -0,0 +1,294 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+)
+
+// defaultKeyringService is the keyring service under which credentials are stored by default
+const defaultKeyringService = "relish-notifier"
+
+// keyringService returns the keyring service selected with --keyring-service, or the default
+func (c *Config) keyringService() string {
+	if c.KeyringService == "" {
+		return defaultKeyringService
+	}
+	return c.KeyringService
+}
+
+// errKeyringDisabled is returned instead of looking up a credential when the keyring is disabled
+var errKeyringDisabled = errors.New("keyring disabled")
+
+// keyringDisabled reports whether the keyring is turned off with --no-keyring or RELISH_NO_KEYRING
+func (c *Config) keyringDisabled() bool {
+	if c.NoKeyring {
+		return true
+	}
+	disabled, _ := strconv.ParseBool(os.Getenv("RELISH_NO_KEYRING"))
+	return disabled
+}
+
+// defaultKeyringTimeout is how long to wait for the keyring to look up a credential by default
+const defaultKeyringTimeout = 5 * time.Second
+
+// errKeyringTimeout is returned when the keyring doesn't answer within --keyring-timeout
+var errKeyringTimeout = errors.New("keyring did not respond in time")
+
+// keyringGet looks up a credential for the selected profile and keyring service. When the
+// keyring is disabled, it returns errKeyringDisabled without touching the keyring, which
+// on some systems can hang or prompt.
+func (c *Config) keyringGet(name string) (string, error) {
+	if c.keyringDisabled() {
+		return "", errKeyringDisabled
+	}
+	return withKeyringTimeout(c.KeyringTimeout, c.keyringHung, func() (string, error) {
+		return keyring.Get(c.keyringService(), keyringAccount(c.Profile, name))
+	})
+}
+
+// resetKeyring forgets that the keyring has timed out, so that the next lookup asks it again,
+// as when the credentials are reloaded once D-Bus may be back
+func (c *Config) resetKeyring() {
+	if c.keyringHung != nil {
+		c.keyringHung.Store(false)
+	}
+}
+
+// withKeyringTimeout calls get, but gives up with errKeyringTimeout if it takes longer than
+// timeout, as a keyring without a D-Bus session on Linux can. Once that has happened, hung
+// is set and later calls give up straight away until it is cleared, so that each credential
+// doesn't wait out the timeout in turn. A nil hung remembers nothing. A timeout of zero
+// waits as long as get takes.
+func withKeyringTimeout(timeout time.Duration, hung *atomic.Bool, get func() (string, error)) (string, error) {
+	if timeout <= 0 {
+		return get()
+	}
+	if hung != nil && hung.Load() {
+		return "", errKeyringTimeout
+	}
+
+	type result struct {
+		value string
+		err   error
+	}
+	// Buffered so that a call that finishes after the timeout doesn't block forever
+	done := make(chan result, 1)
+	go func() {
+		value, err := get()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-time.After(timeout):
+		if hung != nil {
+			hung.Store(true)
+		}
+		return "", errKeyringTimeout
+	}
+}
+
+// systemdCredential returns the credential called name from the directory systemd provides
+// with LoadCredential= or SetCredential=. It reports false if there is no such credential.
+func systemdCredential(name string) (string, bool) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return "", false
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	return value, value != ""
+}
+
+// lookupCredential returns a credential from the keyring account, or failing that from the
+// systemd credential or environment variable called variable. The error is the keyring's.
+func lookupCredential(config *Config, account, variable string) (string, error) {
+	value, err := config.keyringGet(account)
+	if err == nil {
+		return value, nil
+	}
+
+	switch {
+	case errors.Is(err, errKeyringTimeout):
+		config.logger().Debug("keyring did not respond in time, looking elsewhere", "account", account, "keyring_timeout", config.KeyringTimeout)
+	case !errors.Is(err, keyring.ErrNotFound) && !errors.Is(err, errKeyringDisabled):
+		config.logger().Debug("failed to read keyring, looking elsewhere", "account", account, "error", err)
+	}
+
+	if value, ok := systemdCredential(variable); ok {
+		return value, nil
+	}
+	if value := os.Getenv(variable); value != "" {
+		return value, nil
+	}
+	return "", err
+}
+
+// keyringAccounts lists every credential that may be stored for a profile
+var keyringAccounts = []string{"EMAIL", "PASSWORD", "TOTP_SECRET", "IMAP_PASSWORD", "SMTP_PASSWORD", "TWILIO_TOKEN", "SESSION_COOKIE"}
+
+// keyringAccount returns the keyring account for a credential, namespaced by profile
+func keyringAccount(profile, name string) string {
+	if profile == "" {
+		return name
+	}
+	return profile + "/" + name
+}
+
+// readLine writes a prompt and reads a single line of input
+func readLine(r *bufio.Reader, w io.Writer, prompt string) (string, error) {
+	fmt.Fprint(w, prompt) //nolint:errcheck
+
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// disableEcho turns off echo when stdin is a terminal. It returns a function that turns
+// echo back on, or nil if echo could not be disabled.
+func disableEcho() func() {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err != nil {
+		return nil
+	}
+	return func() {
+		stty("echo") //nolint:errcheck
+	}
+}
+
+// newLoginCommand creates the login subcommand, which stores credentials in the keyring
+func newLoginCommand(config *Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "login",
+		Short: "Store your Relish credentials in the system keychain",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			if config.keyringDisabled() {
+				return fmt.Errorf("the keyring is disabled, so credentials can't be stored; set RELISH_USERNAME and RELISH_PASSWORD instead")
+			}
+
+			r := bufio.NewReader(cmd.InOrStdin())
+			w := cmd.ErrOrStderr()
+
+			email, err := readLine(r, w, "email: ")
+			if err != nil {
+				return fmt.Errorf("failed to read email: %w", err)
+			}
+
+			// Only hide what the user types when they are typing at a terminal
+			if cmd.InOrStdin() == os.Stdin {
+				if restore := disableEcho(); restore != nil {
+					defer restore()
+				}
+			}
+
+			password, err := readLine(r, w, "password: ")
+			fmt.Fprintln(w) //nolint:errcheck
+			if err != nil {
+				return fmt.Errorf("failed to read password: %w", err)
+			}
+
+			totpSecret, err := readLine(r, w, "TOTP secret (leave empty if you don't use two-factor authentication): ")
+			fmt.Fprintln(w) //nolint:errcheck
+			if err != nil {
+				return fmt.Errorf("failed to read TOTP secret: %w", err)
+			}
+
+			if email == "" || password == "" {
+				return fmt.Errorf("email and password are required")
+			}
+
+			credentials := map[string]string{
+				"EMAIL":       email,
+				"PASSWORD":    password,
+				"TOTP_SECRET": totpSecret,
+			}
+			for _, name := range []string{"EMAIL", "PASSWORD", "TOTP_SECRET"} {
+				if credentials[name] == "" {
+					continue
+				}
+				if err := keyring.Set(config.keyringService(), keyringAccount(config.Profile, name), credentials[name]); err != nil {
+					return fmt.Errorf("failed to store %s in keyring: %w", name, err)
+				}
+			}
+
+			fmt.Fprintf(w, "credentials stored for %s\n", email) //nolint:errcheck
+			return nil
+		},
+	}
+}
+
+// newLogoutCommand creates the logout subcommand, which removes credentials from the keyring
+func newLogoutCommand(config *Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Remove your credentials from the system keychain",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			if config.keyringDisabled() {
+				return fmt.Errorf("the keyring is disabled, so there are no stored credentials to remove")
+			}
+
+			for _, name := range keyringAccounts {
+				err := keyring.Delete(config.keyringService(), keyringAccount(config.Profile, name))
+				if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+					return fmt.Errorf("failed to remove %s from keyring: %w", name, err)
+				}
+			}
+
+			fmt.Fprintln(cmd.ErrOrStderr(), "credentials removed") //nolint:errcheck
+			return nil
+		},
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// requestBudget is a token bucket that limits requests to the site, such as page loads, to
+// a number per hour. Up to ten minutes' worth can be spent at once, for example on quick
+// retries, but no more than the hourly number on average. It is not safe for concurrent use.
+type requestBudget struct {
+	perHour  int
+	capacity float64
+	tokens   float64
+	// rate is the number of tokens added per second
+	rate float64
+	last time.Time
+}
+
+// newRequestBudget creates a budget of perHour requests, starting full at now. A budget
+// of zero or less is unlimited, and is returned as nil.
+func newRequestBudget(perHour int, now time.Time) *requestBudget {
+	if perHour <= 0 {
+		return nil
+	}
+
+	capacity := max(float64(perHour)/6, 1)
+	return &requestBudget{
+		perHour:  perHour,
+		capacity: capacity,
+		tokens:   capacity,
+		rate:     float64(perHour) / time.Hour.Seconds(),
+		last:     now,
+	}
+}
+
+// reserve takes a token at now and returns how long to wait before using it
+func (b *requestBudget) reserve(now time.Time) time.Duration {
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	// The token has been spent in advance, so it is paid for once the bucket is back to zero
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait blocks until the budget allows another request, or ctx is cancelled. A nil budget
+// never waits.
+func (b *requestBudget) wait(ctx context.Context, logger *slog.Logger) error {
+	if b == nil {
+		return nil
+	}
+
+	delay := b.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	logger.Info("request budget used up, waiting", "delay", delay.Round(time.Second), "max_requests_per_hour", b.perHour)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// errorBundleLines is the number of recent log lines kept for an --error-bundle-dir bundle
+const errorBundleLines = 500
+
+// errorBundleCaptureTimeout limits how long writing a bundle waits for the browser to
+// return the page, since the failure may be that it has stopped responding
+const errorBundleCaptureTimeout = 10 * time.Second
+
+// logRing keeps the most recent log lines in memory
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	// next is where the next line goes once the ring is full
+	next int
+}
+
+// newLogRing creates a ring that keeps the last size lines
+func newLogRing(size int) *logRing {
+	return &logRing{lines: make([]string, 0, size)}
+}
+
+// Write adds a line. slog's text handler writes each record with a single call.
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line := strings.TrimSuffix(string(p), "\n")
+	if len(r.lines) < cap(r.lines) {
+		r.lines = append(r.lines, line)
+	} else {
+		r.lines[r.next] = line
+		r.next = (r.next + 1) % len(r.lines)
+	}
+	return len(p), nil
+}
+
+// Lines returns the lines in the ring, oldest first
+func (r *logRing) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := make([]string, 0, len(r.lines))
+	lines = append(lines, r.lines[r.next:]...)
+	return append(lines, r.lines[:r.next]...)
+}
+
+// Handler returns a slog handler that keeps every record, down to debug level, in the ring
+// and passes those that next handles on to it
+func (r *logRing) Handler(next slog.Handler, opts *slog.HandlerOptions) slog.Handler {
+	ringOpts := slog.HandlerOptions{Level: slog.LevelDebug}
+	if opts != nil {
+		ringOpts.ReplaceAttr = opts.ReplaceAttr
+	}
+	return &ringHandler{ring: slog.NewTextHandler(r, &ringOpts), next: next}
+}
+
+// ringHandler sends log records both to a logRing and to another handler
+type ringHandler struct {
+	ring slog.Handler
+	next slog.Handler
+}
+
+func (h *ringHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.ring.Enabled(ctx, level) || h.next.Enabled(ctx, level)
+}
+
+func (h *ringHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	if h.ring.Enabled(ctx, r.Level) {
+		errs = append(errs, h.ring.Handle(ctx, r.Clone()))
+	}
+	if h.next.Enabled(ctx, r.Level) {
+		errs = append(errs, h.next.Handle(ctx, r))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *ringHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ringHandler{ring: h.ring.WithAttrs(attrs), next: h.next.WithAttrs(attrs)}
+}
+
+func (h *ringHandler) WithGroup(name string) slog.Handler {
+	return &ringHandler{ring: h.ring.WithGroup(name), next: h.next.WithGroup(name)}
+}
+
+// pageCapturer is implemented by sources that can return the page they last checked
+type pageCapturer interface {
+	Capture(ctx context.Context) (string, []byte, error)
+}
+
+// isFatal reports whether err ended the run because something went wrong, rather than
+// to report the order status with the exit status
+func isFatal(err error) bool {
+	var exitErr exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.err != nil
+	}
+	return err != nil
+}
+
+// errorBundle is what goes into an --error-bundle-dir bundle
+type errorBundle struct {
+	err    error
+	config Config
+	logs   []string
+	// html and screenshot are the page the browser was showing, if there was one
+	html       string
+	screenshot []byte
+}
+
+// newErrorBundle collects a bundle for err. The page is captured from source, which may
+// be nil if the run ended before one was opened.
+func newErrorBundle(ctx context.Context, err error, config *Config, ring *logRing, source relish.StatusSource, logger *slog.Logger) errorBundle {
+	bundle := errorBundle{err: err, config: *config, logs: ring.Lines()}
+
+	if capturer, ok := source.(pageCapturer); ok {
+		// The run may have been stopped, but the page is still worth having
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), errorBundleCaptureTimeout)
+		defer cancel()
+
+		html, screenshot, captureErr := capturer.Capture(ctx)
+		if captureErr != nil {
+			logger.Warn("failed to capture the page for the error bundle", "error", captureErr)
+		}
+		bundle.html, bundle.screenshot = html, screenshot
+	}
+	return bundle
+}
+
+// write saves the bundle as a zip file named for now in dir, and returns its path
+func (b errorBundle) write(dir string, now time.Time) (string, error) {
+	var config, version bytes.Buffer
+	if err := printConfig(&config, b.config); err != nil {
+		return "", fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if err := writeBuildInfo(&version, getBuildInfo(), false); err != nil {
+		return "", fmt.Errorf("failed to write version: %w", err)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"error.txt", []byte(b.err.Error() + "\n")},
+		{"version.txt", version.Bytes()},
+		{"config.json", config.Bytes()},
+		{"log.txt", []byte(strings.Join(b.logs, "\n") + "\n")},
+		{"page.html", []byte(b.html)},
+		{"screenshot.png", b.screenshot},
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create error bundle directory: %w", err)
+	}
+	path := filepath.Join(dir, "relish-notifier-error-"+now.Format("20060102-150405")+".zip")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create error bundle: %w", err)
+	}
+
+	archive := zip.NewWriter(file)
+	for _, f := range files {
+		if len(f.data) == 0 {
+			continue
+		}
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			_, err = w.Write(f.data)
+		}
+		if err != nil {
+			file.Close() //nolint:errcheck
+			return "", fmt.Errorf("failed to write %s to error bundle: %w", f.name, err)
+		}
+	}
+	if err := errors.Join(archive.Close(), file.Close()); err != nil {
+		return "", fmt.Errorf("failed to write error bundle: %w", err)
+	}
+	return path, nil
+}
+
+// writeErrorBundle writes a bundle for err to --error-bundle-dir, if the run ended with a
+// fatal error, and says where it is. A bundle that can't be written is only logged, since
+// the error that ended the run matters more.
+func writeErrorBundle(ctx context.Context, err error, config *Config, ring *logRing, source relish.StatusSource, logger *slog.Logger) {
+	if ring == nil || !isFatal(err) {
+		return
+	}
+
+	path, bundleErr := newErrorBundle(ctx, err, config, ring, source, logger).write(config.ErrorBundleDir, config.now())
+	if bundleErr != nil {
+		logger.Error("failed to write error bundle", "error", bundleErr)
+		return
+	}
+	logger.Error("wrote an error bundle to attach to a bug report", "path", path)
+}
@@ -0,0 +1,109 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// ANSI escape sequences used to color log levels
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// useColor reports whether log output to f should be colored: only on a terminal, and
+// not with --no-color or the NO_COLOR environment variable (see https://no-color.org)
+func useColor(noColor bool, f *os.File) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(f)
+}
+
+// levelColor returns the escape sequence that colors level, or "" for debug messages,
+// which are left plain
+func levelColor(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return ansiRed
+	case level >= slog.LevelWarn:
+		return ansiYellow
+	case level >= slog.LevelInfo:
+		return ansiGreen
+	default:
+		return ""
+	}
+}
+
+// colorHandler is a text handler whose level=... attribute is colored by level
+type colorHandler struct {
+	text slog.Handler
+	// out is shared with the handlers made by WithAttrs and WithGroup, so that every
+	// record is formatted into buf and written whole
+	out *colorOutput
+}
+
+// colorOutput is where a colorHandler and the handlers derived from it write
+type colorOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   io.Writer
+}
+
+// newColorHandler creates a handler that formats records like slog.NewTextHandler and
+// writes them to w with the level colored
+func newColorHandler(w io.Writer, opts *slog.HandlerOptions) *colorHandler {
+	out := &colorOutput{w: w}
+	return &colorHandler{text: slog.NewTextHandler(&out.buf, opts), out: out}
+}
+
+func (h *colorHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.text.Enabled(ctx, level)
+}
+
+func (h *colorHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.text.Handle(ctx, r); err != nil {
+		return err
+	}
+
+	line := h.out.buf.Bytes()
+	if color := levelColor(r.Level); color != "" {
+		attr := []byte(slog.LevelKey + "=" + r.Level.String())
+		line = bytes.Replace(line, attr, []byte(slog.LevelKey+"="+color+r.Level.String()+ansiReset), 1)
+	}
+	_, err := h.out.w.Write(line)
+	return err
+}
+
+func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &colorHandler{text: h.text.WithAttrs(attrs), out: h.out}
+}
+
+func (h *colorHandler) WithGroup(name string) slog.Handler {
+	return &colorHandler{text: h.text.WithGroup(name), out: h.out}
+}
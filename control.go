@@ -0,0 +1,289 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"relish-notifier/relish"
+)
+
+// Commands understood by the control socket
+const (
+	controlStatus     = "status"
+	controlCheck      = "check"
+	controlTestNotify = "test-notify"
+)
+
+// maxControlMessage bounds the size of a single control message
+const maxControlMessage = 64 * 1024
+
+// controlTimeout bounds how long a control client may take to send a request
+const controlTimeout = 5 * time.Second
+
+// controlRequest is sent by a client over the control socket
+type controlRequest struct {
+	Command string `json:"command"`
+}
+
+// controlResponse is the reply to a controlRequest
+type controlResponse struct {
+	OK     bool         `json:"ok"`
+	Error  string       `json:"error,omitempty"`
+	Result *checkResult `json:"result,omitempty"`
+}
+
+// requestCheck asks the main loop to check right away. A check that is already pending
+// will pick up the request too, so it never blocks.
+func requestCheck(checkNow chan<- struct{}) {
+	select {
+	case checkNow <- struct{}{}:
+	default:
+	}
+}
+
+// writeControlMessage writes v as JSON, preceded by its length as a 4 byte big endian integer
+func writeControlMessage(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode control message: %w", err)
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := w.Write(append(header[:], data...)); err != nil {
+		return fmt.Errorf("failed to write control message: %w", err)
+	}
+	return nil
+}
+
+// readControlMessage reads a length prefixed JSON message into v
+func readControlMessage(r io.Reader, v any) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("failed to read control message: %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxControlMessage {
+		return fmt.Errorf("control message too large: %d bytes", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("failed to read control message: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode control message: %w", err)
+	}
+	return nil
+}
+
+// controller answers requests on the control socket
+type controller struct {
+	mu   sync.Mutex
+	last *checkResult
+	// checkNow wakes the main loop so that it checks without waiting for the interval
+	checkNow chan struct{}
+	// testNotify sends a test notification about the latest order information through
+	// the configured targets
+	testNotify func(ctx context.Context, info relish.OrderInfo) error
+	logger     *slog.Logger
+}
+
+// newController creates a controller that wakes the main loop through checkNow and sends
+// test notifications with testNotify
+func newController(checkNow chan struct{}, testNotify func(ctx context.Context, info relish.OrderInfo) error, logger *slog.Logger) *controller {
+	return &controller{
+		checkNow:   checkNow,
+		testNotify: testNotify,
+		logger:     logger,
+	}
+}
+
+// record remembers the result of the most recent check
+func (c *controller) record(result checkResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = &result
+}
+
+// handle carries out a single request
+func (c *controller) handle(ctx context.Context, req controlRequest) controlResponse {
+	switch req.Command {
+	case controlStatus:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.last == nil {
+			return controlResponse{Error: "no checks have completed yet"}
+		}
+		result := *c.last
+		return controlResponse{OK: true, Result: &result}
+	case controlCheck:
+		requestCheck(c.checkNow)
+		return controlResponse{OK: true}
+	case controlTestNotify:
+		info := relish.OrderInfo{Status: relish.OrderStatusUnknown}
+		c.mu.Lock()
+		if c.last != nil {
+			info = relish.OrderInfo{Status: c.last.Status, ETA: c.last.ETA, Vendor: c.last.Vendor}
+		}
+		c.mu.Unlock()
+
+		if err := c.testNotify(ctx, info); err != nil {
+			return controlResponse{Error: err.Error()}
+		}
+		return controlResponse{OK: true}
+	default:
+		return controlResponse{Error: fmt.Sprintf("unknown command %q", req.Command)}
+	}
+}
+
+// serveConn answers requests from one client until it disconnects
+func (c *controller) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(controlTimeout)); err != nil {
+			return
+		}
+
+		var req controlRequest
+		if err := readControlMessage(conn, &req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.logger.Debug("control client error", "error", err)
+			}
+			return
+		}
+
+		c.logger.Debug("control request", "command", req.Command)
+		if err := writeControlMessage(conn, c.handle(ctx, req)); err != nil {
+			c.logger.Debug("control client error", "error", err)
+			return
+		}
+	}
+}
+
+// startControlSocket listens for control requests on a unix socket at path. It returns a
+// function that stops listening and removes the socket.
+func startControlSocket(ctx context.Context, path string, c *controller) (func(), error) {
+	// A socket left behind by a process that didn't exit cleanly would prevent listening
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close() //nolint:errcheck
+			return nil, fmt.Errorf("control socket %s is in use", path)
+		}
+		os.Remove(path) //nolint:errcheck
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close() //nolint:errcheck
+		return nil, fmt.Errorf("failed to set control socket permissions: %w", err)
+	}
+
+	c.logger.Info("listening for control requests", "path", path)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.serveConn(ctx, conn)
+		}
+	}()
+
+	// Closing a unix listener created by Listen also removes the socket file
+	return func() {
+		listener.Close() //nolint:errcheck
+	}, nil
+}
+
+// sendControlRequest sends a single request to the control socket at path
+func sendControlRequest(path string, req controlRequest) (controlResponse, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return controlResponse{}, fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// A test notification may run a slow command, so allow more time for the reply
+	if err := conn.SetDeadline(time.Now().Add(2 * time.Minute)); err != nil {
+		return controlResponse{}, fmt.Errorf("failed to set control socket deadline: %w", err)
+	}
+
+	if err := writeControlMessage(conn, req); err != nil {
+		return controlResponse{}, err
+	}
+
+	var resp controlResponse
+	if err := readControlMessage(conn, &resp); err != nil {
+		return controlResponse{}, err
+	}
+	return resp, nil
+}
+
+// newControlCommand creates the control subcommand, which talks to a running relish-notifier
+func newControlCommand(config *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "control {status|check|test-notify}",
+		Short:     "Send a request to a running relish-notifier",
+		Long:      "Send a request to a relish-notifier started with --control-socket: show the latest status, check now, or send a test notification.",
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{controlStatus, controlCheck, controlTestNotify},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			if config.ControlSocket == "" {
+				return fmt.Errorf("--control-socket is required")
+			}
+
+			resp, err := sendControlRequest(config.ControlSocket, controlRequest{Command: args[0]})
+			if err != nil {
+				return err
+			}
+			if !resp.OK {
+				return fmt.Errorf("%s failed: %s", args[0], resp.Error)
+			}
+
+			if resp.Result != nil {
+				return writeResult(cmd.OutOrStdout(), config.Output, *resp.Result)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&config.Output, "output", "o", outputText, "Output format for the status (text or json)")
+	return cmd
+}
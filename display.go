@@ -0,0 +1,219 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// displayRefresh is how often the terminal display is redrawn
+const displayRefresh = time.Second
+
+// displayMaxErrors is the number of recent errors shown in the terminal display
+const displayMaxErrors = 5
+
+// clearScreen moves the cursor to the top left corner and clears the terminal
+const clearScreen = "\x1b[H\x1b[2J"
+
+// statusDisplay draws the current order status in a terminal, in place of log output
+type statusDisplay struct {
+	mu sync.Mutex
+	// drawMu keeps the ticker and updates from drawing at the same time
+	drawMu   sync.Mutex
+	out      io.Writer
+	interval func(time.Time) time.Duration
+	loc      *time.Location
+	info     relish.OrderInfo
+	checked  time.Time
+	errors   []string
+
+	done     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// newStatusDisplay creates a display that draws to out, showing times in loc. interval
+// returns the time between checks after one at the given time, used for the countdown to
+// the next one.
+func newStatusDisplay(out io.Writer, interval func(time.Time) time.Duration, loc *time.Location) *statusDisplay {
+	return &statusDisplay{
+		out:      out,
+		interval: interval,
+		loc:      loc,
+		info:     relish.OrderInfo{Status: relish.OrderStatusUnknown},
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update records the result of a successful check and redraws the display
+func (d *statusDisplay) update(info relish.OrderInfo, now time.Time) {
+	d.mu.Lock()
+	d.info = info
+	d.checked = now
+	d.mu.Unlock()
+
+	d.draw(now)
+}
+
+// addError records an error to show in the display
+func (d *statusDisplay) addError(text string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.errors = append(d.errors, now.In(d.loc).Format("15:04:05")+" "+text)
+	if len(d.errors) > displayMaxErrors {
+		d.errors = d.errors[len(d.errors)-displayMaxErrors:]
+	}
+}
+
+// render returns the text of the display at the given time
+func (d *statusDisplay) render(now time.Time) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "relish-notifier\n\n")
+	fmt.Fprintf(&b, "Status:      %s\n", d.info.Status)
+	if d.info.Vendor != "" {
+		fmt.Fprintf(&b, "Vendor:      %s\n", d.info.Vendor)
+	}
+	if d.info.ETA != "" {
+		fmt.Fprintf(&b, "ETA:         %s\n", d.info.ETA)
+	}
+	if d.info.Driver != "" {
+		driver := d.info.Driver
+		if d.info.DriverLocation != "" {
+			driver += " (" + d.info.DriverLocation + ")"
+		}
+		fmt.Fprintf(&b, "Driver:      %s\n", driver)
+	}
+
+	if d.checked.IsZero() {
+		fmt.Fprintf(&b, "Last check:  never\n")
+	} else {
+		fmt.Fprintf(&b, "Last check:  %s (%s ago)\n", d.checked.In(d.loc).Format("15:04:05"), now.Sub(d.checked).Round(time.Second))
+		if !d.info.Status.IsFinal() {
+			next := max(d.checked.Add(d.interval(d.checked)).Sub(now), 0)
+			fmt.Fprintf(&b, "Next check:  in %s\n", next.Round(time.Second))
+		}
+	}
+
+	if len(d.errors) > 0 {
+		fmt.Fprintf(&b, "\nRecent errors:\n")
+		for _, text := range d.errors {
+			fmt.Fprintf(&b, "  %s\n", text)
+		}
+	}
+	return b.String()
+}
+
+// draw clears the terminal and draws the display
+func (d *statusDisplay) draw(now time.Time) {
+	text := d.render(now)
+
+	d.drawMu.Lock()
+	defer d.drawMu.Unlock()
+	fmt.Fprint(d.out, clearScreen+text) //nolint:errcheck
+}
+
+// run redraws the display every second, so that the countdown stays current, until stop
+// is called or ctx is cancelled
+func (d *statusDisplay) run(ctx context.Context) {
+	defer close(d.stopped)
+
+	ticker := time.NewTicker(displayRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.done:
+			return
+		case now := <-ticker.C:
+			d.draw(now)
+		}
+	}
+}
+
+// stop draws the display one last time and stops redrawing it, so that anything written
+// to the terminal afterwards stays visible
+func (d *statusDisplay) stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+		<-d.stopped
+		d.draw(time.Now())
+	})
+}
+
+// Handler returns a slog handler that shows warnings and errors in the display
+func (d *statusDisplay) Handler() slog.Handler {
+	return &displayHandler{display: d}
+}
+
+// displayHandler sends log records at warning level and above to a statusDisplay
+type displayHandler struct {
+	display *statusDisplay
+	attrs   []slog.Attr
+}
+
+func (h *displayHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+
+func (h *displayHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+
+	write := func(attr slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", attr.Key, attr.Value)
+		return true
+	}
+	for _, attr := range h.attrs {
+		write(attr)
+	}
+	r.Attrs(write)
+
+	h.display.addError(b.String(), r.Time)
+	return nil
+}
+
+func (h *displayHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &displayHandler{display: h.display, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+// WithGroup is not needed for the short messages shown in the display, so groups are flattened
+func (h *displayHandler) WithGroup(string) slog.Handler {
+	return h
+}
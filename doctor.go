@@ -0,0 +1,183 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"relish-notifier/relish"
+)
+
+// doctorTimeout bounds each diagnostic run by the doctor subcommand
+const doctorTimeout = time.Minute
+
+// errSkipped is returned by a diagnostic that can't run because an earlier one failed,
+// along with the reason
+var errSkipped = errors.New("skipped")
+
+// diagnostic is a single check run by the doctor subcommand. run returns a short
+// description of what it found.
+type diagnostic struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runDiagnostics runs each diagnostic in turn and writes a PASS, FAIL, or SKIP line for
+// it to w. It returns an error if any of them failed.
+func runDiagnostics(ctx context.Context, w io.Writer, diagnostics []diagnostic) error {
+	failed := 0
+	for _, d := range diagnostics {
+		ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+		detail, err := d.run(ctx)
+		cancel()
+
+		switch {
+		case errors.Is(err, errSkipped):
+			fmt.Fprintf(w, "SKIP  %s: %s\n", d.name, detail) //nolint:errcheck
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", d.name, err) //nolint:errcheck
+		default:
+			fmt.Fprintf(w, "PASS  %s: %s\n", d.name, detail) //nolint:errcheck
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(diagnostics))
+	}
+	return nil
+}
+
+// doctorDiagnostics returns the diagnostics that apply to the configuration: the
+// credentials and browser for the selected source, and each notification target
+func doctorDiagnostics(config *Config, logger *slog.Logger) ([]diagnostic, func(), error) {
+	var diagnostics []diagnostic
+	cleanup := func() {}
+
+	switch config.Source {
+	case sourceBrowser:
+		diagnostics = append(diagnostics, diagnostic{"credentials", func(context.Context) (string, error) {
+			credentials, err := loadCredentials(config)
+			if err != nil {
+				return "", err
+			}
+			if credentials.SessionCookie != "" {
+				return "found a session cookie", nil
+			}
+			return "found for " + credentials.Username, nil
+		}})
+
+		// The browser is only needed to load the login page, so it doesn't need the credentials
+		notifier := relish.NewNotifier(&config.Config, nil, logger)
+		started := false
+		diagnostics = append(diagnostics,
+			diagnostic{"browser", func(context.Context) (string, error) {
+				if err := notifier.InitializeBrowser(); err != nil {
+					return "", err
+				}
+				started = true
+				if config.RemoteURL != "" {
+					return "connected to " + config.RemoteURL, nil
+				}
+				return "launched", nil
+			}},
+			diagnostic{"website", func(ctx context.Context) (string, error) {
+				if !started {
+					return "needs a working browser", errSkipped
+				}
+				if err := notifier.OpenLoginPage(ctx); err != nil {
+					return "", err
+				}
+				return "loaded the login page", nil
+			}},
+		)
+		cleanup = func() {
+			if started {
+				notifier.Close()
+			}
+		}
+
+	case sourceIMAP:
+		diagnostics = append(diagnostics, diagnostic{"IMAP password", func(context.Context) (string, error) {
+			if _, err := getIMAPPassword(config); err != nil {
+				return "", err
+			}
+			return "found", nil
+		}})
+	}
+
+	notifications, err := newDispatcher(config, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, target := range notifications.targets {
+		diagnostics = append(diagnostics, diagnostic{"notify " + target.Name(), func(ctx context.Context) (string, error) {
+			data := newMessageData(relish.OrderInfo{Status: relish.OrderStatusUnknown}, config.now())
+			data.Event = eventTest
+			text := "relish-notifier: this is a test notification from relish-notifier doctor"
+			if err := target.Send(ctx, Notification{Data: data, Text: text, Message: text}); err != nil {
+				return "", err
+			}
+			return "sent a test notification", nil
+		}})
+	}
+
+	return diagnostics, cleanup, nil
+}
+
+// newDoctorCommand creates the doctor subcommand. It accepts the same flags as root, so
+// that it checks the setup a run with those flags would use.
+func newDoctorCommand(config *Config, root *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that the browser, credentials, and notification targets work",
+		Long: "Check that the browser, credentials, and notification targets work.\n\n" +
+			"Give doctor the same options you run relish-notifier with. It launches the browser and loads\n" +
+			"the login page without logging in, looks up the credentials, and sends a test notification to\n" +
+			"every notification target. It exits with status 1 if any of these fail.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			logger := config.logger()
+
+			if err := validateSource(config.Source); err != nil {
+				return err
+			}
+
+			diagnostics, cleanup, err := doctorDiagnostics(config, logger)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			return runDiagnostics(cmd.Context(), cmd.OutOrStdout(), diagnostics)
+		},
+	}
+
+	cmd.Flags().AddFlagSet(root.Flags())
+
+	return cmd
+}
@@ -0,0 +1,244 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// emailTimeout bounds each conversation with the SMTP server
+const emailTimeout = 30 * time.Second
+
+// emailHTMLTemplate is the HTML body sent with --email-html
+var emailHTMLTemplate = template.Must(template.New("email").Funcs(template.FuncMap{
+	"badgeColor": badgeColor,
+}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<p><span style="display: inline-block; padding: 0.3em 0.8em; border-radius: 1em; color: #fff; font-weight: bold; background: {{ badgeColor .Status }};">{{ .Status }}</span></p>
+<table style="border-collapse: collapse;">
+{{- with .Vendor }}
+<tr><td style="padding-right: 1em; color: #666;">Vendor</td><td>{{ . }}</td></tr>
+{{- end }}
+{{- with .ETA }}
+<tr><td style="padding-right: 1em; color: #666;">ETA</td><td>{{ . }}</td></tr>
+{{- end }}
+{{- with .Driver }}
+<tr><td style="padding-right: 1em; color: #666;">Driver</td><td>{{ . }}{{ with $.DriverLocation }} ({{ . }}){{ end }}</td></tr>
+{{- end }}
+</table>
+<p style="color: #666;">{{ .Message }}</p>
+</body>
+</html>
+`))
+
+// badgeColor returns the background color of the status badge in HTML email
+func badgeColor(status relish.OrderStatus) string {
+	switch status {
+	case relish.OrderStatusArrived:
+		return "#2a7d2a"
+	case relish.OrderStatusCancelled:
+		return "#b03030"
+	case relish.OrderStatusDelayed:
+		return "#c77700"
+	case relish.OrderStatusDriverAssigned, relish.OrderStatusOutForDelivery:
+		return "#2a5db0"
+	default:
+		return "#666"
+	}
+}
+
+// emailTarget sends notifications by email through an SMTP server
+type emailTarget struct {
+	// server is the host:port of the SMTP server
+	server string
+	from   string
+	to     []string
+	// auth, if set, is used to log in to the server
+	auth smtp.Auth
+	// html adds a styled HTML version of the message
+	html bool
+}
+
+// newEmailTarget creates an email target from the --email-* and --smtp-* options
+func newEmailTarget(config *Config) (*emailTarget, error) {
+	if config.SMTPServer == "" {
+		return nil, fmt.Errorf("--email-to requires --smtp-server")
+	}
+	host, _, err := net.SplitHostPort(config.SMTPServer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --smtp-server %q: %w", config.SMTPServer, err)
+	}
+
+	t := &emailTarget{server: config.SMTPServer, from: config.EmailFrom, html: config.EmailHTML}
+	for address := range strings.SplitSeq(config.EmailTo, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			t.to = append(t.to, address)
+		}
+	}
+	if len(t.to) == 0 {
+		return nil, fmt.Errorf("--email-to has no addresses")
+	}
+	if t.from == "" {
+		t.from = t.to[0]
+	}
+
+	if config.SMTPUsername != "" {
+		password, err := getSMTPPassword(config)
+		if err != nil {
+			return nil, err
+		}
+		t.auth = smtp.PlainAuth("", config.SMTPUsername, password, host)
+	}
+	return t, nil
+}
+
+func (t *emailTarget) Name() string          { return "email" }
+func (t *emailTarget) Format() messageFormat { return formatPlain }
+
+func (t *emailTarget) Send(ctx context.Context, n Notification) error {
+	message, err := t.message(n, time.Now().In(n.Data.Time.Location()))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", t.server)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(t.server)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close() //nolint:errcheck
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if t.auth != nil {
+		if err := client.Auth(t.auth); err != nil {
+			return fmt.Errorf("failed to log in to SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(t.from); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	for _, to := range t.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to send email to %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// message builds the email for a notification: plain text, or with --email-html, a
+// multipart/alternative message with the plain text as a fallback for the HTML
+func (t *emailTarget) message(n Notification, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", t.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(t.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Relish: "+string(n.Data.Status)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	if !t.html {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, n.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var html strings.Builder
+	if err := emailHTMLTemplate.Execute(&html, ExecData{MessageData: n.Data, Message: n.Text}); err != nil {
+		return nil, fmt.Errorf("failed to render HTML email: %w", err)
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", n.Text},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable writes text to w in the quoted-printable encoding
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
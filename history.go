@@ -0,0 +1,76 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// historyEntry is a single status observation in the history file
+type historyEntry struct {
+	Time    time.Time          `json:"time"`
+	Status  relish.OrderStatus `json:"status"`
+	ETA     string             `json:"eta,omitempty"`
+	ETATime time.Time          `json:"eta_time,omitzero"`
+	Vendor  string             `json:"vendor,omitempty"`
+}
+
+// newHistoryEntry describes the order information observed at a given time
+func newHistoryEntry(info relish.OrderInfo, observed time.Time) historyEntry {
+	return historyEntry{
+		Time:    observed,
+		Status:  info.Status,
+		ETA:     info.ETA,
+		ETATime: etaTime(info.ETA, observed),
+		Vendor:  info.Vendor,
+	}
+}
+
+// history appends status observations to a JSON lines file
+type history struct {
+	file *os.File
+}
+
+// openHistory opens the history file at path for appending, creating it if necessary
+func openHistory(path string) (*history, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	return &history{file: file}, nil
+}
+
+// record appends an observation to the history file and flushes it to disk
+func (h *history) record(info relish.OrderInfo, observed time.Time) error {
+	if err := json.NewEncoder(h.file).Encode(newHistoryEntry(info, observed)); err != nil {
+		return fmt.Errorf("failed to write history entry: %w", err)
+	}
+
+	return h.file.Sync()
+}
+
+// Close closes the history file
+func (h *history) Close() error {
+	return h.file.Close()
+}
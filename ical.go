@@ -0,0 +1,289 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"relish-notifier/relish"
+)
+
+// icalEventLength is how long the event for a delivery lasts
+const icalEventLength = 15 * time.Minute
+
+// icalTimeFormat is the format of a UTC date and time in an iCalendar file
+const icalTimeFormat = "20060102T150405Z"
+
+// icalLineLimit is the longest a line in an iCalendar file may be, in bytes, before it is
+// folded onto the next
+const icalLineLimit = 75
+
+// icalArrived is the STATUS of the event for an order that has arrived
+const icalArrived = "STATUS:CONFIRMED"
+
+// calendar keeps an event for each delivery in an iCalendar file, for --ical-file. Events
+// already in the file, including those for earlier orders, are kept.
+type calendar struct {
+	path string
+	// last describes the order as it was last recorded, so that the file is only rewritten
+	// when something changes
+	last string
+}
+
+// icalEvent is the event for a delivery
+type icalEvent struct {
+	uid     string
+	start   time.Time
+	stamp   time.Time
+	status  relish.OrderStatus
+	eta     string
+	vendor  string
+	driver  string
+	arrived bool
+}
+
+// newICalEvent describes the delivery of the order, as seen at observed. There is no
+// event until the order has an ETA or has arrived, since until then there is no time to
+// put it at.
+func newICalEvent(info relish.OrderInfo, observed time.Time) (icalEvent, bool) {
+	if info.Status == relish.OrderStatusUnknown {
+		return icalEvent{}, false
+	}
+
+	event := icalEvent{
+		uid:     icalUID(info, observed),
+		stamp:   observed,
+		status:  info.Status,
+		eta:     info.ETA,
+		vendor:  info.Vendor,
+		driver:  info.Driver,
+		arrived: info.Status == relish.OrderStatusArrived,
+	}
+
+	if event.arrived {
+		event.start = observed
+	} else {
+		event.start = etaTime(info.ETA, observed)
+	}
+	return event, !event.start.IsZero()
+}
+
+// icalUID identifies the event for an order: by its ID if the site shows one, or else by
+// the day and vendor
+func icalUID(info relish.OrderInfo, observed time.Time) string {
+	if info.OrderID != "" {
+		return "order-" + info.OrderID + "@relish-notifier"
+	}
+	sum := sha256.Sum256([]byte(info.Vendor))
+	return observed.Format("20060102") + "-" + hex.EncodeToString(sum[:4]) + "@relish-notifier"
+}
+
+// lines returns the properties of the event, unfolded
+func (e icalEvent) lines() []string {
+	summary := "Relish delivery"
+	if e.vendor != "" {
+		summary = "Relish delivery from " + e.vendor
+	}
+
+	description := "Status: " + string(e.status)
+	if e.eta != "" {
+		description += "\nETA: " + e.eta
+	}
+	if e.driver != "" {
+		description += "\nDriver: " + e.driver
+	}
+
+	status := "STATUS:TENTATIVE"
+	switch {
+	case e.arrived:
+		status = icalArrived
+	case e.status == relish.OrderStatusCancelled:
+		status = "STATUS:CANCELLED"
+	}
+
+	return []string{
+		"BEGIN:VEVENT",
+		"UID:" + e.uid,
+		"DTSTAMP:" + e.stamp.UTC().Format(icalTimeFormat),
+		"DTSTART:" + e.start.UTC().Format(icalTimeFormat),
+		"DTEND:" + e.start.Add(icalEventLength).UTC().Format(icalTimeFormat),
+		"SUMMARY:" + icalText(summary),
+		"DESCRIPTION:" + icalText(description),
+		status,
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+	}
+}
+
+// icalText escapes s for use as the value of a text property
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// record adds or updates the event for the order in the file. An arrival that is already
+// recorded isn't moved, so that the event stays at the time the order arrived.
+func (c *calendar) record(info relish.OrderInfo, observed time.Time) error {
+	event, ok := newICalEvent(info, observed)
+	if !ok {
+		return nil
+	}
+	current := strings.Join([]string{event.uid, string(info.Status), info.ETA, info.Vendor, info.Driver}, "\n")
+	if current == c.last {
+		return nil
+	}
+
+	events, err := readICalEvents(c.path)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, existing := range events {
+		if icalProperty(existing, "UID") != event.uid {
+			continue
+		}
+		if event.arrived && slices.Contains(existing, icalArrived) {
+			c.last = current
+			return nil
+		}
+		events[i] = event.lines()
+		replaced = true
+	}
+	if !replaced {
+		events = append(events, event.lines())
+	}
+	if err := writeICalEvents(c.path, events); err != nil {
+		return err
+	}
+	c.last = current
+	return nil
+}
+
+// icalProperty returns the value of the named property of an event, or "" if it has none
+func icalProperty(event []string, name string) string {
+	for _, line := range event {
+		if value, ok := strings.CutPrefix(line, name+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// readICalEvents reads the events in the iCalendar file at path, as unfolded lines. A
+// missing file has no events.
+func readICalEvents(path string) ([][]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+
+	var (
+		events [][]string
+		event  []string
+		lines  []string
+	)
+	for line := range strings.SplitSeq(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		// A line starting with whitespace continues the one before it
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	for _, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = []string{line}
+		case event == nil:
+			// Calendar properties are written again with the events
+		case line == "END:VEVENT":
+			events = append(events, append(event, line))
+			event = nil
+		default:
+			event = append(event, line)
+		}
+	}
+	return events, nil
+}
+
+// writeICalEvents replaces the iCalendar file at path with one holding events
+func writeICalEvents(path string, events [][]string) error {
+	var b strings.Builder
+	write := func(line string) {
+		b.WriteString(icalFold(line))
+		b.WriteString("\r\n")
+	}
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//relish-notifier//relish-notifier//EN")
+	write("X-WR-CALNAME:Relish deliveries")
+	for _, event := range events {
+		for _, line := range event {
+			write(line)
+		}
+	}
+	write("END:VCALENDAR")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create calendar directory: %w", err)
+	}
+
+	// Write to a temporary file first so that a calendar app never reads half of it
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write calendar: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write calendar: %w", err)
+	}
+	return nil
+}
+
+// icalFold splits a line longer than icalLineLimit bytes into several, each after the
+// first starting with a space, without splitting a UTF-8 character
+func icalFold(line string) string {
+	var b strings.Builder
+	limit := icalLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the limit
+		limit = icalLineLimit - 1
+	}
+	b.WriteString(line)
+	return b.String()
+}
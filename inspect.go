@@ -0,0 +1,112 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"relish-notifier/relish"
+)
+
+// inspectFunc tries a selector on the schedule page
+type inspectFunc func(ctx context.Context, selector string, highlight bool) (relish.SelectorMatch, error)
+
+// inspectSelector tries selector on the schedule page and writes what it matched to w.
+// It returns an error if the selector matched nothing.
+func inspectSelector(ctx context.Context, w io.Writer, selector string, highlight bool, inspect inspectFunc) error {
+	match, err := inspect(ctx, selector, highlight)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "page:     %s\n", match.URL)   //nolint:errcheck
+	fmt.Fprintf(w, "selector: %s\n", selector)    //nolint:errcheck
+	fmt.Fprintf(w, "matches:  %d\n", match.Count) //nolint:errcheck
+	if match.Count == 0 {
+		return fmt.Errorf("%q matches nothing on the page", selector)
+	}
+	fmt.Fprintf(w, "text:     %q\n", match.Text) //nolint:errcheck
+	return nil
+}
+
+// openInspector logs in to the site with a browser and returns the notifier, which is
+// left on the schedule page. The returned cleanup function must be called when it is no
+// longer needed.
+func openInspector(ctx context.Context, config *Config, logger *slog.Logger) (*relish.Notifier, func(), error) {
+	if config.Source != sourceBrowser {
+		return nil, nil, fmt.Errorf("inspect needs --source %s", sourceBrowser)
+	}
+
+	state, err := loadState(config.StateFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	source, cleanup, err := openSource(ctx, config, state, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return source.(*browserSource).Notifier, cleanup, nil
+}
+
+// newInspectCommand creates the inspect subcommand, which tries a selector on the schedule
+// page, for adapting --status-selector and friends when the site changes
+func newInspectCommand(config *Config, root *cobra.Command) *cobra.Command {
+	var selector string
+
+	cmd := &cobra.Command{
+		Use:   "inspect --selector SELECTOR",
+		Short: "Log in and show what a selector matches on the schedule page",
+		Long: "Log in and show what a selector matches on the schedule page.\n\n" +
+			"inspect logs in with the same options you run relish-notifier with, then reports how many\n" +
+			"elements on the schedule page the selector matches and the text of the first one. With\n" +
+			"--headless=false, the matches are outlined in the browser, which stays open until you press\n" +
+			"Enter. It exits with status 1 if the selector matches nothing.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			logger := config.logger()
+
+			if err := config.Validate(); err != nil {
+				return err
+			}
+
+			// Leave a headful browser open so that the highlighted matches can be seen
+			config.KeepOpen = !config.Headless
+
+			notifier, cleanup, err := openInspector(cmd.Context(), config, logger)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			return inspectSelector(cmd.Context(), cmd.OutOrStdout(), selector, !config.Headless, notifier.Inspect)
+		},
+	}
+
+	cmd.Flags().AddFlagSet(root.Flags())
+	cmd.Flags().StringVar(&selector, "selector", "", "CSS selector to try on the schedule page")
+	_ = cmd.MarkFlagRequired("selector")
+
+	return cmd
+}
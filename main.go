@@ -19,306 +19,762 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
-	"github.com/go-rod/rod/lib/proto"
 	"github.com/spf13/cobra"
-	"github.com/zalando/go-keyring"
+
+	"relish-notifier/relish"
 )
 
 // Version is set via ldflags during build
 var version = "dev"
 
-type OrderStatus string
-
-const (
-	OrderStatusPlaced    OrderStatus = "Order Placed"
-	OrderStatusPreparing OrderStatus = "Preparing Your Order"
-	OrderStatusArrived   OrderStatus = "Order Arrived"
-	OrderStatusUnknown   OrderStatus = "Unknown"
-)
+// buildDate is set via ldflags during build
+var buildDate = ""
 
-const defaultLoginURL string = "https://relish.ezcater.com/schedule"
+// minInterval is the shortest permitted time between checks
+const minInterval = 5 * time.Second
 
-// String converts an OrderStatus value to its string representation
-func (os OrderStatus) String() string {
-	return string(os)
+// Config holds the command line options, including those passed through to the relish package
+type Config struct {
+	relish.Config
+	Interval             time.Duration
+	IntervalSchedule     string
+	QuietHours           string
+	MarkupBaseline       bool
+	Once                 bool
+	UntilArrived         bool
+	ContinueAfterArrival bool
+	Command              string
+	CommandTimeout       time.Duration
+	CommandStdinJSON     bool
+	CommandLogOutput     string
+	NotifyCommandOnError string
+	PreLoginCommand      string
+	PreLoginTimeout      time.Duration
+	Exec                 string
+	ExecArgs             []string
+	Verbose              int
+	MessageTemplate      string
+	MarkdownTemplate     string
+	Desktop              bool
+	Notify               []string
+	CommandOn            string
+	ExecOn               string
+	DesktopOn            string
+	SlackOn              string
+	SlackWebhook         string
+	EmailOn              string
+	EmailTo              string
+	EmailFrom            string
+	EmailHTML            bool
+	SMTPServer           string
+	SMTPUsername         string
+	SMSOn                string
+	SMSTo                string
+	TwilioSID            string
+	TwilioToken          string
+	TwilioFrom           string
+	KeepOpen             bool
+	StateFile            string
+	DedupeWindow         time.Duration
+	ForceNotify          bool
+	MinLoginInterval     time.Duration
+	Output               string
+	StreamJSON           bool
+	Quiet                bool
+	MaxRelogins          int
+	MaxBrowserRestarts   int
+	MaxChecks            int
+	MaxRequestsPerHour   int
+	ConfirmArrived       int
+	OnUnknown            string
+	UnknownThreshold     int
+	TOTPSecret           string
+	SessionCookie        string
+	HistoryFile          string
+	ICalFile             string
+	Source               string
+	Profile              string
+	Profiles             []string
+	KeyringService       string
+	NoKeyring            bool
+	KeyringTimeout       time.Duration
+	Serve                string
+	StatsdAddr           string
+	ControlSocket        string
+	PIDFile              string
+	PrintConfig          bool
+	NotifyOnFailure      int
+	WaitingNotifyEvery   time.Duration
+	RestartBrowserEvery  time.Duration
+	ThrottleSpec         string
+	TimeZone             string
+	TUI                  bool
+	NoColor              bool
+	ErrorBundleDir       string
+	IMAP                 relish.IMAPConfig
+
+	// schedule is parsed from IntervalSchedule
+	schedule *intervalSchedule
+	// quietHours is parsed from QuietHours
+	quietHours *intervalWindow
+	// keyringHung is set once a keyring lookup has timed out, until the credentials are
+	// reloaded
+	keyringHung *atomic.Bool
 }
 
-// textToStatus converts a string to the corresponding OrderStatus enum value
-func textToStatus(text string) OrderStatus {
-	switch text {
-	case string(OrderStatusPlaced):
-		return OrderStatusPlaced
-	case string(OrderStatusPreparing):
-		return OrderStatusPreparing
-	case string(OrderStatusArrived):
-		return OrderStatusArrived
-	default:
-		return OrderStatusUnknown
+// getCredentials retrieves login credentials for the selected profile and keyring service from the
+// system keychain, unless it is disabled, systemd credentials, or environment variables
+func getCredentials(config *Config) (*relish.Credentials, error) {
+	username, err := lookupCredential(config, "EMAIL", "RELISH_USERNAME")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get username from keyring (%w) and RELISH_USERNAME is not set as a systemd credential or environment variable", err)
 	}
-}
 
-type Config struct {
-	Headless    bool
-	Extensions  bool
-	Interval    int
-	Once        bool
-	PageTimeout time.Duration
-	Command     string
-	Verbose     int
-}
+	password, err := lookupCredential(config, "PASSWORD", "RELISH_PASSWORD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password from keyring (%w) and RELISH_PASSWORD is not set as a systemd credential or environment variable", err)
+	}
 
-type Credentials struct {
-	Username string
-	Password string
-}
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("missing credentials: both keyring and environment variables are empty")
+	}
+
+	// The TOTP secret is only needed for accounts with two-factor authentication
+	totpSecret, _ := lookupCredential(config, "TOTP_SECRET", "RELISH_TOTP_SECRET")
 
-type Notifier struct {
-	browser     *rod.Browser
-	page        *rod.Page
-	config      *Config
-	credentials *Credentials
-	logger      *slog.Logger
-	loginUrl    string
+	return &relish.Credentials{
+		Username:   username,
+		Password:   password,
+		TOTPSecret: totpSecret,
+	}, nil
 }
 
-// NewNotifier creates a new Notifier instance with the provided configuration, credentials, and logger
-func NewNotifier(config *Config, credentials *Credentials, logger *slog.Logger) *Notifier {
-	return &Notifier{
-		config:      config,
-		credentials: credentials,
-		logger:      logger,
-		loginUrl:    defaultLoginURL,
+// getIMAPPassword retrieves the mailbox password for the selected profile and keyring service from
+// the system keychain, systemd credentials, or environment
+func getIMAPPassword(config *Config) (string, error) {
+	password, err := lookupCredential(config, "IMAP_PASSWORD", "RELISH_IMAP_PASSWORD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get IMAP password from keyring (%w) and RELISH_IMAP_PASSWORD is not set as a systemd credential or environment variable", err)
 	}
-}
 
-// initializeBrowser sets up the browser instance with stealth options and configures the page
-func (n *Notifier) initializeBrowser() error {
-	n.logger.Debug("initializing browser")
+	return password, nil
+}
 
-	launcher := launcher.New()
+// getSMTPPassword retrieves the password for --smtp-username from the system keychain,
+// unless it is disabled, a systemd credential, or an environment variable
+func getSMTPPassword(config *Config) (string, error) {
+	password, err := lookupCredential(config, "SMTP_PASSWORD", "RELISH_SMTP_PASSWORD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get SMTP password from keyring (%w) and RELISH_SMTP_PASSWORD is not set as a systemd credential or environment variable", err)
+	}
 
-	// Set headless mode explicitly (Rod defaults to headless=true)
-	launcher = launcher.Headless(n.config.Headless)
+	return password, nil
+}
 
-	if !n.config.Extensions {
-		launcher = launcher.Set("disable-extensions")
+// getTwilioToken retrieves the auth token for --twilio-sid from the system keychain,
+// unless it is disabled, a systemd credential, or an environment variable
+func getTwilioToken(config *Config) (string, error) {
+	token, err := lookupCredential(config, "TWILIO_TOKEN", "RELISH_TWILIO_TOKEN")
+	if err != nil {
+		return "", fmt.Errorf("failed to get Twilio token from keyring (%w) and RELISH_TWILIO_TOKEN is not set as a systemd credential or environment variable", err)
 	}
 
-	// Set stealth options similar to selenium-stealth
-	launcher = launcher.
-		Set("exclude-switches", "enable-automation").
-		Set("disable-blink-features", "AutomationControlled").
-		Set("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	return token, nil
+}
 
-	url := launcher.MustLaunch()
-	browser := rod.New().ControlURL(url)
+// setupLogger creates a structured logger with the appropriate log level based on verbosity
+func setupLogger(verbose int) *slog.Logger {
+	return setupLoggerIn(verbose, nil, false)
+}
 
-	if err := browser.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to browser: %w", err)
+// setupLoggerIn creates a logger like setupLogger whose timestamps are in loc, or in the
+// local time zone if loc is nil, and whose levels are colored if color is set
+func setupLoggerIn(verbose int, loc *time.Location, color bool) *slog.Logger {
+	opts := logHandlerOptions(verbose, loc)
+	if color {
+		return slog.New(newColorHandler(os.Stderr, opts))
 	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
 
-	n.browser = browser
-	n.page = browser.MustPage()
+// logger creates the logger selected by -v, --tz, and --no-color
+func (c *Config) logger() *slog.Logger {
+	return setupLoggerIn(c.Verbose, c.Location, useColor(c.NoColor, os.Stderr))
+}
 
-	// Set page timeout
-	n.page.Timeout(n.config.PageTimeout)
+// logHandlerOptions returns the options for a log handler at the level set by verbose,
+// with timestamps in loc, or in the local time zone if loc is nil
+func logHandlerOptions(verbose int, loc *time.Location) *slog.HandlerOptions {
+	var level slog.Level
 
-	return nil
-}
+	switch {
+	case verbose <= 0:
+		level = slog.LevelWarn // Default: warning level
+	case verbose == 1:
+		level = slog.LevelInfo // -v: info level
+	case verbose >= 2:
+		level = slog.LevelDebug // -vv or more: debug level
+	}
 
-// Close shuts down the browser instance if it exists
-func (n *Notifier) Close() {
-	if n.browser != nil {
-		n.browser.MustClose()
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
+	if loc != nil {
+		opts.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				attr.Value = slog.TimeValue(attr.Value.Time().In(loc))
+			}
+			return attr
+		}
 	}
+	return opts
 }
 
-// Login navigates to the Relish login page and authenticates using stored credentials
-func (n *Notifier) Login() error {
-	n.logger.Info("logging in")
+// login authenticates the notifier, deferring the attempt if the previous one was too recent
+func login(ctx context.Context, notifier *relish.Notifier, state *State, config *Config, logger *slog.Logger) error {
+	if delay := state.loginDelay(config.MinLoginInterval, time.Now()); delay > 0 {
+		logger.Warn("deferring login attempt", "delay", delay.Round(time.Second), "min_login_interval", config.MinLoginInterval)
 
-	if err := n.page.Navigate(n.loginUrl); err != nil {
-		return fmt.Errorf("failed to navigate to login page: %w", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
 	}
 
-	// Wait for and fill email field
-	if err := n.waitAndSubmit("#identity_email", "[name='commit']", n.credentials.Username); err != nil {
-		return fmt.Errorf("failed to submit email: %w", err)
+	// Record the attempt before making it so that a crash during login still counts
+	state.LastLoginAttempt = time.Now()
+	if err := state.save(config.StateFile); err != nil {
+		logger.Warn("failed to save state", "error", err)
 	}
 
-	// Wait for and fill password field
-	if err := n.waitAndSubmit("#password", "[name='action']", n.credentials.Password); err != nil {
-		return fmt.Errorf("failed to submit password: %w", err)
+	return notifier.Login(ctx)
+}
+
+// shouldNotify reports whether a change from the previous to the current status is worth a notification
+func shouldNotify(previous, current relish.OrderStatus) bool {
+	if current.IsFinal() {
+		return true
 	}
+	// A delay, a driver being assigned, or the order heading out, is reported once rather
+	// than on every check
+	switch current {
+	case relish.OrderStatusDelayed, relish.OrderStatusDriverAssigned, relish.OrderStatusOutForDelivery:
+		return previous != current
+	default:
+		return false
+	}
+}
 
-	return nil
+// notify reports a change from the previous status on stdout, if it is notable, and to
+// the notification targets that want it, unless they have already been notified of it
+func notify(ctx context.Context, config *Config, stdout io.Writer, d *dispatcher, previous relish.OrderStatus, info relish.OrderInfo, logger *slog.Logger) {
+	// The day of an order without an ID is the day in the --tz time zone
+	now := config.now()
+	data := newMessageData(info, now)
+	message := d.render(formatPlain, data)
+
+	// With --once, the loop writes the result for an order that is still on its way, and
+	// --until-arrived only writes the final result. Changes only some targets asked for
+	// aren't written at all.
+	// With --stream-json, every check has already been written.
+	if shouldNotify(previous, info.Status) && !config.StreamJSON && (info.Status.IsFinal() || !(config.Once || config.UntilArrived)) {
+		if err := writeResult(stdout, config.Output, newCheckResult(info, message, nil)); err != nil {
+			logger.Error("failed to write result", "error", err)
+		}
+	}
+
+	if d.dedupe == nil || d.dedupe.allow(info, now) {
+		d.send(ctx, previous, data, message)
+	}
 }
 
-// waitAndSubmit waits for a form field, fills it with data, then clicks the specified button
-func (n *Notifier) waitAndSubmit(fieldSelector, buttonSelector, data string) error {
-	n.logger.Debug("waiting for element before clicking", "field", fieldSelector, "button", buttonSelector)
+// resolveInterval applies the legacy --check-interval flag, if given, and validates the result
+func resolveInterval(cmd *cobra.Command, config *Config, checkIntervalSeconds int) error {
+	flags := cmd.Flags()
 
-	// Wait for field to be present and fill it
-	field := n.page.MustElement(fieldSelector)
-	if err := field.Input(data); err != nil {
-		return fmt.Errorf("failed to input data: %w", err)
+	if flags.Changed("check-interval") {
+		if flags.Changed("interval") {
+			return fmt.Errorf("--interval and --check-interval cannot be used together")
+		}
+		config.Interval = time.Duration(checkIntervalSeconds) * time.Second
+	}
+
+	if config.Interval < minInterval {
+		return fmt.Errorf("check interval %s is too short (minimum %s)", config.Interval, minInterval)
 	}
 
-	// Find and click button
-	button := n.page.MustElement(buttonSelector)
-	if err := button.Click(proto.InputMouseButtonLeft, 1); err != nil {
-		return fmt.Errorf("failed to click button: %w", err)
+	if config.IntervalSchedule != "" {
+		schedule, err := parseIntervalSchedule(config.IntervalSchedule)
+		if err != nil {
+			return err
+		}
+		config.schedule = schedule
 	}
 
-	// Wait for navigation to complete
-	n.page.MustWaitNavigation()()
+	if config.QuietHours != "" {
+		window, err := parseQuietHours(config.QuietHours)
+		if err != nil {
+			return err
+		}
+		config.quietHours = &window
+	}
 
 	return nil
 }
 
-// CheckOrderStatus scrapes the order status from the Relish website and returns the parsed status
-func (n *Notifier) CheckOrderStatus() (OrderStatus, error) {
-	n.logger.Debug("checking order status")
-
-	// Look for the schedule-card-label element
-	element, err := n.page.Element(".schedule-card-label")
-	if err != nil {
-		n.logger.Warn("timeout waiting for order status")
-		return OrderStatusUnknown, fmt.Errorf("failed to find order status element: %w", err)
+// intervalAt returns the time to wait after a check at now: the interval of the
+// --interval-schedule window now falls in, in the --tz time zone, or --interval outside
+// of them
+func (c *Config) intervalAt(now time.Time) time.Duration {
+	if c.schedule == nil {
+		return c.Interval
 	}
+	return c.schedule.at(now.In(c.zone()), c.Interval)
+}
 
-	text, err := element.Text()
-	if err != nil {
-		return OrderStatusUnknown, fmt.Errorf("failed to get element text: %w", err)
+// intervalAttrs describes how intervalAt chose the time to wait after a check at now, for
+// logging: the --interval, the --interval-schedule window that replaced it, if any, and
+// the --max-requests-per-hour budget that can make the wait longer
+func (c *Config) intervalAttrs(now time.Time) []any {
+	attrs := []any{"base_interval", c.Interval}
+	if c.schedule != nil {
+		if window, ok := c.schedule.window(now.In(c.zone())); ok {
+			attrs = append(attrs, "schedule_window", window.String(), "schedule_interval", window.interval)
+		}
+	}
+	if c.MaxRequestsPerHour > 0 {
+		attrs = append(attrs, "max_requests_per_hour", c.MaxRequestsPerHour)
 	}
+	return attrs
+}
 
-	status := textToStatus(strings.TrimSpace(text))
-	if status == OrderStatusUnknown {
-		n.logger.Warn("unknown order status", "status", text)
+// quietUntil returns when the --quiet-hours window ends, if now, taken in the --tz time
+// zone, falls in it
+func (c *Config) quietUntil(now time.Time) (time.Time, bool) {
+	if c.quietHours == nil {
+		return time.Time{}, false
 	}
+	now = now.In(c.zone())
+	if !c.quietHours.contains(timeOfDay(now)) {
+		return time.Time{}, false
+	}
+	return c.quietHours.endAfter(now), true
+}
 
-	return status, nil
+// zone returns the --tz time zone, or the local one if it isn't set
+func (c *Config) zone() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
 }
 
-// Refresh reloads the current page in the browser
-func (n *Notifier) Refresh() error {
-	n.logger.Debug("reloading page")
-	return n.page.Reload()
+// now returns the current time in the --tz time zone
+func (c *Config) now() time.Time {
+	return time.Now().In(c.zone())
 }
 
-// getCredentials retrieves login credentials from the system keychain or environment variables
-func getCredentials() (*Credentials, error) {
-	var username, password string
+// Exit statuses, besides 1 for a single check with --once and 2 for a cancelled order
+const (
+	// exitInvalidCredentials is the exit status when the site rejects the stored credentials
+	exitInvalidCredentials = 3
+	// exitMaxChecks is the exit status when --max-checks is reached before the order arrives
+	exitMaxChecks = 4
+	// exitUnknownStatus is the exit status when, with --on-unknown fail, --unknown-threshold
+	// checks in a row find a status that isn't recognized
+	exitUnknownStatus = 5
+)
 
-	// Try keyring first
-	username, err := keyring.Get("relish-notifier", "EMAIL")
-	if err != nil {
-		// Keyring failed, try environment variables
-		username = os.Getenv("RELISH_USERNAME")
-		if username == "" {
-			return nil, fmt.Errorf("failed to get username from keyring (%w) and RELISH_USERNAME environment variable is not set", err)
-		}
-	}
+// exitCodeError requests that the process exit with a specific status. The error, if any,
+// is reported before exiting; otherwise the process exits quietly.
+type exitCodeError struct {
+	code int
+	err  error
+}
 
-	password, err = keyring.Get("relish-notifier", "PASSWORD")
-	if err != nil {
-		// Keyring failed, try environment variables
-		password = os.Getenv("RELISH_PASSWORD")
-		if password == "" {
-			return nil, fmt.Errorf("failed to get password from keyring (%w) and RELISH_PASSWORD environment variable is not set", err)
-		}
+func (e exitCodeError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
 	}
+	return fmt.Sprintf("exit status %d", e.code)
+}
 
-	if username == "" || password == "" {
-		return nil, fmt.Errorf("missing credentials: both keyring and environment variables are empty")
-	}
+func (e exitCodeError) Unwrap() error {
+	return e.err
+}
 
-	return &Credentials{
-		Username: username,
-		Password: password,
-	}, nil
+// invalidCredentialsError explains how to fix credentials that the site has rejected
+func invalidCredentialsError(profile string, err error) error {
+	command := "relish-notifier login"
+	if profile != "" {
+		command += " --profile " + profile
+	}
+	return exitCodeError{
+		code: exitInvalidCredentials,
+		err:  fmt.Errorf("%w; run %q to update your stored credentials", err, command),
+	}
 }
 
-// setupLogger creates a structured logger with the appropriate log level based on verbosity
-func setupLogger(verbose int) *slog.Logger {
-	var level slog.Level
+// promptOTP asks the user to type a two-factor authentication code on the terminal
+func promptOTP(ctx context.Context) (string, error) {
+	fmt.Fprint(os.Stderr, "two-factor authentication code: ")
 
-	switch {
-	case verbose <= 0:
-		level = slog.LevelWarn // Default: warning level
-	case verbose == 1:
-		level = slog.LevelInfo // -v: info level
-	case verbose >= 2:
-		level = slog.LevelDebug // -vv or more: debug level
+	type result struct {
+		code string
+		err  error
 	}
+	done := make(chan result, 1)
+	go func() {
+		code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		done <- result{code, err}
+	}()
 
-	opts := &slog.HandlerOptions{
-		Level: level,
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-done:
+		return r.code, r.err
 	}
+}
+
+// waitForUser blocks until the user presses Enter or the context is cancelled
+func waitForUser(ctx context.Context) {
+	fmt.Fprintln(os.Stderr, "leaving browser open; press Enter to exit")
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+		close(done)
+	}()
 
-	handler := slog.NewTextHandler(os.Stderr, opts)
-	return slog.New(handler)
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
 }
 
 // main sets up the CLI interface and executes the root command
 func main() {
-	var config Config
+	config := Config{keyringHung: new(atomic.Bool)}
+	var checkIntervalSeconds int
 
 	rootCmd := &cobra.Command{
 		Use:     "relish-notifier",
 		Short:   "Monitor Relish orders and send notifications",
-		Long:    "Monitor Relish orders and send notifications.\n\nCredentials are retrieved from the system keychain (service: relish-notifier, accounts: EMAIL/PASSWORD).\nIf keychain is unavailable, environment variables RELISH_USERNAME and RELISH_PASSWORD will be used as fallback.",
+		Long:    "Monitor Relish orders and send notifications.\n\nCredentials are retrieved from the system keychain (service: relish-notifier, accounts: EMAIL/PASSWORD/TOTP_SECRET),\nwhere you can store them with the login subcommand. With --profile NAME, the accounts are prefixed with NAME/.\nIf keychain is unavailable, systemd credentials or environment variables named RELISH_USERNAME, RELISH_PASSWORD, and RELISH_TOTP_SECRET will be used as fallback.",
 		Version: version,
+		// main reports errors itself so that exitCodeError can be handled quietly
+		SilenceErrors: true,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return resolveInterval(cmd, &config, checkIntervalSeconds)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runNotifier(&config)
+			// Flags parsed successfully, so don't show usage for runtime errors
+			cmd.SilenceUsage = true
+			if config.PrintConfig {
+				return printConfig(cmd.OutOrStdout(), config)
+			}
+			return runNotifier(&config, cmd.OutOrStdout())
 		},
 	}
 
 	rootCmd.Flags().BoolVar(&config.Headless, "headless", true, "Run Chrome in headless mode")
+	rootCmd.Flags().StringVar(&config.HeadlessMode, "headless-mode", relish.HeadlessModeOld, "Chrome headless implementation to use: old or new (new renders pages like a normal browser window)")
+	rootCmd.Flags().StringArrayVar(&config.ChromeFlags, "chrome-flag", nil, "Extra Chrome command line flag, as name or name=value, overriding the built in options (may be repeated)")
+	rootCmd.Flags().BoolVar(&config.BlockResources, "block-resources", false, "Don't load images, fonts, and media, which aren't needed to read the order status")
+	rootCmd.Flags().BoolVar(&config.APIMode, "api-mode", false, "Read the order status from the site's JSON API at --api-url, reading the page if the request fails")
+	rootCmd.Flags().StringVar(&config.APIURL, "api-url", "", "URL of the JSON endpoint the schedule page gets the order status from, for --api-mode")
+	rootCmd.Flags().StringVar(&config.APIStatusField, "api-status-field", relish.DefaultAPIStatusField, "Dotted path of the order status in the API response, such as orders.0.status")
+	rootCmd.Flags().StringVar(&config.APIETAField, "api-eta-field", relish.DefaultAPIETAField, "Dotted path of the estimated arrival time in the API response")
+	rootCmd.Flags().StringVar(&config.APIOrderIDField, "api-order-id-field", relish.DefaultAPIOrderIDField, "Dotted path of the order ID in the API response, which must match --order-id for the API to be used")
+	rootCmd.Flags().StringVar(&config.APIVendorField, "api-vendor-field", relish.DefaultAPIVendorField, "Dotted path of the restaurant name in the API response")
+	rootCmd.Flags().StringVar(&config.APIDriverField, "api-driver-field", relish.DefaultAPIDriverField, "Dotted path of the delivery driver's name in the API response")
+	rootCmd.Flags().StringVar(&config.APIDriverLocationField, "api-driver-location-field", relish.DefaultAPIDriverLocationField, "Dotted path of the delivery driver's location in the API response")
 	rootCmd.Flags().BoolVar(&config.Extensions, "extensions", true, "Enable browser extensions")
-	rootCmd.Flags().IntVarP(&config.Interval, "check-interval", "i", 30, "How often to check for delivery (seconds)")
+	rootCmd.Flags().DurationVar(&config.Interval, "interval", 30*time.Second, "How often to check for delivery")
+	rootCmd.Flags().BoolVar(&config.MarkupBaseline, "markup-baseline", false, "Save the schedule page markup as the baseline that later checks are compared with, to warn when the site changes")
+	rootCmd.Flags().StringVar(&config.QuietHours, "quiet-hours", "", "Don't check between these times of day, e.g. 22:00-07:00, in the --tz time zone")
+	rootCmd.Flags().StringVar(&config.IntervalSchedule, "interval-schedule", "", "Check at a different interval at certain times of day, e.g. 11:45-12:30=15s,17:00-18:00=30s (--interval applies at other times)")
+	rootCmd.Flags().IntVarP(&checkIntervalSeconds, "check-interval", "i", 30, "How often to check for delivery (seconds); alias for --interval")
 	rootCmd.Flags().BoolVar(&config.Once, "once", false, "Check once and exit")
+	rootCmd.Flags().BoolVar(&config.UntilArrived, "until-arrived", false, "Check until the order arrives, writing only the final result, for scripts that wait for the order")
+	rootCmd.Flags().BoolVar(&config.ContinueAfterArrival, "continue-after-arrival", false, "Keep checking after the order arrives or is cancelled, and notify about each later order too")
 	rootCmd.Flags().DurationVarP(&config.PageTimeout, "page-timeout", "t", 10*time.Second, "Set page timeout")
-	rootCmd.Flags().StringVarP(&config.Command, "command", "c", "", "Run this command when your order has arrived")
+	rootCmd.Flags().DurationVar(&config.LoginTimeout, "login-timeout", 0, "Page timeout while logging in (default is --page-timeout)")
+	rootCmd.Flags().DurationVar(&config.CheckTimeout, "check-timeout", 0, "Page timeout while checking the order status (default is --page-timeout)")
+	rootCmd.Flags().StringVarP(&config.Command, "command", "c", "", "Run this command when your order has arrived (see --command-on for other statuses and events)")
+	rootCmd.Flags().BoolVar(&config.CommandStdinJSON, "command-stdin-json", false, "Send a JSON description of the order to --command on stdin")
+	rootCmd.Flags().StringVar(&config.CommandLogOutput, "command-log-output", "", "Keep what --command prints: \"log\" to log it, or a file to append it to (the first 64 KiB of each run)")
+	rootCmd.Flags().DurationVar(&config.CommandTimeout, "command-timeout", 0, "Stop commands run by --command, --exec, and --notify-command-on-error after this long (0 for no limit)")
+	rootCmd.Flags().StringVar(&config.NotifyCommandOnError, "notify-command-on-error", "", "Run this command whenever a check fails, with the error in RELISH_ERROR")
+	rootCmd.Flags().StringVar(&config.PreLoginCommand, "pre-login-command", "", "Run this command before logging in, such as to bring up a VPN, and stop if it fails")
+	rootCmd.Flags().DurationVar(&config.PreLoginTimeout, "pre-login-timeout", 2*time.Minute, "Stop the --pre-login-command command after this long and treat it as failed (0 for no limit)")
+	rootCmd.Flags().StringVar(&config.Exec, "exec", "", "Run this program directly, without a shell, when your order has arrived (see --exec-on for other statuses and events)")
+	rootCmd.Flags().StringArrayVar(&config.ExecArgs, "exec-arg", nil, "Argument template for --exec (may be repeated)")
 	rootCmd.Flags().CountVarP(&config.Verbose, "verbose", "v", "Increase verbosity (-v: info, -vv: debug)")
+	rootCmd.Flags().StringVar(&config.MessageTemplate, "message-template", defaultMessageTemplate, "Go text/template used to render notification messages")
+	rootCmd.Flags().StringVar(&config.MarkdownTemplate, "markdown-template", defaultMarkdownTemplate, "Go text/template used to render messages for targets that support markdown, such as Slack")
+	rootCmd.Flags().StringSliceVar(&config.Notify, "notify", nil, "Send notifications only to these targets, each set up with its own options (comma separated: "+strings.Join(targetNames(), ", ")+")")
+	rootCmd.Flags().BoolVar(&config.Desktop, "desktop", false, "Show a desktop notification (uses notify-send)")
+	rootCmd.Flags().StringVar(&config.CommandOn, "command-on", "", "Statuses and events to run --command for: all statuses, or a comma separated list such as arrived,delayed,failure (default: arrived)")
+	rootCmd.Flags().StringVar(&config.ExecOn, "exec-on", "", "Statuses and events to run --exec for (see --command-on)")
+	rootCmd.Flags().StringVar(&config.DesktopOn, "desktop-on", "", "Statuses and events to show desktop notifications for (see --command-on)")
+	rootCmd.Flags().StringVar(&config.SlackOn, "slack-on", "", "Statuses and events to post to Slack (see --command-on)")
+	rootCmd.Flags().StringVar(&config.SlackWebhook, "slack-webhook", "", "Post notifications to this Slack incoming webhook URL")
+	rootCmd.Flags().StringVar(&config.EmailOn, "email-on", "", "Statuses and events to send email for (see --command-on)")
+	rootCmd.Flags().StringVar(&config.EmailTo, "email-to", "", "Send notifications by email to these addresses (comma separated; requires --smtp-server)")
+	rootCmd.Flags().StringVar(&config.EmailFrom, "email-from", "", "Sender address for email notifications (default is the first --email-to address)")
+	rootCmd.Flags().BoolVar(&config.EmailHTML, "email-html", false, "Send email notifications with a styled HTML version of the message")
+	rootCmd.Flags().StringVar(&config.SMTPServer, "smtp-server", "", "SMTP server (host:port) used to send email notifications")
+	rootCmd.Flags().StringVar(&config.SMSOn, "sms-on", "", "Statuses and events to send text messages for (see --command-on)")
+	rootCmd.Flags().StringVar(&config.SMSTo, "sms-to", "", "Send notifications by SMS to these phone numbers (comma separated; requires --twilio-sid and --twilio-from)")
+	rootCmd.Flags().StringVar(&config.TwilioSID, "twilio-sid", "", "Twilio account SID used to send text messages")
+	rootCmd.Flags().StringVar(&config.TwilioToken, "twilio-token", "", "Twilio auth token (default: from keyring or RELISH_TWILIO_TOKEN)")
+	rootCmd.Flags().StringVar(&config.TwilioFrom, "twilio-from", "", "Twilio phone number that text messages are sent from")
+	rootCmd.Flags().StringVar(&config.SMTPUsername, "smtp-username", "", "Username for the SMTP server; the password comes from the keyring (SMTP_PASSWORD) or RELISH_SMTP_PASSWORD")
+	rootCmd.Flags().BoolVar(&config.KeepOpen, "keep-open", false, "Leave the browser open after the run completes (requires --headless=false)")
+	rootCmd.Flags().StringVar(&config.StateFile, "state-file", defaultStatePath(), "Path to the file used to persist state between runs (empty to disable)")
+	rootCmd.Flags().DurationVar(&config.DedupeWindow, "dedupe-window", 0, "Notify of the same status of the same order again after this long (0 to never notify of it again)")
+	rootCmd.Flags().BoolVar(&config.ForceNotify, "force-notify", false, "Send notifications even if they have already been sent, such as for testing")
+	rootCmd.Flags().DurationVar(&config.MinLoginInterval, "min-login-interval", 30*time.Second, "Minimum time between login attempts, including across restarts")
+	rootCmd.Flags().StringVarP(&config.Output, "output", "o", outputText, "Output format for check results (text or json)")
+	rootCmd.Flags().BoolVar(&config.StreamJSON, "stream-json", false, "Write the result of every check to stdout as a line of JSON, with the time of the check")
+	rootCmd.Flags().BoolVarP(&config.Quiet, "quiet", "q", false, "Don't write check results to stdout; use the exit status and notifications instead")
+	rootCmd.Flags().BoolVar(&config.DisableStealth, "no-stealth", false, "Launch a plain browser without the stealth options that hide automation")
+	rootCmd.Flags().StringVar(&config.Language, "lang", relish.DefaultLanguage, "Language the browser asks the site for; status text must match the built in statuses")
+	rootCmd.Flags().BoolVar(&config.Warmup, "warmup", false, "Visit the site's home page before logging in, like a person would")
+	rootCmd.Flags().DurationVar(&config.WarmupDelay, "warmup-delay", 3*time.Second, "How long to stay on the home page with --warmup")
+	rootCmd.Flags().BoolVar(&config.NoSandbox, "no-sandbox", false, "Disable the Chrome sandbox (needed to run as root in some containers; less secure)")
+	rootCmd.Flags().StringVar(&config.ChromeBin, "chrome-bin", "", "Path to the Chrome/Chromium binary (default: find automatically)")
+	rootCmd.Flags().IntVar(&config.WindowWidth, "window-width", 1280, "Browser window width in pixels")
+	rootCmd.Flags().IntVar(&config.WindowHeight, "window-height", 800, "Browser window height in pixels")
+	rootCmd.Flags().IntVar(&config.QuickRetries, "quick-retries", 2, "Number of quick retries when the order status is briefly missing from the page")
+	rootCmd.Flags().DurationVar(&config.QuickRetryDelay, "quick-retry-delay", 2*time.Second, "Delay before each quick retry")
+	rootCmd.Flags().DurationVar(&config.RestartBrowserEvery, "restart-browser-every", 0, "Restart the browser, and log in again, after it has been running this long (0 to never restart)")
+	rootCmd.Flags().IntVar(&config.RefreshRetries, "refresh-retries", 2, "Number of times to retry reloading the page before opening a new one")
+	rootCmd.Flags().StringVar(&config.ReadySelector, "ready-selector", "", "CSS selector for an element always on the schedule page once it has loaded, to tell a slow page from a missing order status")
+	rootCmd.Flags().StringVar(&config.EmailButtonSelector, "email-button-selector", relish.DefaultEmailButtonSelector, "Selector for the button that submits the email address when logging in")
+	rootCmd.Flags().StringVar(&config.LoginSuccessSelector, "login-success-selector", relish.DefaultLoginSuccessSelector, "Selector for an element only shown once logged in; logging in fails if none appears within --login-timeout")
+	rootCmd.Flags().StringVar(&config.PasswordButtonSelector, "password-button-selector", relish.DefaultPasswordButtonSelector, "Selector for the button that submits the password, and any two-factor code, when logging in")
+	rootCmd.Flags().StringVar(&config.OrderID, "order-id", "", "Watch the order with this ID (the schedule card's data-order-id) instead of the first one on the page")
+	rootCmd.Flags().StringSliceVar(&config.StatusSelectors, "status-selector", []string{relish.DefaultStatusSelector}, "Comma separated list of selectors for the order status, tried in order")
+	rootCmd.Flags().StringVar(&config.RemoteURL, "remote-url", "", "Connect to an already running browser at this DevTools URL instead of launching one")
+	rootCmd.Flags().StringVar(&config.SessionCookie, "session-cookie", "", "Log in with the cookies of a logged in browser (Cookie header form) instead of a username and password (default: from keyring or RELISH_SESSION_COOKIE if there is no username)")
+	rootCmd.Flags().StringVar(&config.TOTPSecret, "totp-secret", "", "Base32 secret used to generate two-factor authentication codes (default: from keyring or RELISH_TOTP_SECRET)")
+	rootCmd.Flags().BoolVar(&config.TUI, "tui", false, "Show the order status in the terminal instead of log messages")
+	rootCmd.Flags().BoolVar(&config.NoColor, "no-color", false, "Don't color log levels, which are colored by default on a terminal unless NO_COLOR is set")
+	rootCmd.Flags().BoolVar(&config.PrintConfig, "print-config", false, "Print the configuration, after applying all flags, as JSON and exit")
+	rootCmd.Flags().StringVar(&config.PIDFile, "pidfile", "", "Write the process ID to this file, and remove it on exit")
+	rootCmd.Flags().StringVar(&config.Serve, "serve", "", "Serve a live status page on this address (e.g. localhost:8080)")
+	rootCmd.Flags().StringVar(&config.StatsdAddr, "statsd-addr", "", "Send check counts, failures, and durations to the StatsD server at this address (host:port)")
+	rootCmd.Flags().StringVar(&config.TimeZone, "tz", "", "IANA time zone (e.g. America/New_York) for ETAs and timestamps (default is the local time zone)")
+	rootCmd.Flags().StringVar(&config.SnapshotDir, "snapshot-html", "", "Save the page HTML to a timestamped file in this directory whenever a check fails or finds an unknown status")
+	rootCmd.Flags().StringVar(&config.RecordDir, "record-dir", "", "Record every check, with a screenshot, the page HTML, and the status found, to a numbered directory under this one")
+	rootCmd.Flags().StringVar(&config.ErrorBundleDir, "error-bundle-dir", "", "If the run fails, write a zip file to attach to a bug report, with recent logs, the page, and the configuration without secrets, to this directory")
+	rootCmd.Flags().StringVar(&config.ICalFile, "ical-file", "", "Keep a calendar event for each delivery, at its ETA or when it arrived, in this iCalendar (.ics) file")
+	rootCmd.Flags().StringVar(&config.HistoryFile, "history-file", "", "Append every status observation to this file as JSON lines")
+	rootCmd.Flags().StringVar(&config.Source, "source", sourceBrowser, "Where to get the order status (browser, imap, or simulate)")
+	rootCmd.Flags().StringVar(&config.IMAP.Server, "imap-server", "", "IMAP server (host[:port]) used with --source=imap")
+	rootCmd.Flags().StringVar(&config.IMAP.Username, "imap-username", "", "IMAP username used with --source=imap")
+	rootCmd.Flags().StringVar(&config.IMAP.Mailbox, "imap-mailbox", relish.DefaultIMAPMailbox, "Mailbox searched for order emails")
+	rootCmd.Flags().StringVar(&config.IMAP.From, "imap-from", relish.DefaultIMAPFrom, "Only consider emails whose sender contains this string")
+	rootCmd.Flags().BoolVar(&config.IMAP.DisableTLS, "imap-no-tls", false, "Connect to the IMAP server without TLS (e.g. a local mail bridge)")
+	rootCmd.Flags().IntVar(&config.MaxChecks, "max-checks", 0, "Exit after this many checks if the order has not arrived (0 for no limit)")
+	rootCmd.Flags().IntVar(&config.MaxRequestsPerHour, "max-requests-per-hour", 0, "Never load pages from the site more than this many times an hour on average, whatever the interval (0 for no limit)")
+	rootCmd.Flags().IntVar(&config.ConfirmArrived, "confirm-arrived", 1, "Only treat the order as arrived once this many checks in a row have found it arrived")
+	rootCmd.Flags().StringVar(&config.OnUnknown, "on-unknown", onUnknownWarn, "What to do when a check finds an unknown order status: ignore, warn, notify, or fail")
+	rootCmd.Flags().IntVar(&config.UnknownThreshold, "unknown-threshold", 3, "Number of checks in a row that find an unknown status before --on-unknown notify or fail acts")
+	rootCmd.Flags().DurationVar(&config.WaitingNotifyEvery, "waiting-notify-every", 0, "While the order is on its way, send a low priority reminder this often with the status and time waited (0 to disable)")
+	rootCmd.Flags().IntVar(&config.NotifyOnFailure, "notify-on-failure", 0, "Notify after this many consecutive failed checks, and again when checks recover (0 to disable)")
+	rootCmd.Flags().IntVar(&config.MaxRelogins, "max-relogins", 3, "Give up after this many consecutive attempts to log in again when the session expires")
+	rootCmd.Flags().IntVar(&config.MaxBrowserRestarts, "max-browser-restarts", 3, "Give up after restarting a crashed browser this many times in one run (0 to never restart it)")
+
+	// --throttle is for maintainers reproducing problems on slow connections
+	rootCmd.Flags().StringVar(&config.ThrottleSpec, "throttle", "", "Simulate a slow network (slow-3g, fast-3g, or latency,download-kbps,upload-kbps)")
+	rootCmd.Flags().MarkHidden("throttle") //nolint:errcheck
+
+	rootCmd.PersistentFlags().StringVar(&config.ControlSocket, "control-socket", "", "Path of a unix socket for controlling a running relish-notifier")
+	rootCmd.PersistentFlags().BoolVar(&config.NoKeyring, "no-keyring", false, "Don't use the system keyring; read credentials from the environment only (also set with RELISH_NO_KEYRING=1)")
+	rootCmd.PersistentFlags().DurationVar(&config.KeyringTimeout, "keyring-timeout", defaultKeyringTimeout, "Stop waiting for the system keyring to look up a credential after this long and use the environment instead (0 to wait forever)")
+	rootCmd.PersistentFlags().StringVar(&config.KeyringService, "keyring-service", defaultKeyringService, "Keyring service under which credentials are stored")
+	rootCmd.PersistentFlags().StringVar(&config.Profile, "profile", "", "Use the credentials stored under this profile name")
+	rootCmd.Flags().StringSliceVar(&config.Profiles, "profiles", nil, "Monitor the accounts stored under these profiles at once (comma separated)")
+
+	rootCmd.MarkFlagsMutuallyExclusive("command", "exec")
+	rootCmd.MarkFlagsMutuallyExclusive("once", "until-arrived")
+	rootCmd.AddCommand(newVersionCommand())
+	rootCmd.AddCommand(newLoginCommand(&config))
+	rootCmd.AddCommand(newLogoutCommand(&config))
+	rootCmd.AddCommand(newListStatusesCommand())
+	rootCmd.AddCommand(newControlCommand(&config))
+	rootCmd.AddCommand(newDoctorCommand(&config, rootCmd))
+	rootCmd.AddCommand(newInspectCommand(&config, rootCmd))
+	rootCmd.AddCommand(newReplayCommand(&config, rootCmd))
+	rootCmd.AddCommand(newReplayHARCommand(&config, rootCmd))
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			if exitErr.err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", exitErr.err)
+			}
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-// runNotifier initializes the notifier, logs in, and runs the main monitoring loop
-func runNotifier(config *Config) error {
-	logger := setupLogger(config.Verbose)
-
-	// Get credentials
-	credentials, err := getCredentials()
+// runNotifier sets up the selected status source and runs the main monitoring loop, for
+// each of --profiles at once if it is set. Check results are written to stdout; logs go
+// to stderr.
+func runNotifier(config *Config, stdout io.Writer) error {
+	// Every timestamp we produce, including ETAs and log messages, is in this time zone
+	loc, err := loadTimeZone(config.TimeZone)
 	if err != nil {
 		return err
 	}
+	config.Location = loc
 
-	// Create notifier
-	notifier := NewNotifier(config, credentials, logger)
-	defer notifier.Close()
+	if err := validateRun(config); err != nil {
+		return err
+	}
+
+	if config.Quiet {
+		stdout = io.Discard
+	}
+
+	if config.PIDFile != "" {
+		remove, err := writePIDFile(config.PIDFile)
+		if err != nil {
+			return err
+		}
+		// SIGINT and SIGTERM cancel the run rather than exiting, so this still happens then
+		defer remove()
+	}
+
+	if len(config.Profiles) > 0 {
+		return runProfiles(config, stdout, config.logger())
+	}
+	return runProfile(config, stdout, config.logger())
+}
+
+// validateRun checks the options for a run for problems, and parses --throttle
+func validateRun(config *Config) error {
+	if err := validateOutput(config.Output); err != nil {
+		return err
+	}
+
+	if err := validateSource(config.Source); err != nil {
+		return err
+	}
+
+	if config.ConfirmArrived < 1 {
+		return fmt.Errorf("--confirm-arrived must be at least 1")
+	}
 
-	// Initialize browser
-	if err := notifier.initializeBrowser(); err != nil {
+	if err := validateOnUnknown(config.OnUnknown); err != nil {
 		return err
 	}
 
+	if config.UnknownThreshold < 1 {
+		return fmt.Errorf("--unknown-threshold must be at least 1")
+	}
+
+	if config.StreamJSON && (config.Once || config.UntilArrived) {
+		return fmt.Errorf("--stream-json cannot be used with --once or --until-arrived")
+	}
+
+	if config.ContinueAfterArrival && (config.Once || config.UntilArrived) {
+		return fmt.Errorf("--continue-after-arrival cannot be used with --once or --until-arrived")
+	}
+
+	if config.ThrottleSpec != "" {
+		throttle, err := relish.ParseThrottle(config.ThrottleSpec)
+		if err != nil {
+			return err
+		}
+		config.Throttle = throttle
+	}
+
+	if err := validateProfiles(config); err != nil {
+		return err
+	}
+
+	return config.Validate()
+}
+
+// runProfile runs the main monitoring loop for a single account, logging to logger
+func runProfile(config *Config, stdout io.Writer, logger *slog.Logger) error {
+	loc := config.zone()
+
+	// The display replaces log output, so set it up before anything logs
+	var display *statusDisplay
+	if config.TUI {
+		if isTerminal(os.Stderr) {
+			display = newStatusDisplay(os.Stderr, config.intervalAt, loc)
+			logger = slog.New(display.Handler())
+		} else {
+			logger.Warn("--tui requires a terminal, logging instead")
+		}
+	}
+
+	// An error bundle includes recent logs, whether or not they were shown
+	var ring *logRing
+	if config.ErrorBundleDir != "" {
+		ring = newLogRing(errorBundleLines)
+		logger = slog.New(ring.Handler(logger.Handler(), logHandlerOptions(config.Verbose, loc)))
+	}
+
+	// Parse the message templates before doing anything expensive
+	notifications, err := newDispatcher(config, logger)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadState(config.StateFile)
+	if err != nil {
+		return err
+	}
+	// Simulated orders all look alike, and trying out notifications should always send them
+	if config.Source != sourceSimulate {
+		notifications.dedupe = &notificationDedupe{
+			state:  state,
+			path:   config.StateFile,
+			window: config.DedupeWindow,
+			force:  config.ForceNotify,
+			logger: logger,
+		}
+	}
+
+	var cal *calendar
+	if config.ICalFile != "" {
+		cal = &calendar{path: config.ICalFile}
+	}
+
+	var hist *history
+	if config.HistoryFile != "" {
+		hist, err = openHistory(config.HistoryFile)
+		if err != nil {
+			return err
+		}
+		defer hist.Close() //nolint:errcheck
+	}
+
 	// Set up signal handling for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -332,52 +788,212 @@ func runNotifier(config *Config) error {
 		cancel()
 	}()
 
-	// Login
-	if err := notifier.Login(); err != nil {
-		return fmt.Errorf("failed to login: %w", err)
+	if display != nil {
+		go display.run(ctx)
+		defer display.stop()
 	}
 
-	// Main monitoring loop
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+	var events *broker
+	if config.Serve != "" {
+		events = newBroker()
+		stop, err := startServer(config.Serve, events, logger)
+		if err != nil {
+			return err
 		}
+		defer stop()
+	}
 
-		status, err := notifier.CheckOrderStatus()
+	metrics, err := newMetrics(config, logger)
+	if err != nil {
+		return err
+	}
+	defer metrics.Close() //nolint:errcheck
+
+	// orders remembers the order seen by the previous successful check
+	orders := &orderTracker{continuing: config.ContinueAfterArrival}
+	failures := &failureTracker{threshold: config.NotifyOnFailure}
+	waiting := &waitingTracker{every: config.WaitingNotifyEvery}
+	summary := newRunSummary(config.now())
+
+	// checkNow cuts the wait between checks short, on request from SIGUSR1 or the control socket
+	checkNow := make(chan struct{}, 1)
+
+	var control *controller
+	if config.ControlSocket != "" {
+		control = newController(checkNow, func(ctx context.Context, info relish.OrderInfo) error {
+			data := newMessageData(info, config.now())
+			data.Event = eventTest
+			notifications.announce(ctx, data, "relish-notifier: this is a test notification")
+			return nil
+		}, logger)
+		stop, err := startControlSocket(ctx, config.ControlSocket, control)
 		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	// The handlers take care of logging and notification for every check
+	handlers := checkHandlers{
+		onStatus: func(info relish.OrderInfo, unconfirmed bool, unknowns int) {
+			logger.Info("notifier reports status", "status", info.Status, "eta", info.ETA)
+			now := config.now()
+			summary.checked(info, nil, now)
+
+			if failures.succeeded() {
+				data := newMessageData(info, now)
+				data.Event = eventRecovery
+				notifications.announce(ctx, data, fmt.Sprintf("relish-notifier: checks are working again (order status: %s)", info.Status))
+			}
+
+			if info.Status == relish.OrderStatusUnknown {
+				// monitor counts the unknown statuses in a row; notify only as the count
+				// reaches the threshold, not for every one after
+				if unknowns == config.UnknownThreshold && config.OnUnknown == onUnknownNotify {
+					data := newMessageData(info, now)
+					data.Event = eventUnknown
+					notifications.announce(ctx, data, fmt.Sprintf("relish-notifier: the last %d checks found an unknown order status", unknowns))
+				}
+				if config.OnUnknown != onUnknownIgnore {
+					logger.Warn("order status is unknown", "consecutive", unknowns)
+				}
+			}
+
+			waiting.checked(now)
+
+			// monitor keeps checking until the arrival is confirmed, so there's nothing to
+			// show or send yet. orders stays as it was, so that the confirmed arrival
+			// is still a change.
+			if unconfirmed {
+				return
+			}
+
+			if display != nil {
+				display.update(info, now)
+				// Keep the final message printed below from being drawn over
+				if info.Status.IsFinal() && !config.ContinueAfterArrival {
+					display.stop()
+				}
+			}
+
+			if hist != nil {
+				if err := hist.record(info, now); err != nil {
+					logger.Error("failed to record history", "error", err)
+				}
+			}
+
+			if cal != nil {
+				if err := cal.record(info, now); err != nil {
+					logger.Error("failed to update calendar", "error", err)
+				}
+			}
+
+			if events != nil {
+				events.publish(info, nil)
+			}
+
+			if control != nil {
+				control.record(newCheckResult(info, notifications.render(formatPlain, newMessageData(info, now)), nil))
+			}
+
+			previous := orders.previous(info)
+			if notifications.wants(previous, info.Status) {
+				notify(ctx, config, stdout, notifications, previous, info, logger)
+			} else if !info.Status.IsFinal() && waiting.due(now) {
+				data := newMessageData(info, now)
+				data.Event = eventWaiting
+				notifications.announce(ctx, data, waiting.message(info.Status, now))
+			}
+			orders.record(info)
+		},
+		onError: func(err error) {
 			logger.Error("failed to check order status", "error", err)
-		} else {
-			logger.Info("notifier reports status", "status", status)
-
-			if status == OrderStatusArrived {
-				fmt.Println("order has arrived")
-				if config.Command != "" {
-					cmd := exec.Command("sh", "-c", config.Command)
-					if err := cmd.Run(); err != nil {
-						logger.Error("failed to run command", "error", err)
-					}
+			now := config.now()
+			summary.checked(relish.OrderInfo{Status: relish.OrderStatusUnknown}, err, now)
+			waiting.checked(now)
+			orders.failed(err)
+
+			if config.NotifyCommandOnError != "" {
+				if err := runErrorCommand(ctx, config, err); err != nil {
+					logger.Error("failed to run error command", "error", err)
 				}
-				return nil
 			}
-		}
 
-		if config.Once {
-			fmt.Println("order has not arrived")
-			os.Exit(1)
-		}
+			if failures.failed() {
+				data := newMessageData(relish.OrderInfo{Status: relish.OrderStatusUnknown}, now)
+				data.Event = eventFailure
+				notifications.announce(ctx, data, fmt.Sprintf("relish-notifier: the last %d checks have failed: %v", failures.failures, err))
+			}
 
-		logger.Info("Checking again", "interval_seconds", config.Interval)
+			if events != nil {
+				events.publish(relish.OrderInfo{Status: relish.OrderStatusUnknown}, err)
+			}
 
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-time.After(time.Duration(config.Interval) * time.Second):
+			if control != nil {
+				control.record(newCheckResult(relish.OrderInfo{Status: relish.OrderStatusUnknown}, "", err))
+			}
+		},
+	}
+
+	// finish writes the summary of the run, once the display, which would draw over it, has
+	// stopped
+	finish := func(err error) {
+		if display != nil {
+			display.stop()
 		}
+		writeSummary(ctx, os.Stderr, config.Profile, summary, err)
+	}
 
-		if err := notifier.Refresh(); err != nil {
-			logger.Error("failed to refresh page", "error", err)
+	source, cleanup, err := openSource(ctx, config, state, logger)
+	if err != nil {
+		if ctx.Err() == nil {
+			writeErrorBundle(ctx, err, config, ring, nil, logger)
 		}
+		// A run that can't log in ends before the first check, but still gets a summary
+		finish(err)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, relish.ErrInvalidCredentials) {
+			return invalidCredentialsError(config.Profile, err)
+		}
+		return err
 	}
+	defer cleanup()
+
+	// SIGHUP asks a long running process to pick up changed credentials
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	usr1 := make(chan os.Signal, 1)
+	// Notify with no signals would relay every signal
+	if len(checkNowSignals) > 0 {
+		signal.Notify(usr1, checkNowSignals...)
+		defer signal.Stop(usr1)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-usr1:
+				requestCheck(checkNow)
+			}
+		}
+	}()
+
+	err = monitor(ctx, source, monitorOptions{
+		config:   config,
+		stdout:   stdout,
+		metrics:  metrics,
+		handlers: handlers,
+		reload:   reload,
+		checkNow: checkNow,
+		logger:   logger,
+	})
+	writeErrorBundle(ctx, err, config, ring, source, logger)
+	finish(err)
+	return err
 }
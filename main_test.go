@@ -19,57 +19,44 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
-)
-
-var _ = Describe("OrderStatus", func() {
-	Describe("String method", func() {
-		DescribeTable("should return correct string representation",
-			func(status OrderStatus, expected string) {
-				Expect(status.String()).To(Equal(expected))
-			},
-			Entry("Order Placed", OrderStatusPlaced, "Order Placed"),
-			Entry("Preparing Your Order", OrderStatusPreparing, "Preparing Your Order"),
-			Entry("Order Arrived", OrderStatusArrived, "Order Arrived"),
-			Entry("Unknown", OrderStatusUnknown, "Unknown"),
-		)
-	})
-
-	Describe("textToStatus function", func() {
-		Context("with valid status strings", func() {
-			DescribeTable("should return correct OrderStatus",
-				func(text string, expected OrderStatus) {
-					Expect(textToStatus(text)).To(Equal(expected))
-				},
-				Entry("Order Placed", "Order Placed", OrderStatusPlaced),
-				Entry("Preparing Your Order", "Preparing Your Order", OrderStatusPreparing),
-				Entry("Order Arrived", "Order Arrived", OrderStatusArrived),
-			)
-		})
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
 
-		Context("with invalid status strings", func() {
-			DescribeTable("should return OrderStatusUnknown",
-				func(text string) {
-					Expect(textToStatus(text)).To(Equal(OrderStatusUnknown))
-				},
-				Entry("invalid status", "Invalid Status"),
-				Entry("empty string", ""),
-				Entry("case sensitive - lowercase", "order placed"),
-				Entry("whitespace around", " Order Placed "),
-				Entry("partial match", "Order"),
-				Entry("extra text", "Order Placed - Confirmed"),
-			)
-		})
-	})
-})
+	"relish-notifier/relish"
+)
 
 var _ = Describe("Logger Setup", func() {
 	Describe("setupLogger function", func() {
@@ -131,56 +118,44 @@ var _ = Describe("Logger Setup", func() {
 	})
 })
 
-var _ = Describe("Notifier", func() {
-	var (
-		config      *Config
-		credentials *Credentials
-		logger      *slog.Logger
-	)
-
-	BeforeEach(func() {
-		config = &Config{
-			Headless:    true,
-			Extensions:  false,
-			Interval:    60,
-			Once:        true,
-			PageTimeout: 30 * time.Second,
-			Command:     "echo test",
-			Verbose:     2, // -vv for debug level
-		}
-
-		credentials = &Credentials{
-			Username: "test@example.com",
-			Password: "testpassword",
-		}
-
-		logger = setupLogger(2) // -vv for debug level
+var _ = Describe("Colored Logs", func() {
+	It("should color the level of info, warning, and error messages", func() {
+		var buffer bytes.Buffer
+		logger := slog.New(newColorHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		logger.Debug("debugging", "level", "custom")
+		logger.Info("checking")
+		logger.With("check", 2).WithGroup("order").Warn("slow", "status", "Order Placed")
+		logger.Error("failed")
+
+		lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(lines[0]).To(ContainSubstring("level=DEBUG msg=debugging level=custom"))
+		Expect(lines[0]).NotTo(ContainSubstring("\x1b["))
+		Expect(lines[1]).To(ContainSubstring("level=" + ansiGreen + "INFO" + ansiReset + " msg=checking"))
+		Expect(lines[2]).To(ContainSubstring("level=" + ansiYellow + "WARN" + ansiReset + " msg=slow check=2 order.status=\"Order Placed\""))
+		Expect(lines[3]).To(ContainSubstring("level=" + ansiRed + "ERROR" + ansiReset + " msg=failed"))
 	})
 
-	Describe("NewNotifier constructor", func() {
-		It("should create a new notifier with correct configuration", func() {
-			notifier := NewNotifier(config, credentials, logger)
-
-			Expect(notifier).NotTo(BeNil())
-			Expect(notifier.config).To(Equal(config))
-			Expect(notifier.credentials).To(Equal(credentials))
-			Expect(notifier.logger).To(Equal(logger))
-			Expect(notifier.loginUrl).To(Equal(defaultLoginURL))
-		})
+	It("should only color output to a terminal", func() {
+		GinkgoT().Setenv("NO_COLOR", "")
+		file, err := os.Create(filepath.Join(GinkgoT().TempDir(), "log"))
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close() //nolint:errcheck
 
-		It("should initialize with nil browser and page", func() {
-			notifier := NewNotifier(config, credentials, logger)
+		Expect(useColor(false, file)).To(BeFalse())
+	})
 
-			Expect(notifier.browser).To(BeNil())
-			Expect(notifier.page).To(BeNil())
-		})
+	It("should not color with --no-color or NO_COLOR", func() {
+		if !isTerminal(os.Stderr) {
+			Skip("standard error is not a terminal")
+		}
+		GinkgoT().Setenv("NO_COLOR", "")
+		Expect(useColor(false, os.Stderr)).To(BeTrue())
+		Expect(useColor(true, os.Stderr)).To(BeFalse())
 
-		It("should handle nil inputs gracefully", func() {
-			// While not recommended, the constructor should not panic
-			Expect(func() {
-				NewNotifier(nil, nil, nil)
-			}).NotTo(Panic())
-		})
+		GinkgoT().Setenv("NO_COLOR", "1")
+		Expect(useColor(false, os.Stderr)).To(BeFalse())
 	})
 })
 
@@ -191,7 +166,7 @@ var _ = Describe("Configuration", func() {
 
 			Expect(config.Headless).To(BeFalse())
 			Expect(config.Extensions).To(BeFalse())
-			Expect(config.Interval).To(Equal(0))
+			Expect(config.Interval).To(Equal(time.Duration(0)))
 			Expect(config.Once).To(BeFalse())
 			Expect(config.PageTimeout).To(Equal(time.Duration(0)))
 			Expect(config.Command).To(Equal(""))
@@ -199,41 +174,6 @@ var _ = Describe("Configuration", func() {
 		})
 	})
 
-	Describe("Headless flag behavior", func() {
-		It("should correctly handle headless configuration", func() {
-			// Test that headless setting is properly passed to launcher
-			config := &Config{Headless: true}
-			logger := setupLogger(2) // -vv for debug level
-			notifier := NewNotifier(config, &Credentials{}, logger)
-
-			Expect(notifier.config.Headless).To(BeTrue())
-
-			// Test non-headless
-			config.Headless = false
-			notifier2 := NewNotifier(config, &Credentials{}, logger)
-
-			Expect(notifier2.config.Headless).To(BeFalse())
-		})
-	})
-
-	Describe("Credentials struct", func() {
-		It("should store username and password correctly", func() {
-			creds := &Credentials{
-				Username: "user@example.com",
-				Password: "secret123",
-			}
-
-			Expect(creds.Username).To(Equal("user@example.com"))
-			Expect(creds.Password).To(Equal("secret123"))
-		})
-
-		It("should handle empty credentials", func() {
-			creds := &Credentials{}
-
-			Expect(creds.Username).To(Equal(""))
-			Expect(creds.Password).To(Equal(""))
-		})
-	})
 })
 
 var _ = Describe("Application Integration", func() {
@@ -284,57 +224,52 @@ var _ = Describe("Application Integration", func() {
 			Expect(outputStr).To(ContainSubstring("error message"))
 		})
 	})
-})
-
-var _ = Describe("Performance", func() {
-	It("should have fast textToStatus performance", func() {
-		testCases := []string{
-			"Order Placed",
-			"Preparing Your Order",
-			"Order Arrived",
-			"Invalid Status",
-		}
-
-		// Warm up
-		for i := 0; i < 100; i++ {
-			testCase := testCases[i%len(testCases)]
-			_ = textToStatus(testCase)
-		}
 
-		// Actual performance test
-		start := time.Now()
-		for i := 0; i < 1000; i++ {
-			testCase := testCases[i%len(testCases)]
-			_ = textToStatus(testCase)
-		}
-		duration := time.Since(start)
+	Describe("runNotifier function", func() {
+		It("should write the results to the given writer", func() {
+			config := &Config{
+				Source:           sourceSimulate,
+				Interval:         time.Millisecond,
+				Output:           outputText,
+				MessageTemplate:  "{{ .Status }}",
+				MarkdownTemplate: defaultMarkdownTemplate,
+				ConfirmArrived:   1,
+				OnUnknown:        onUnknownWarn,
+				UnknownThreshold: 3,
+			}
 
-		Expect(duration.Nanoseconds()).To(BeNumerically("<", 1000000)) // Less than 1ms for 1000 operations
-	})
+			var stdout bytes.Buffer
+			Expect(runNotifier(config, &stdout)).To(Succeed())
+			Expect(stdout.String()).To(Equal("Driver Assigned\nOut for Delivery\nOrder Arrived\n"))
+		})
 
-	It("should have fast OrderStatus String performance", func() {
-		statuses := []OrderStatus{
-			OrderStatusPlaced,
-			OrderStatusPreparing,
-			OrderStatusArrived,
-			OrderStatusUnknown,
-		}
+		It("should write nothing with --quiet", func() {
+			config := &Config{
+				Source:           sourceSimulate,
+				Interval:         time.Millisecond,
+				Output:           outputText,
+				Quiet:            true,
+				MessageTemplate:  "{{ .Status }}",
+				MarkdownTemplate: defaultMarkdownTemplate,
+				ConfirmArrived:   1,
+				OnUnknown:        onUnknownWarn,
+				UnknownThreshold: 3,
+			}
 
-		// Warm up
-		for i := 0; i < 100; i++ {
-			status := statuses[i%len(statuses)]
-			_ = status.String()
-		}
+			var stdout bytes.Buffer
+			Expect(runNotifier(config, &stdout)).To(Succeed())
+			Expect(stdout.String()).To(BeEmpty())
+		})
 
-		// Actual performance test
-		start := time.Now()
-		for i := 0; i < 1000; i++ {
-			status := statuses[i%len(statuses)]
-			_ = status.String()
-		}
-		duration := time.Since(start)
+		It("should reject --stream-json with --once", func() {
+			config := &Config{Source: sourceSimulate, Output: outputText, ConfirmArrived: 1, OnUnknown: onUnknownWarn, UnknownThreshold: 3, StreamJSON: true, Once: true}
+			Expect(runNotifier(config, io.Discard)).To(MatchError(ContainSubstring("--stream-json cannot be used")))
+		})
 
-		Expect(duration.Nanoseconds()).To(BeNumerically("<", 500000)) // Less than 0.5ms for 1000 operations
+		It("should reject --continue-after-arrival with --until-arrived", func() {
+			config := &Config{Source: sourceSimulate, Output: outputText, ConfirmArrived: 1, OnUnknown: onUnknownWarn, UnknownThreshold: 3, ContinueAfterArrival: true, UntilArrived: true}
+			Expect(runNotifier(config, io.Discard)).To(MatchError(ContainSubstring("--continue-after-arrival cannot be used")))
+		})
 	})
 })
 
@@ -375,7 +310,7 @@ var _ = Describe("Credentials Management", func() {
 			It("should return credentials from environment when keyring fails", func() {
 				// This test assumes keyring will fail for non-existent service
 				// If keyring succeeds, that's also fine - we're testing fallback behavior
-				creds, err := getCredentials()
+				creds, err := getCredentials(&Config{})
 
 				Expect(err).NotTo(HaveOccurred())
 				Expect(creds).NotTo(BeNil())
@@ -401,7 +336,7 @@ var _ = Describe("Credentials Management", func() {
 				// This test might pass or fail depending on system keyring state
 				// If keyring has valid credentials, the function will succeed
 				// If keyring fails and no env vars, it should fail with our message
-				creds, err := getCredentials()
+				creds, err := getCredentials(&Config{})
 
 				if err != nil {
 					// If it fails, should mention keyring failure and RELISH_USERNAME
@@ -424,7 +359,7 @@ var _ = Describe("Credentials Management", func() {
 				os.Unsetenv("RELISH_PASSWORD")                          //nolint:errcheck
 
 				// This test behavior depends on keyring state
-				creds, err := getCredentials()
+				creds, err := getCredentials(&Config{})
 
 				if err != nil {
 					// Should mention password is missing
@@ -440,7 +375,7 @@ var _ = Describe("Credentials Management", func() {
 				os.Setenv("RELISH_PASSWORD", "partialpassword") //nolint:errcheck
 
 				// This test behavior depends on keyring state
-				creds, err := getCredentials()
+				creds, err := getCredentials(&Config{})
 
 				if err != nil {
 					// Should mention username is missing
@@ -455,24 +390,6 @@ var _ = Describe("Credentials Management", func() {
 })
 
 var _ = Describe("Edge Cases and Error Handling", func() {
-	Describe("textToStatus with edge cases", func() {
-		It("should handle Unicode characters", func() {
-			result := textToStatus("Order Placed 🚚")
-			Expect(result).To(Equal(OrderStatusUnknown))
-		})
-
-		It("should handle very long strings", func() {
-			longString := strings.Repeat("Order Placed", 1000)
-			result := textToStatus(longString)
-			Expect(result).To(Equal(OrderStatusUnknown))
-		})
-
-		It("should handle strings with control characters", func() {
-			result := textToStatus("Order\nPlaced")
-			Expect(result).To(Equal(OrderStatusUnknown))
-		})
-	})
-
 	Describe("setupLogger edge cases", func() {
 		It("should handle very high verbose counts", func() {
 			logger := setupLogger(999)
@@ -490,20 +407,3161 @@ var _ = Describe("Edge Cases and Error Handling", func() {
 		})
 	})
 
-	Describe("NewNotifier edge cases", func() {
-		It("should work with extreme timeout values", func() {
-			config := &Config{
-				PageTimeout: time.Hour * 24, // 24 hours
+})
+
+var _ = Describe("Message Templates", func() {
+	Describe("parseMessageTemplate function", func() {
+		It("should parse the default template", func() {
+			tmpl, err := parseMessageTemplate(defaultMessageTemplate)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tmpl).NotTo(BeNil())
+		})
+
+		It("should fail with a clear error on invalid templates", func() {
+			_, err := parseMessageTemplate("{{ .Status ")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to parse message template"))
+		})
+	})
+
+	Describe("renderMessage function", func() {
+		var data MessageData
+
+		BeforeEach(func() {
+			data = MessageData{
+				OrderInfo: relish.OrderInfo{Status: relish.OrderStatusArrived, ETA: "12:30 PM", Vendor: "Chipotle"},
+				Time:      time.Date(2025, 7, 1, 12, 34, 0, 0, time.UTC),
+				Hostname:  "lunchbox",
+			}
+		})
+
+		It("should render the default template", func() {
+			tmpl, err := parseMessageTemplate(defaultMessageTemplate)
+			Expect(err).NotTo(HaveOccurred())
+
+			message, err := renderMessage(tmpl, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(Equal("order from Chipotle status: Order Arrived (ETA 12:30 PM)"))
+		})
+
+		It("should omit the ETA and vendor when they are not known", func() {
+			tmpl, err := parseMessageTemplate(defaultMessageTemplate)
+			Expect(err).NotTo(HaveOccurred())
+
+			data.ETA = ""
+			data.Vendor = ""
+			message, err := renderMessage(tmpl, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(Equal("order status: Order Arrived"))
+		})
+
+		It("should describe the driver when one is known", func() {
+			tmpl, err := parseMessageTemplate(defaultMessageTemplate)
+			Expect(err).NotTo(HaveOccurred())
+
+			data.Status = relish.OrderStatusPreparing
+			data.Driver = "Sam"
+			message, err := renderMessage(tmpl, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(Equal("order from Chipotle status: Preparing Your Order (ETA 12:30 PM), driver Sam"))
+
+			data.DriverLocation = "2 stops away"
+			message, err = renderMessage(tmpl, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(Equal("order from Chipotle status: Preparing Your Order (ETA 12:30 PM), driver Sam is 2 stops away"))
+		})
+
+		It("should expose the vendor to templates", func() {
+			tmpl, err := parseMessageTemplate("Your order from {{ .Vendor }} has arrived")
+			Expect(err).NotTo(HaveOccurred())
+
+			message, err := renderMessage(tmpl, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(Equal("Your order from Chipotle has arrived"))
+		})
+
+		It("should expose time and hostname to templates", func() {
+			tmpl, err := parseMessageTemplate(`{{ .Hostname }} {{ .Time.Format "15:04" }}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			message, err := renderMessage(tmpl, data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(Equal("lunchbox 12:34"))
+		})
+
+		It("should return an error when a field does not exist", func() {
+			tmpl, err := parseMessageTemplate("{{ .Nope }}")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = renderMessage(tmpl, data)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("messageEnv function", func() {
+		It("should describe the notification in environment variables", func() {
+			data := MessageData{OrderInfo: relish.OrderInfo{Status: relish.OrderStatusArrived}}
+			env := messageEnv(data, "hello")
+
+			Expect(env).To(ContainElement("RELISH_MESSAGE=hello"))
+			Expect(env).To(ContainElement("RELISH_STATUS=Order Arrived"))
+			Expect(env).To(ContainElement("RELISH_ETA="))
+			Expect(env).To(ContainElement("RELISH_VENDOR="))
+			Expect(env).To(ContainElement("RELISH_DRIVER="))
+			Expect(env).To(ContainElement("RELISH_DRIVER_LOCATION="))
+		})
+	})
+
+	Describe("exec argument templates", func() {
+		It("should render one argument per template without shell interpretation", func() {
+			data := MessageData{OrderInfo: relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: `Tom's "Deli"; rm -rf ~`}}
+			tmpls, err := parseExecArgs([]string{"Relish", "{{ .Vendor }}", "{{ .Message }}"})
+			Expect(err).NotTo(HaveOccurred())
+
+			args, err := renderExecArgs(tmpls, data, "it's here")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(args).To(Equal([]string{"Relish", `Tom's "Deli"; rm -rf ~`, "it's here"}))
+		})
+
+		It("should reject invalid templates", func() {
+			_, err := parseExecArgs([]string{"{{ .Status"})
+			Expect(err).To(MatchError(ContainSubstring("failed to parse exec argument")))
+		})
+	})
+})
+
+var _ = Describe("Exit Codes", func() {
+	Describe("exitCodeError", func() {
+		It("should be recognized through wrapping", func() {
+			err := fmt.Errorf("check failed: %w", exitCodeError{code: 3})
+
+			var exitErr exitCodeError
+			Expect(errors.As(err, &exitErr)).To(BeTrue())
+			Expect(exitErr.code).To(Equal(3))
+			Expect(exitErr.Error()).To(Equal("exit status 3"))
+		})
+
+		It("should explain how to fix rejected credentials", func() {
+			err := invalidCredentialsError("work", fmt.Errorf("failed to login: %w", relish.ErrInvalidCredentials))
+
+			var exitErr exitCodeError
+			Expect(errors.As(err, &exitErr)).To(BeTrue())
+			Expect(exitErr.code).To(Equal(exitInvalidCredentials))
+			Expect(err).To(MatchError(relish.ErrInvalidCredentials))
+			Expect(err.Error()).To(ContainSubstring(`run "relish-notifier login --profile work"`))
+		})
+	})
+})
+
+var _ = Describe("Run Summary", func() {
+	It("should count checks and record each change of status", func() {
+		start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		summary := newRunSummary(start)
+
+		summary.checked(relish.OrderInfo{Status: relish.OrderStatusPlaced}, nil, start)
+		summary.checked(relish.OrderInfo{Status: relish.OrderStatusPlaced}, nil, start.Add(time.Minute))
+		summary.checked(relish.OrderInfo{Status: relish.OrderStatusUnknown}, errors.New("timeout"), start.Add(2*time.Minute))
+		summary.checked(relish.OrderInfo{Status: relish.OrderStatusArrived}, nil, start.Add(3*time.Minute))
+
+		Expect(summary.attrs("order arrived", start.Add(3*time.Minute))).To(Equal([]any{
+			"checks", 4,
+			"failed_checks", 1,
+			"duration", 3 * time.Minute,
+			"progression", "12:00:00 Order Placed -> 12:03:00 Order Arrived",
+			"exit_reason", "order arrived",
+		}))
+	})
+
+	DescribeTable("exitReason function",
+		func(cancelled bool, err error, expected string) {
+			ctx, cancel := context.WithCancel(context.Background())
+			if cancelled {
+				cancel()
+			} else {
+				defer cancel()
 			}
+			Expect(exitReason(ctx, err)).To(Equal(expected))
+		},
+		Entry("arrived", false, nil, "order arrived"),
+		Entry("interrupted", true, nil, "interrupted"),
+		Entry("cancelled", false, exitCodeError{code: 2}, "order cancelled"),
+		Entry("max checks", false, exitCodeError{code: exitMaxChecks}, "reached --max-checks"),
+		Entry("error", false, errors.New("session expired and 3 attempts to log in again failed"), "session expired and 3 attempts to log in again failed"),
+		Entry("login failed", false, errors.New("failed to login: no route to host"), "failed to login: no route to host"),
+	)
+
+	It("should write the summary as a message of its own", func() {
+		var out bytes.Buffer
+		writeSummary(context.Background(), &out, "", newRunSummary(time.Now()), errors.New("failed to login: no route to host"))
+		Expect(out.String()).To(HavePrefix(`msg="run summary" checks=0`))
+		Expect(out.String()).To(ContainSubstring(`exit_reason="failed to login: no route to host"`))
+		Expect(out.String()).NotTo(ContainSubstring("level="))
+	})
+
+	It("should say which profile the summary is for", func() {
+		var out bytes.Buffer
+		writeSummary(context.Background(), &out, "work", newRunSummary(time.Now()), nil)
+		Expect(out.String()).To(HavePrefix(`msg="run summary" profile=work checks=0`))
+	})
+})
+
+var _ = Describe("Notification Dedupe", func() {
+	var (
+		dedupe *notificationDedupe
+		now    time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+		dedupe = &notificationDedupe{state: &State{}, logger: slog.New(slog.DiscardHandler)}
+	})
+
+	DescribeTable("notificationKey function",
+		func(info relish.OrderInfo, expected string) {
+			Expect(notificationKey(info, now)).To(Equal(expected))
+		},
+		Entry("with an order ID", relish.OrderInfo{OrderID: "A100", Vendor: "Chipotle", Status: relish.OrderStatusArrived},
+			"A100/"+string(relish.OrderStatusArrived)),
+		Entry("without an order ID", relish.OrderInfo{Vendor: "Chipotle", ETA: "12:30 PM", Status: relish.OrderStatusArrived},
+			"2025-06-01/Chipotle/"+string(relish.OrderStatusArrived)),
+		Entry("with nothing to identify the order", relish.OrderInfo{ETA: "12:30 PM", Status: relish.OrderStatusArrived}, ""),
+	)
+
+	It("should recognize an order without an ID after its ETA changes", func() {
+		info := relish.OrderInfo{Vendor: "Chipotle", ETA: "12:30 PM", Status: relish.OrderStatusArrived}
+		Expect(dedupe.allow(info, now)).To(BeTrue())
+
+		info.ETA = "12:45 PM"
+		Expect(dedupe.allow(info, now.Add(time.Minute))).To(BeFalse())
+	})
+
+	It("should use the day in the --tz time zone", func() {
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		Expect(err).NotTo(HaveOccurred())
+
+		// 20:00 UTC on June 1 is already June 2 in Tokyo
+		info := relish.OrderInfo{Vendor: "Chipotle", Status: relish.OrderStatusArrived}
+		evening := time.Date(2025, 6, 1, 20, 0, 0, 0, time.UTC)
+		Expect(notificationKey(info, evening.In(tokyo))).To(Equal("2025-06-02/Chipotle/" + string(relish.OrderStatusArrived)))
+	})
+
+	It("should always allow orders with nothing to identify them", func() {
+		info := relish.OrderInfo{Status: relish.OrderStatusArrived}
+		Expect(dedupe.allow(info, now)).To(BeTrue())
+		Expect(dedupe.allow(info, now.Add(time.Hour))).To(BeTrue())
+		Expect(dedupe.state.Notified).To(BeEmpty())
+	})
+
+	It("should allow each status of an order once", func() {
+		info := relish.OrderInfo{OrderID: "A100", Status: relish.OrderStatusOutForDelivery}
+		Expect(dedupe.allow(info, now)).To(BeTrue())
+		Expect(dedupe.allow(info, now.Add(time.Hour))).To(BeFalse())
+
+		info.Status = relish.OrderStatusArrived
+		Expect(dedupe.allow(info, now)).To(BeTrue())
+
+		info.OrderID = "B200"
+		Expect(dedupe.allow(info, now)).To(BeTrue())
+	})
+
+	It("should allow a status again after the window", func() {
+		dedupe.window = time.Hour
+		info := relish.OrderInfo{OrderID: "A100", Status: relish.OrderStatusOutForDelivery}
+
+		Expect(dedupe.allow(info, now)).To(BeTrue())
+		Expect(dedupe.allow(info, now.Add(59*time.Minute))).To(BeFalse())
+		Expect(dedupe.allow(info, now.Add(2*time.Hour))).To(BeTrue())
+	})
+
+	It("should forget old notifications", func() {
+		dedupe.allow(relish.OrderInfo{OrderID: "A100", Status: relish.OrderStatusArrived}, now)
+		dedupe.allow(relish.OrderInfo{OrderID: "B200", Status: relish.OrderStatusArrived}, now.Add(31*24*time.Hour))
+
+		Expect(dedupe.state.Notified).To(HaveLen(1))
+		Expect(dedupe.state.Notified).To(HaveKey("B200/" + string(relish.OrderStatusArrived)))
+	})
+})
+
+var _ = Describe("State", func() {
+	Describe("loadState function", func() {
+		It("should return an empty state when the path is empty", func() {
+			state, err := loadState("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.LastLoginAttempt.IsZero()).To(BeTrue())
+		})
+
+		It("should return an empty state when the file does not exist", func() {
+			state, err := loadState(filepath.Join(GinkgoT().TempDir(), "missing.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.LastLoginAttempt.IsZero()).To(BeTrue())
+		})
+
+		It("should report invalid state files", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "state.json")
+			Expect(os.WriteFile(path, []byte("not json"), 0o600)).To(Succeed())
+
+			_, err := loadState(path)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should round trip through save", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "nested", "state.json")
+			attempt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+			Expect((&State{LastLoginAttempt: attempt}).save(path)).To(Succeed())
+
+			state, err := loadState(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.LastLoginAttempt.Equal(attempt)).To(BeTrue())
+		})
+	})
+
+	Describe("loginDelay method", func() {
+		now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+		DescribeTable("should compute the remaining delay",
+			func(lastAttempt time.Time, interval, expected time.Duration) {
+				state := &State{LastLoginAttempt: lastAttempt}
+				Expect(state.loginDelay(interval, now)).To(Equal(expected))
+			},
+			Entry("no previous attempt", time.Time{}, time.Minute, time.Duration(0)),
+			Entry("recent attempt", now.Add(-10*time.Second), 30*time.Second, 20*time.Second),
+			Entry("old attempt", now.Add(-time.Hour), 30*time.Second, time.Duration(0)),
+			Entry("guard disabled", now, time.Duration(0), time.Duration(0)),
+		)
+	})
+})
+
+var _ = Describe("Output", func() {
+	Describe("validateOutput function", func() {
+		It("should accept known formats", func() {
+			Expect(validateOutput("text")).To(Succeed())
+			Expect(validateOutput("json")).To(Succeed())
+		})
 
-			notifier := NewNotifier(config, &Credentials{}, setupLogger(1)) // -v for info level
-			Expect(notifier).NotTo(BeNil())
-			Expect(notifier.config.PageTimeout).To(Equal(time.Hour * 24))
+		It("should reject unknown formats", func() {
+			Expect(validateOutput("yaml")).To(MatchError(ContainSubstring("invalid output format")))
+		})
+	})
+
+	Describe("writeResult function", func() {
+		var buffer *bytes.Buffer
+
+		BeforeEach(func() {
+			buffer = &bytes.Buffer{}
+		})
+
+		It("should write a JSON result when the order has not arrived", func() {
+			result := newCheckResult(relish.OrderInfo{Status: relish.OrderStatusPreparing}, "", nil)
+
+			Expect(writeResult(buffer, outputJSON, result)).To(Succeed())
+			Expect(buffer.String()).To(MatchJSON(`{"status":"Preparing Your Order","arrived":false}`))
+		})
+
+		It("should write a JSON result when the order has arrived", func() {
+			result := newCheckResult(relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Chipotle"}, "order has arrived", nil)
+
+			Expect(writeResult(buffer, outputJSON, result)).To(Succeed())
+			Expect(buffer.String()).To(MatchJSON(`{"status":"Order Arrived","vendor":"Chipotle","arrived":true,"message":"order has arrived"}`))
+		})
+
+		It("should include check errors in JSON results", func() {
+			result := newCheckResult(relish.OrderInfo{Status: relish.OrderStatusUnknown}, "", errors.New("no element"))
+
+			Expect(writeResult(buffer, outputJSON, result)).To(Succeed())
+			Expect(buffer.String()).To(MatchJSON(`{"status":"Unknown","arrived":false,"error":"no element"}`))
+		})
+
+		It("should write plain text results", func() {
+			Expect(writeResult(buffer, outputText, newCheckResult(relish.OrderInfo{Status: relish.OrderStatusPlaced}, "", nil))).To(Succeed())
+			Expect(buffer.String()).To(Equal("order has not arrived\n"))
+
+			buffer.Reset()
+			Expect(writeResult(buffer, outputText, newCheckResult(relish.OrderInfo{Status: relish.OrderStatusArrived}, "order status: Order Arrived", nil))).To(Succeed())
+			Expect(buffer.String()).To(Equal("order status: Order Arrived\n"))
+		})
+	})
+
+	Describe("printConfig function", func() {
+		It("should print the configuration with secrets redacted", func() {
+			config := Config{Interval: time.Minute, TOTPSecret: "JBSWY3DPEHPK3PXP", SessionCookie: "session=abc123", TwilioToken: "twiliotoken", Source: sourceIMAP}
+			config.PageTimeout = 10 * time.Second
+			config.IMAP.Username = "me"
+			config.IMAP.Password = "hunter2"
+
+			buffer := &bytes.Buffer{}
+			Expect(printConfig(buffer, config)).To(Succeed())
+			Expect(buffer.String()).NotTo(ContainSubstring("hunter2"))
+			Expect(buffer.String()).NotTo(ContainSubstring("JBSWY3DPEHPK3PXP"))
+			Expect(buffer.String()).NotTo(ContainSubstring("abc123"))
+			Expect(buffer.String()).NotTo(ContainSubstring("twiliotoken"))
+
+			var printed map[string]any
+			Expect(json.Unmarshal(buffer.Bytes(), &printed)).To(Succeed())
+			Expect(printed).To(HaveKeyWithValue("Interval", "1m0s"))
+			Expect(printed).To(HaveKeyWithValue("PageTimeout", "10s"))
+			Expect(printed).To(HaveKeyWithValue("Source", "imap"))
+			Expect(printed).To(HaveKeyWithValue("TOTPSecret", "[REDACTED]"))
+			Expect(printed).To(HaveKeyWithValue("SlackWebhook", ""))
+			Expect(printed).To(HaveKeyWithValue("Throttle", BeNil()))
+			Expect(printed).To(HaveKeyWithValue("IMAP", HaveKeyWithValue("Password", "[REDACTED]")))
+			Expect(printed).To(HaveKeyWithValue("IMAP", HaveKeyWithValue("Username", "me")))
+		})
+	})
+})
+
+var _ = Describe("Interval", func() {
+	Describe("resolveInterval function", func() {
+		var (
+			cmd                  *cobra.Command
+			config               *Config
+			checkIntervalSeconds int
+		)
+
+		BeforeEach(func() {
+			config = &Config{}
+			cmd = &cobra.Command{}
+			cmd.Flags().DurationVar(&config.Interval, "interval", 30*time.Second, "")
+			cmd.Flags().IntVarP(&checkIntervalSeconds, "check-interval", "i", 30, "")
+		})
+
+		It("should accept the default interval", func() {
+			Expect(cmd.ParseFlags(nil)).To(Succeed())
+			Expect(resolveInterval(cmd, config, checkIntervalSeconds)).To(Succeed())
+			Expect(config.Interval).To(Equal(30 * time.Second))
+		})
+
+		It("should accept a duration", func() {
+			Expect(cmd.ParseFlags([]string{"--interval", "2m"})).To(Succeed())
+			Expect(resolveInterval(cmd, config, checkIntervalSeconds)).To(Succeed())
+			Expect(config.Interval).To(Equal(2 * time.Minute))
 		})
 
-		It("should handle empty login URL correctly", func() {
-			notifier := NewNotifier(&Config{}, &Credentials{}, setupLogger(1)) // -v for info level
-			Expect(notifier.loginUrl).To(Equal(defaultLoginURL))
+		It("should convert the legacy seconds flag", func() {
+			Expect(cmd.ParseFlags([]string{"-i", "45"})).To(Succeed())
+			Expect(resolveInterval(cmd, config, checkIntervalSeconds)).To(Succeed())
+			Expect(config.Interval).To(Equal(45 * time.Second))
+		})
+
+		It("should reject both flags together", func() {
+			Expect(cmd.ParseFlags([]string{"--interval", "1m", "--check-interval", "60"})).To(Succeed())
+			Expect(resolveInterval(cmd, config, checkIntervalSeconds)).To(MatchError(ContainSubstring("cannot be used together")))
+		})
+
+		DescribeTable("should reject intervals below the minimum",
+			func(args ...string) {
+				Expect(cmd.ParseFlags(args)).To(Succeed())
+				Expect(resolveInterval(cmd, config, checkIntervalSeconds)).To(MatchError(ContainSubstring("too short")))
+			},
+			Entry("zero seconds", "-i", "0"),
+			Entry("negative seconds", "-i", "-10"),
+			Entry("short duration", "--interval", "1s"),
+			Entry("negative duration", "--interval", "-5s"),
+		)
+	})
+
+	Describe("interval schedule", func() {
+		at := func(clock string) time.Time {
+			t, err := time.Parse("15:04", clock)
+			Expect(err).NotTo(HaveOccurred())
+			return time.Date(2025, 6, 1, t.Hour(), t.Minute(), 0, 0, time.Local)
+		}
+
+		It("should use each window's interval during it and --interval otherwise", func() {
+			schedule, err := parseIntervalSchedule("11:45-12:30=15s, 22:00-01:00=1m")
+			Expect(err).NotTo(HaveOccurred())
+			config := &Config{Interval: 5 * time.Minute, schedule: schedule}
+
+			Expect(config.intervalAt(at("11:44"))).To(Equal(5 * time.Minute))
+			Expect(config.intervalAt(at("11:45"))).To(Equal(15 * time.Second))
+			Expect(config.intervalAt(at("12:29"))).To(Equal(15 * time.Second))
+			Expect(config.intervalAt(at("12:30"))).To(Equal(5 * time.Minute))
+			// A window can run past midnight
+			Expect(config.intervalAt(at("23:30"))).To(Equal(time.Minute))
+			Expect(config.intervalAt(at("00:30"))).To(Equal(time.Minute))
+			Expect(config.intervalAt(at("01:00"))).To(Equal(5 * time.Minute))
+		})
+
+		It("should read the windows in the --tz time zone", func() {
+			schedule, err := parseIntervalSchedule("11:45-12:30=15s")
+			Expect(err).NotTo(HaveOccurred())
+			tokyo, err := time.LoadLocation("Asia/Tokyo")
+			Expect(err).NotTo(HaveOccurred())
+			config := &Config{Interval: 5 * time.Minute, schedule: schedule}
+			config.Location = tokyo
+
+			// 03:00 UTC is 12:00 in Tokyo
+			Expect(config.intervalAt(time.Date(2025, 6, 1, 3, 0, 0, 0, time.UTC))).To(Equal(15 * time.Second))
+			Expect(config.intervalAt(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))).To(Equal(5 * time.Minute))
+		})
+
+		It("should describe how the interval was chosen", func() {
+			schedule, err := parseIntervalSchedule("22:00-01:00=1m")
+			Expect(err).NotTo(HaveOccurred())
+			config := &Config{Interval: 5 * time.Minute, schedule: schedule, MaxRequestsPerHour: 60}
+
+			Expect(config.intervalAttrs(at("23:30"))).To(Equal([]any{
+				"base_interval", 5 * time.Minute,
+				"schedule_window", "22:00-01:00",
+				"schedule_interval", time.Minute,
+				"max_requests_per_hour", 60,
+			}))
+			Expect((&Config{Interval: time.Minute}).intervalAttrs(at("23:30"))).To(Equal([]any{"base_interval", time.Minute}))
+		})
+
+		It("should use --interval without a schedule", func() {
+			Expect((&Config{Interval: time.Minute}).intervalAt(at("12:00"))).To(Equal(time.Minute))
+		})
+
+		DescribeTable("should reject invalid schedules",
+			func(spec, message string) {
+				_, err := parseIntervalSchedule(spec)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("no windows", ",", "no windows"),
+			Entry("no interval", "11:45-12:30", "expected start-end=interval"),
+			Entry("no end", "11:45=15s", "expected start-end=interval"),
+			Entry("bad time", "11:45-25:00=15s", "invalid time of day"),
+			Entry("empty window", "12:00-12:00=15s", "same time"),
+			Entry("bad interval", "11:45-12:30=soon", "invalid duration"),
+			Entry("short interval", "11:45-12:30=1s", "too short"),
+		)
+	})
+
+	Describe("quiet hours", func() {
+		var newYork *time.Location
+
+		BeforeEach(func() {
+			var err error
+			newYork, err = time.LoadLocation("America/New_York")
+			Expect(err).NotTo(HaveOccurred())
 		})
+
+		quiet := func(spec string) *Config {
+			window, err := parseQuietHours(spec)
+			Expect(err).NotTo(HaveOccurred())
+			config := &Config{quietHours: &window}
+			config.Location = newYork
+			return config
+		}
+
+		It("should pause until a window past midnight ends", func() {
+			config := quiet("22:00-07:00")
+
+			until, ok := config.quietUntil(time.Date(2025, 6, 1, 23, 30, 0, 0, newYork))
+			Expect(ok).To(BeTrue())
+			Expect(until).To(Equal(time.Date(2025, 6, 2, 7, 0, 0, 0, newYork)))
+
+			until, ok = config.quietUntil(time.Date(2025, 6, 2, 6, 59, 0, 0, newYork))
+			Expect(ok).To(BeTrue())
+			Expect(until).To(Equal(time.Date(2025, 6, 2, 7, 0, 0, 0, newYork)))
+
+			_, ok = config.quietUntil(time.Date(2025, 6, 2, 7, 0, 0, 0, newYork))
+			Expect(ok).To(BeFalse())
+			_, ok = config.quietUntil(time.Date(2025, 6, 2, 21, 59, 0, 0, newYork))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should pause until a window within a day ends", func() {
+			config := quiet("13:00-14:30")
+
+			until, ok := config.quietUntil(time.Date(2025, 6, 1, 13, 15, 0, 0, newYork))
+			Expect(ok).To(BeTrue())
+			Expect(until).To(Equal(time.Date(2025, 6, 1, 14, 30, 0, 0, newYork)))
+
+			_, ok = config.quietUntil(time.Date(2025, 6, 1, 12, 0, 0, 0, newYork))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should read the window in the --tz time zone", func() {
+			config := quiet("22:00-07:00")
+
+			// 04:00 UTC is midnight in New York in the summer
+			until, ok := config.quietUntil(time.Date(2025, 6, 2, 4, 0, 0, 0, time.UTC))
+			Expect(ok).To(BeTrue())
+			Expect(until).To(Equal(time.Date(2025, 6, 2, 7, 0, 0, 0, newYork)))
+
+			_, ok = config.quietUntil(time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should end by the clock across a change to daylight saving time", func() {
+			config := quiet("22:00-07:00")
+
+			// The night of 8 March 2025 is an hour shorter in New York
+			until, ok := config.quietUntil(time.Date(2025, 3, 8, 23, 0, 0, 0, newYork))
+			Expect(ok).To(BeTrue())
+			Expect(until).To(Equal(time.Date(2025, 3, 9, 7, 0, 0, 0, newYork)))
+			Expect(until.Sub(time.Date(2025, 3, 8, 23, 0, 0, 0, newYork))).To(Equal(7 * time.Hour))
+		})
+
+		It("should not pause without --quiet-hours", func() {
+			_, ok := (&Config{}).quietUntil(time.Now())
+			Expect(ok).To(BeFalse())
+		})
+
+		DescribeTable("should reject invalid windows",
+			func(spec, message string) {
+				_, err := parseQuietHours(spec)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("no end", "22:00", "expected start-end"),
+			Entry("bad time", "22:00-7am", "invalid time of day"),
+			Entry("empty window", "22:00-22:00", "same time"),
+		)
+	})
+})
+
+var _ = Describe("Version", func() {
+	Describe("getBuildInfo function", func() {
+		It("should report the version and Go runtime", func() {
+			info := getBuildInfo()
+
+			Expect(info.Version).To(Equal(version))
+			Expect(info.GoVersion).To(Equal(runtime.Version()))
+			Expect(info.Platform).To(Equal(runtime.GOOS + "/" + runtime.GOARCH))
+		})
+	})
+
+	Describe("writeBuildInfo function", func() {
+		var info buildInfo
+
+		BeforeEach(func() {
+			info = buildInfo{
+				Version:   "v1.2.3",
+				Commit:    "abc123",
+				BuildDate: "2025-07-01T12:00:00Z",
+				GoVersion: "go1.24.5",
+				Platform:  "linux/amd64",
+			}
+		})
+
+		It("should write text output", func() {
+			buffer := &bytes.Buffer{}
+			Expect(writeBuildInfo(buffer, info, false)).To(Succeed())
+
+			Expect(buffer.String()).To(ContainSubstring("relish-notifier v1.2.3"))
+			Expect(buffer.String()).To(ContainSubstring("commit:     abc123\n"))
+			Expect(buffer.String()).To(ContainSubstring("build date: 2025-07-01T12:00:00Z"))
+			Expect(buffer.String()).To(ContainSubstring("go version: go1.24.5"))
+		})
+
+		It("should flag modified and unknown builds", func() {
+			info.Modified = true
+			info.BuildDate = ""
+
+			buffer := &bytes.Buffer{}
+			Expect(writeBuildInfo(buffer, info, false)).To(Succeed())
+
+			Expect(buffer.String()).To(ContainSubstring("commit:     abc123 (modified)"))
+			Expect(buffer.String()).To(ContainSubstring("build date: unknown"))
+		})
+
+		It("should write JSON output", func() {
+			buffer := &bytes.Buffer{}
+			Expect(writeBuildInfo(buffer, info, true)).To(Succeed())
+
+			Expect(buffer.String()).To(MatchJSON(`{
+				"version": "v1.2.3",
+				"commit": "abc123",
+				"build_date": "2025-07-01T12:00:00Z",
+				"go_version": "go1.24.5",
+				"platform": "linux/amd64"
+			}`))
+		})
+	})
+})
+
+var _ = Describe("History", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "history.jsonl")
+	})
+
+	It("should write one JSON object per observation", func() {
+		hist, err := openHistory(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		observed := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+		Expect(hist.record(relish.OrderInfo{Status: relish.OrderStatusPlaced}, observed)).To(Succeed())
+		Expect(hist.record(relish.OrderInfo{Status: relish.OrderStatusArrived, ETA: "12:30 PM", Vendor: "Chipotle"}, observed.Add(time.Minute))).To(Succeed())
+		Expect(hist.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(MatchJSON(`{"time":"2025-07-01T12:00:00Z","status":"Order Placed"}`))
+		Expect(lines[1]).To(MatchJSON(`{"time":"2025-07-01T12:01:00Z","status":"Order Arrived","eta":"12:30 PM","eta_time":"2025-07-01T12:30:00Z","vendor":"Chipotle"}`))
+	})
+
+	It("should record the ETA in the time zone of the observation", func() {
+		hist, err := openHistory(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		loc, err := loadTimeZone("America/New_York")
+		Expect(err).NotTo(HaveOccurred())
+		observed := time.Date(2025, 7, 1, 11, 0, 0, 0, loc)
+		Expect(hist.record(relish.OrderInfo{Status: relish.OrderStatusPlaced, ETA: "12:30 PM"}, observed)).To(Succeed())
+		Expect(hist.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"time":"2025-07-01T11:00:00-04:00","status":"Order Placed","eta":"12:30 PM","eta_time":"2025-07-01T12:30:00-04:00"}`))
+	})
+
+	It("should append to an existing history file", func() {
+		Expect(os.WriteFile(path, []byte("{\"status\":\"Order Placed\"}\n"), 0o600)).To(Succeed())
+
+		hist, err := openHistory(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hist.record(relish.OrderInfo{Status: relish.OrderStatusPreparing}, time.Now())).To(Succeed())
+		Expect(hist.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Split(strings.TrimSpace(string(data)), "\n")).To(HaveLen(2))
+	})
+
+	It("should report files that cannot be opened", func() {
+		_, err := openHistory(filepath.Join(path, "not-a-directory", "history.jsonl"))
+		Expect(err).To(MatchError(ContainSubstring("failed to open history file")))
+	})
+})
+
+var _ = Describe("Calendar", func() {
+	var (
+		path string
+		cal  *calendar
+		loc  *time.Location
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "deliveries.ics")
+		cal = &calendar{path: path}
+		var err error
+		loc, err = loadTimeZone("America/New_York")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	read := func() string {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("should wait for an ETA before adding an event", func() {
+		Expect(cal.record(relish.OrderInfo{Status: relish.OrderStatusPlaced, Vendor: "Chipotle"}, time.Now())).To(Succeed())
+		Expect(path).NotTo(BeAnExistingFile())
+	})
+
+	It("should keep the event at the ETA, then move it to the arrival", func() {
+		observed := time.Date(2025, 7, 1, 11, 0, 0, 0, loc)
+		info := relish.OrderInfo{Status: relish.OrderStatusPreparing, ETA: "12:30 PM", Vendor: "Tacos, Etc.", OrderID: "A100"}
+		Expect(cal.record(info, observed)).To(Succeed())
+
+		Expect(read()).To(Equal("BEGIN:VCALENDAR\r\n" +
+			"VERSION:2.0\r\n" +
+			"PRODID:-//relish-notifier//relish-notifier//EN\r\n" +
+			"X-WR-CALNAME:Relish deliveries\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"UID:order-A100@relish-notifier\r\n" +
+			"DTSTAMP:20250701T150000Z\r\n" +
+			"DTSTART:20250701T163000Z\r\n" +
+			"DTEND:20250701T164500Z\r\n" +
+			"SUMMARY:Relish delivery from Tacos\\, Etc.\r\n" +
+			"DESCRIPTION:Status: Preparing Your Order\\nETA: 12:30 PM\r\n" +
+			"STATUS:TENTATIVE\r\n" +
+			"TRANSP:TRANSPARENT\r\n" +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n"))
+
+		info.Status = relish.OrderStatusArrived
+		Expect(cal.record(info, observed.Add(80*time.Minute))).To(Succeed())
+		Expect(strings.Count(read(), "BEGIN:VEVENT")).To(Equal(1))
+		Expect(read()).To(ContainSubstring("DTSTART:20250701T162000Z\r\n"))
+		Expect(read()).To(ContainSubstring("STATUS:CONFIRMED\r\n"))
+
+		// Seeing the arrival again, as after a restart, doesn't move it
+		Expect((&calendar{path: path}).record(info, observed.Add(2*time.Hour))).To(Succeed())
+		Expect(read()).To(ContainSubstring("DTSTART:20250701T162000Z\r\n"))
+	})
+
+	It("should keep the events of earlier deliveries", func() {
+		monday := time.Date(2025, 6, 30, 11, 0, 0, 0, loc)
+		Expect(cal.record(relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Chipotle"}, monday)).To(Succeed())
+		Expect(cal.record(relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Chipotle"}, monday.AddDate(0, 0, 1))).To(Succeed())
+		Expect(cal.record(relish.OrderInfo{Status: relish.OrderStatusCancelled, ETA: "1:00 PM", Vendor: "Sweetgreen"}, monday.AddDate(0, 0, 1))).To(Succeed())
+
+		events, err := readICalEvents(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+		Expect(icalProperty(events[0], "UID")).NotTo(Equal(icalProperty(events[1], "UID")))
+		Expect(events[2]).To(ContainElement("STATUS:CANCELLED"))
+	})
+
+	It("should fold long lines", func() {
+		vendor := strings.Repeat("Très Long Restaurant Name ", 5)
+		Expect(cal.record(relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: vendor}, time.Now())).To(Succeed())
+
+		for line := range strings.SplitSeq(read(), "\r\n") {
+			Expect(len(line)).To(BeNumerically("<=", icalLineLimit))
+			Expect(utf8.ValidString(line)).To(BeTrue())
+		}
+
+		events, err := readICalEvents(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(icalProperty(events[0], "SUMMARY")).To(Equal("Relish delivery from " + vendor))
+	})
+})
+
+var _ = Describe("IMAP Password", func() {
+	It("should fall back to RELISH_IMAP_PASSWORD", func() {
+		GinkgoT().Setenv("RELISH_IMAP_PASSWORD", "mailpassword")
+
+		// The keyring may hold a password, in which case it takes precedence
+		password, err := getIMAPPassword(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password).NotTo(BeEmpty())
+	})
+
+	It("should mention the environment variable when no password is available", func() {
+		GinkgoT().Setenv("RELISH_IMAP_PASSWORD", "")
+
+		if _, err := getIMAPPassword(&Config{}); err != nil {
+			Expect(err.Error()).To(ContainSubstring("RELISH_IMAP_PASSWORD"))
+		}
+	})
+})
+
+// fakeSource is a StatusSource that returns canned results
+type fakeSource struct {
+	results   []fakeResult
+	checks    int
+	relogins  int
+	refreshes int
+	reloads   int
+	restarts  int
+	// reloginErr is returned by Relogin
+	reloginErr error
+}
+
+// fakeResult is a single canned result from fakeSource
+type fakeResult struct {
+	info relish.OrderInfo
+	err  error
+}
+
+func (f *fakeSource) CheckStatus(ctx context.Context) (relish.OrderInfo, error) {
+	result := f.results[min(f.checks, len(f.results)-1)]
+	f.checks++
+	return result.info, result.err
+}
+
+func (f *fakeSource) Refresh(ctx context.Context) error {
+	f.refreshes++
+	return nil
+}
+
+func (f *fakeSource) Relogin(ctx context.Context) error {
+	f.relogins++
+	return f.reloginErr
+}
+
+func (f *fakeSource) RestartBrowser(ctx context.Context) error {
+	f.restarts++
+	return nil
+}
+
+func (f *fakeSource) Reload(ctx context.Context) error {
+	f.reloads++
+	return nil
+}
+
+// fakeMetrics counts the checks it records
+type fakeMetrics struct {
+	checks   int
+	failures int
+}
+
+func (m *fakeMetrics) Check(duration time.Duration, err error) {
+	m.checks++
+	if err != nil {
+		m.failures++
+	}
+}
+
+func (m *fakeMetrics) Close() error { return nil }
+
+var _ = Describe("Metrics", func() {
+	It("should record nothing without a StatsD address", func() {
+		metrics, err := newMetrics(&Config{}, slog.New(slog.DiscardHandler))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metrics).To(Equal(noMetrics{}))
+	})
+
+	It("should send checks, failures, and durations to StatsD", func() {
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer server.Close() //nolint:errcheck
+
+		metrics, err := newMetrics(&Config{StatsdAddr: server.LocalAddr().String()}, slog.New(slog.DiscardHandler))
+		Expect(err).NotTo(HaveOccurred())
+		defer metrics.Close() //nolint:errcheck
+
+		read := func() string {
+			buf := make([]byte, 1024)
+			Expect(server.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+			n, _, err := server.ReadFrom(buf)
+			Expect(err).NotTo(HaveOccurred())
+			return string(buf[:n])
+		}
+
+		metrics.Check(1500*time.Millisecond, nil)
+		Expect(read()).To(Equal("relish_notifier.checks:1|c\nrelish_notifier.check_duration:1500|ms"))
+
+		metrics.Check(20*time.Millisecond, errors.New("timed out"))
+		Expect(read()).To(Equal("relish_notifier.checks:1|c\nrelish_notifier.check_duration:20|ms\nrelish_notifier.failures:1|c"))
+	})
+})
+
+var _ = Describe("Status Sources", func() {
+	var config *Config
+
+	BeforeEach(func() {
+		config = &Config{Interval: time.Millisecond, MaxRelogins: 2, MaxBrowserRestarts: 2}
+	})
+
+	It("should accept only known --on-unknown values", func() {
+		for _, policy := range []string{onUnknownIgnore, onUnknownWarn, onUnknownNotify, onUnknownFail} {
+			Expect(validateOnUnknown(policy)).To(Succeed())
+		}
+		Expect(validateOnUnknown("panic")).To(MatchError(ContainSubstring(`invalid --on-unknown "panic"`)))
+	})
+
+	Describe("validateSource function", func() {
+		It("should accept known sources", func() {
+			for _, name := range []string{sourceBrowser, sourceIMAP, sourceSimulate} {
+				Expect(validateSource(name)).To(Succeed())
+			}
+		})
+
+		It("should reject unknown sources", func() {
+			Expect(validateSource("carrier-pigeon")).To(MatchError(ContainSubstring("unsupported source")))
+		})
+	})
+
+	DescribeTable("isTransient function",
+		func(err error, transient bool) {
+			Expect(isTransient(err)).To(Equal(transient))
+		},
+		Entry("no error", nil, false),
+		Entry("status missing from the page", fmt.Errorf("check failed: %w", relish.ErrStatusNotFound), true),
+		Entry("expired session", relish.ErrSessionExpired, true),
+		Entry("no order email yet", relish.ErrNoOrderEmail, true),
+		Entry("timeout", fmt.Errorf("failed to load page: %w", context.DeadlineExceeded), true),
+		Entry("network error", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true),
+		Entry("unfamiliar error", errors.New("something odd happened"), true),
+		Entry("rejected credentials", fmt.Errorf("failed to login: %w", relish.ErrInvalidCredentials), false),
+		Entry("missing order", fmt.Errorf("check failed: %w", relish.ErrOrderNotFound), false),
+		Entry("cancellation", fmt.Errorf("failed to load page: %w", context.Canceled), false),
+	)
+
+	Describe("monitor function", func() {
+		It("should check until the order arrives, refreshing in between", func() {
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{err: errors.New("element not found")},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.checks).To(Equal(3))
+			Expect(source.refreshes).To(Equal(2))
+		})
+
+		It("should keep checking for later orders with --continue-after-arrival", func() {
+			config.ContinueAfterArrival = true
+			config.MaxChecks = 4
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived, OrderID: "A100"}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusCancelled, OrderID: "B200"}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced, OrderID: "C300"}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived, OrderID: "C300"}},
+			}}
+			var seen []string
+			handlers := checkHandlers{onStatus: func(info relish.OrderInfo, unconfirmed bool, unknowns int) {
+				seen = append(seen, info.OrderID)
+			}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config, handlers: handlers})
+			Expect(err).To(Equal(exitCodeError{code: exitMaxChecks}))
+			Expect(seen).To(Equal([]string{"A100", "B200", "C300", "C300"}))
+		})
+
+		It("should not check during quiet hours, except with --once", func() {
+			now := timeOfDay(time.Now())
+			config.quietHours = &intervalWindow{start: (now + 23*time.Hour) % (24 * time.Hour), end: (now + time.Hour) % (24 * time.Hour)}
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+			}}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			Expect(monitor(ctx, source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.checks).To(BeZero())
+
+			config.Once = true
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(Equal(exitCodeError{code: 1}))
+			Expect(source.checks).To(Equal(1))
+		})
+
+		It("should log in again when the session expires", func() {
+			source := &fakeSource{results: []fakeResult{
+				{err: relish.ErrSessionExpired},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.relogins).To(Equal(1))
+			Expect(source.refreshes).To(BeZero())
+		})
+
+		It("should keep checking until enough checks confirm the arrival", func() {
+			config.ConfirmArrived = 2
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPreparing}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.checks).To(Equal(4))
+		})
+
+		It("should tell the handlers whether an arrival is confirmed", func() {
+			config.ConfirmArrived = 2
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+				{err: errors.New("element not found")},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			var unconfirmed []bool
+			failures := 0
+			handlers := checkHandlers{
+				onStatus: func(info relish.OrderInfo, pending bool, unknowns int) { unconfirmed = append(unconfirmed, pending) },
+				onError:  func(err error) { failures++ },
+			}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config, handlers: handlers})).To(Succeed())
+			Expect(unconfirmed).To(Equal([]bool{true, true, false}))
+			Expect(failures).To(Equal(1))
+		})
+
+		It("should stream every check as a line of JSON", func() {
+			config.StreamJSON = true
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced, ETA: "12:45 PM"}},
+				{err: errors.New("element not found")},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			var stdout bytes.Buffer
+			Expect(monitor(context.Background(), source, monitorOptions{config: config, stdout: &stdout})).To(Succeed())
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			Expect(lines).To(HaveLen(3))
+
+			var results []streamedCheck
+			for _, line := range lines {
+				var result streamedCheck
+				Expect(json.Unmarshal([]byte(line), &result)).To(Succeed())
+				Expect(result.Time).NotTo(BeZero())
+				results = append(results, result)
+			}
+			Expect(results[0].Status).To(Equal(relish.OrderStatusPlaced))
+			Expect(results[0].ETA).To(Equal("12:45 PM"))
+			Expect(results[1].Error).To(Equal("element not found"))
+			Expect(results[2].Arrived).To(BeTrue())
+		})
+
+		It("should exit after enough unknown statuses in a row with --on-unknown fail", func() {
+			config.OnUnknown = onUnknownFail
+			config.UnknownThreshold = 2
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			var exitErr exitCodeError
+			Expect(errors.As(err, &exitErr)).To(BeTrue())
+			Expect(exitErr.code).To(Equal(exitUnknownStatus))
+			Expect(source.checks).To(Equal(4))
+		})
+
+		It("should tell the handlers how many unknown statuses it has seen in a row", func() {
+			config.OnUnknown = onUnknownWarn
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{err: errors.New("element not found")},
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+			var counts []int
+			handlers := checkHandlers{onStatus: func(info relish.OrderInfo, unconfirmed bool, unknowns int) {
+				counts = append(counts, unknowns)
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config, handlers: handlers})).To(Succeed())
+			// A failed check doesn't break the run, but a known status does
+			Expect(counts).To(Equal([]int{1, 2, 3, 0, 1, 0}))
+		})
+
+		It("should keep checking through unknown statuses by default", func() {
+			config.OnUnknown = onUnknownWarn
+			config.UnknownThreshold = 1
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusUnknown}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.checks).To(Equal(3))
+		})
+
+		It("should record every check in the metrics", func() {
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{err: errors.New("element not found")},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+			metrics := &fakeMetrics{}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config, metrics: metrics})).To(Succeed())
+			Expect(metrics.checks).To(Equal(3))
+			Expect(metrics.failures).To(Equal(1))
+		})
+
+		It("should restart the browser when it crashes", func() {
+			source := &fakeSource{results: []fakeResult{
+				{err: fmt.Errorf("%w: page closed", relish.ErrBrowserDisconnected)},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.restarts).To(Equal(1))
+			Expect(source.refreshes).To(BeZero())
+		})
+
+		It("should give up when the browser keeps crashing", func() {
+			source := &fakeSource{results: []fakeResult{
+				{err: fmt.Errorf("%w: page closed", relish.ErrBrowserDisconnected)},
+			}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(MatchError(relish.ErrBrowserDisconnected))
+			Expect(err).To(MatchError(ContainSubstring("after 2 restarts")))
+			Expect(source.restarts).To(Equal(2))
+		})
+
+		It("should give up when the session keeps expiring after logging in again", func() {
+			source := &fakeSource{results: []fakeResult{{err: relish.ErrSessionExpired}}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(MatchError(ContainSubstring("2 attempts to log in again failed")))
+			Expect(source.relogins).To(Equal(2))
+			Expect(source.checks).To(Equal(3))
+		})
+
+		It("should count relogins again from zero after a successful check", func() {
+			source := &fakeSource{results: []fakeResult{
+				{err: relish.ErrSessionExpired},
+				{err: relish.ErrSessionExpired},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{err: relish.ErrSessionExpired},
+				{err: relish.ErrSessionExpired},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.relogins).To(Equal(4))
+		})
+
+		It("should stop right away when the credentials are rejected", func() {
+			source := &fakeSource{
+				results:    []fakeResult{{err: relish.ErrSessionExpired}},
+				reloginErr: fmt.Errorf("failed to login: %w", relish.ErrInvalidCredentials),
+			}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(MatchError(relish.ErrInvalidCredentials))
+			Expect(source.relogins).To(Equal(1))
+		})
+
+		It("should stop when a check fails with an error that won't clear up", func() {
+			source := &fakeSource{results: []fakeResult{
+				{err: fmt.Errorf("failed to log in to IMAP server: %w", relish.ErrInvalidCredentials)},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(MatchError(relish.ErrInvalidCredentials))
+			Expect(source.checks).To(Equal(1))
+		})
+
+		It("should give up after too many failed relogins", func() {
+			source := &fakeSource{
+				results:    []fakeResult{{err: relish.ErrSessionExpired}},
+				reloginErr: errors.New("bad password"),
+			}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(MatchError(ContainSubstring("2 attempts to log in again failed")))
+			Expect(source.relogins).To(Equal(2))
+		})
+
+		It("should exit with status 2 when the order is cancelled", func() {
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusDelayed}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusCancelled}},
+			}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(Equal(exitCodeError{code: 2}))
+			Expect(source.checks).To(Equal(2))
+		})
+
+		It("should reload and check again right away on SIGHUP", func() {
+			config.Interval = time.Hour
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+			reload := make(chan os.Signal, 1)
+			reload <- syscall.SIGHUP
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config, reload: reload})).To(Succeed())
+			Expect(source.reloads).To(Equal(1))
+			Expect(source.refreshes).To(Equal(1))
+		})
+
+		It("should check right away when asked to", func() {
+			config.Interval = time.Hour
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+			checkNow := make(chan struct{}, 1)
+			checkNow <- struct{}{}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config, checkNow: checkNow})).To(Succeed())
+			Expect(source.checks).To(Equal(2))
+			Expect(source.refreshes).To(Equal(1))
+		})
+
+		It("should stop after the maximum number of checks", func() {
+			config.MaxChecks = 2
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPreparing}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			err := monitor(context.Background(), source, monitorOptions{config: config})
+			Expect(err).To(Equal(exitCodeError{code: exitMaxChecks}))
+			Expect(source.checks).To(Equal(2))
+			Expect(source.refreshes).To(Equal(1))
+		})
+
+		It("should write only the last result when --until-arrived gives up", func() {
+			config.UntilArrived = true
+			config.MaxChecks = 2
+			config.Output = outputJSON
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusPreparing}},
+			}}
+
+			var stdout bytes.Buffer
+			err := monitor(context.Background(), source, monitorOptions{config: config, stdout: &stdout})
+			Expect(err).To(Equal(exitCodeError{code: exitMaxChecks}))
+			Expect(stdout.String()).To(MatchJSON(`{"status":"Preparing Your Order","arrived":false}`))
+		})
+
+		It("should succeed when the order arrives on the last check", func() {
+			config.MaxChecks = 2
+			source := &fakeSource{results: []fakeResult{
+				{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+				{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+			}}
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+		})
+
+		It("should stop when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			source := &fakeSource{results: []fakeResult{{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}}}}
+
+			Expect(monitor(ctx, source, monitorOptions{config: config})).To(Succeed())
+			Expect(source.checks).To(BeZero())
+		})
+
+		It("should run the simulated source to completion", func() {
+			source := relish.NewSimulatedSource()
+
+			Expect(monitor(context.Background(), source, monitorOptions{config: config})).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("List Statuses", func() {
+	statuses := []relish.StatusDefinition{
+		{Name: "OrderStatusPlaced", Status: relish.OrderStatusPlaced},
+		{Name: "OrderStatusArrived", Status: relish.OrderStatusArrived},
+	}
+
+	It("should write a table of names and exact text", func() {
+		buffer := &bytes.Buffer{}
+		Expect(writeStatuses(buffer, statuses, false)).To(Succeed())
+
+		Expect(buffer.String()).To(Equal("NAME                TEXT\n" +
+			"OrderStatusPlaced   \"Order Placed\"\n" +
+			"OrderStatusArrived  \"Order Arrived\"\n"))
+	})
+
+	It("should write JSON output", func() {
+		buffer := &bytes.Buffer{}
+		Expect(writeStatuses(buffer, statuses, true)).To(Succeed())
+
+		Expect(buffer.String()).To(MatchJSON(`[
+			{"name": "OrderStatusPlaced", "text": "Order Placed"},
+			{"name": "OrderStatusArrived", "text": "Order Arrived"}
+		]`))
+	})
+})
+
+var _ = Describe("Notifications", func() {
+	DescribeTable("parseStatusFilter function",
+		func(spec string, expected statusFilter) {
+			Expect(parseStatusFilter(spec)).To(Equal(expected))
+		},
+		Entry("default", "", statusFilter{}),
+		Entry("all", "all", statusFilter{all: true}),
+		Entry("one status", "arrived", statusFilter{statuses: []relish.OrderStatus{relish.OrderStatusArrived}}),
+		Entry("driver assigned", "driver-assigned", statusFilter{statuses: []relish.OrderStatus{relish.OrderStatusDriverAssigned}}),
+		Entry("several statuses", "Out-For-Delivery, arrived",
+			statusFilter{statuses: []relish.OrderStatus{relish.OrderStatusOutForDelivery, relish.OrderStatusArrived}}),
+		Entry("statuses and events", "arrived,waiting,Failure",
+			statusFilter{statuses: []relish.OrderStatus{relish.OrderStatusArrived}, events: []string{eventWaiting, eventFailure}}),
+	)
+
+	DescribeTable("shouldNotify function",
+		func(previous, current relish.OrderStatus, expected bool) {
+			Expect(shouldNotify(previous, current)).To(Equal(expected))
+		},
+		Entry("first check, still preparing", relish.OrderStatus(""), relish.OrderStatusPreparing, false),
+		Entry("arrived", relish.OrderStatusPreparing, relish.OrderStatusArrived, true),
+		Entry("cancelled", relish.OrderStatusPlaced, relish.OrderStatusCancelled, true),
+		Entry("newly delayed", relish.OrderStatusPreparing, relish.OrderStatusDelayed, true),
+		Entry("still delayed", relish.OrderStatusDelayed, relish.OrderStatusDelayed, false),
+		Entry("delayed again after recovering", relish.OrderStatusPreparing, relish.OrderStatusDelayed, true),
+		Entry("out for delivery", relish.OrderStatusPreparing, relish.OrderStatusOutForDelivery, true),
+		Entry("still out for delivery", relish.OrderStatusOutForDelivery, relish.OrderStatusOutForDelivery, false),
+		Entry("driver assigned", relish.OrderStatusPreparing, relish.OrderStatusDriverAssigned, true),
+		Entry("still driver assigned", relish.OrderStatusDriverAssigned, relish.OrderStatusDriverAssigned, false),
+	)
+})
+
+// fakeTarget records the notifications it receives
+type fakeTarget struct {
+	name   string
+	format messageFormat
+	sent   []Notification
+	err    error
+	// barrier, if set, makes Send wait until every target sharing it has been called
+	barrier *sync.WaitGroup
+}
+
+func (f *fakeTarget) Name() string {
+	if f.name == "" {
+		return "fake"
+	}
+	return f.name
+}
+
+func (f *fakeTarget) Format() messageFormat { return f.format }
+
+func (f *fakeTarget) Send(ctx context.Context, n Notification) error {
+	if f.barrier != nil {
+		f.barrier.Done()
+		f.barrier.Wait()
+	}
+	f.sent = append(f.sent, n)
+	return f.err
+}
+
+var _ = Describe("Notification Targets", func() {
+	var (
+		config *Config
+		data   MessageData
+	)
+
+	BeforeEach(func() {
+		config = &Config{MessageTemplate: defaultMessageTemplate, MarkdownTemplate: defaultMarkdownTemplate}
+		data = MessageData{OrderInfo: relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Chipotle"}}
+	})
+
+	Describe("dispatcher", func() {
+		It("should render the message in each target's format", func() {
+			d, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+			Expect(err).NotTo(HaveOccurred())
+
+			failing := &fakeTarget{format: formatPlain, err: errors.New("unreachable")}
+			plain := &fakeTarget{format: formatPlain}
+			markdown := &fakeTarget{format: formatMarkdown}
+			d.targets = []NotificationTarget{failing, plain, markdown}
+
+			d.send(context.Background(), relish.OrderStatusPreparing, data, d.render(formatPlain, data))
+
+			Expect(failing.sent).To(HaveLen(1))
+			Expect(plain.sent).To(HaveLen(1))
+			Expect(plain.sent[0].Text).To(Equal("order from Chipotle status: Order Arrived"))
+			Expect(markdown.sent).To(HaveLen(1))
+			Expect(markdown.sent[0].Text).To(Equal("order from Chipotle status: *Order Arrived*"))
+			Expect(markdown.sent[0].Message).To(Equal(plain.sent[0].Text))
+		})
+
+		It("should send to every target at once and report all their errors", func() {
+			var logs bytes.Buffer
+			d, err := newDispatcher(config, slog.New(slog.NewTextHandler(&logs, nil)))
+			Expect(err).NotTo(HaveOccurred())
+
+			// None of the sends can return until all three have started, so send
+			// only finishes if it runs them at the same time
+			var barrier sync.WaitGroup
+			barrier.Add(3)
+			slack := &fakeTarget{name: "slack", format: formatPlain, barrier: &barrier, err: errors.New("webhook gone")}
+			email := &fakeTarget{name: "email", format: formatPlain, barrier: &barrier, err: errors.New("no route to host")}
+			desktop := &fakeTarget{name: "desktop", format: formatPlain, barrier: &barrier}
+			d.targets = []NotificationTarget{slack, email, desktop}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				d.send(context.Background(), relish.OrderStatusPreparing, data, d.render(formatPlain, data))
+			}()
+			Eventually(done).Should(BeClosed())
+
+			// Every send has finished by the time send returns
+			Expect(slack.sent).To(HaveLen(1))
+			Expect(email.sent).To(HaveLen(1))
+			Expect(desktop.sent).To(HaveLen(1))
+			Expect(logs.String()).To(ContainSubstring(`slack: webhook gone\nemail: no route to host`))
+		})
+
+		It("should announce the same text to every target", func() {
+			d, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+			Expect(err).NotTo(HaveOccurred())
+
+			plain := &fakeTarget{format: formatPlain}
+			markdown := &fakeTarget{format: formatMarkdown}
+			d.targets = []NotificationTarget{plain, markdown}
+
+			data.Event = eventFailure
+			d.announce(context.Background(), data, "checks are failing")
+
+			Expect(plain.sent[0].Text).To(Equal("checks are failing"))
+			Expect(markdown.sent[0].Text).To(Equal("checks are failing"))
+			Expect(messageEnv(markdown.sent[0].Data, markdown.sent[0].Message)).To(ContainElement("RELISH_EVENT=failure"))
+		})
+
+		It("should announce only what each target asked for", func() {
+			config.Command = "true"
+			config.Desktop = true
+			config.ExecOn = "arrived,failure,recovery"
+			config.SlackOn = "waiting"
+			d, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+			Expect(err).NotTo(HaveOccurred())
+
+			command := &fakeTarget{name: "command", format: formatPlain}
+			exec := &fakeTarget{name: "exec", format: formatPlain}
+			desktop := &fakeTarget{name: "desktop", format: formatPlain}
+			slack := &fakeTarget{name: "slack", format: formatMarkdown}
+			d.targets = []NotificationTarget{command, exec, desktop, slack}
+
+			events := func(target *fakeTarget) []string {
+				var events []string
+				for _, n := range target.sent {
+					events = append(events, n.Data.Event)
+				}
+				return events
+			}
+
+			for _, event := range []string{eventWaiting, eventFailure, eventRecovery, eventUnknown, eventTest} {
+				data.Event = event
+				d.announce(context.Background(), data, "relish-notifier: "+event)
+			}
+
+			// Commands are usually written for the order arriving, so they only get the
+			// announcements they ask for
+			Expect(events(command)).To(Equal([]string{eventTest}))
+			Expect(events(exec)).To(Equal([]string{eventFailure, eventRecovery, eventTest}))
+			Expect(events(desktop)).To(Equal([]string{eventWaiting, eventFailure, eventRecovery, eventUnknown, eventTest}))
+			Expect(events(slack)).To(Equal([]string{eventWaiting, eventTest}))
+		})
+
+		It("should send each target only the status changes it asked for", func() {
+			config.SlackOn = "all"
+			config.DesktopOn = "arrived"
+			d, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+			Expect(err).NotTo(HaveOccurred())
+
+			slack := &fakeTarget{name: "slack", format: formatMarkdown}
+			desktop := &fakeTarget{name: "desktop", format: formatPlain}
+			command := &fakeTarget{name: "command", format: formatPlain}
+			d.targets = []NotificationTarget{slack, desktop, command}
+
+			for _, change := range [][2]relish.OrderStatus{
+				{relish.OrderStatusPlaced, relish.OrderStatusPreparing},
+				{relish.OrderStatusPreparing, relish.OrderStatusOutForDelivery},
+				{relish.OrderStatusOutForDelivery, relish.OrderStatusArrived},
+			} {
+				Expect(d.wants(change[0], change[1])).To(BeTrue())
+				data.Status = change[1]
+				d.send(context.Background(), change[0], data, d.render(formatPlain, data))
+			}
+
+			Expect(slack.sent).To(HaveLen(3))
+			Expect(desktop.sent).To(HaveLen(1))
+			Expect(desktop.sent[0].Data.Status).To(Equal(relish.OrderStatusArrived))
+			// Without a filter, a target only hears about the arrival
+			Expect(command.sent).To(HaveLen(1))
+			Expect(command.sent[0].Data.Status).To(Equal(relish.OrderStatusArrived))
+			Expect(d.wants(relish.OrderStatusPreparing, relish.OrderStatusPreparing)).To(BeFalse())
+		})
+
+		It("should not notify of the same status of an order twice, even after a restart", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "state.json")
+			info := relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Chipotle", OrderID: "A100"}
+
+			run := func() *fakeTarget {
+				state, err := loadState(path)
+				Expect(err).NotTo(HaveOccurred())
+				d, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+				Expect(err).NotTo(HaveOccurred())
+				target := &fakeTarget{format: formatPlain}
+				d.targets = []NotificationTarget{target}
+				d.dedupe = &notificationDedupe{state: state, path: path, force: config.ForceNotify, logger: slog.New(slog.DiscardHandler)}
+
+				notify(context.Background(), config, io.Discard, d, relish.OrderStatusOutForDelivery, info, slog.New(slog.DiscardHandler))
+				return target
+			}
+
+			Expect(run().sent).To(HaveLen(1))
+			Expect(run().sent).To(BeEmpty())
+
+			config.ForceNotify = true
+			Expect(run().sent).To(HaveLen(1))
+		})
+
+		It("should reject an invalid status filter", func() {
+			config.DesktopOn = "arrived,eaten"
+			_, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+			Expect(err).To(MatchError(ContainSubstring(`invalid --desktop-on: unknown status "eaten"`)))
+			Expect(err).To(MatchError(ContainSubstring("waiting, failure, recovery, unknown")))
+		})
+
+		It("should reject an invalid markdown template", func() {
+			config.MarkdownTemplate = "{{ .Status"
+			_, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+			Expect(err).To(MatchError(ContainSubstring("failed to parse message template")))
+		})
+	})
+
+	Describe("newTargets function", func() {
+		It("should build the targets selected by flags", func() {
+			config.Command = "true"
+			config.Exec = "true"
+			config.Desktop = true
+			config.SlackWebhook = "https://hooks.slack.com/services/x"
+
+			targets, err := newTargets(config, slog.New(slog.DiscardHandler))
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, target := range targets {
+				names = append(names, target.Name())
+			}
+			Expect(names).To(Equal([]string{"command", "exec", "desktop", "slack"}))
+		})
+
+		It("should require an SMTP server to send email", func() {
+			config.EmailTo = "me@example.com"
+			_, err := newTargets(config, slog.New(slog.DiscardHandler))
+			Expect(err).To(MatchError(ContainSubstring("--email-to requires --smtp-server")))
+		})
+
+		It("should require --exec with --exec-arg", func() {
+			config.ExecArgs = []string{"{{ .Status }}"}
+			_, err := newTargets(config, slog.New(slog.DiscardHandler))
+			Expect(err).To(MatchError(ContainSubstring("--exec-arg requires --exec")))
+		})
+
+		It("should build only the targets chosen with --notify", func() {
+			config.Command = "true"
+			config.SlackWebhook = "https://hooks.slack.com/services/x"
+			config.Notify = []string{"slack", "desktop"}
+
+			targets, err := newTargets(config, slog.New(slog.DiscardHandler))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targets).To(HaveLen(2))
+			Expect(targets[0].Name()).To(Equal("desktop"))
+			Expect(targets[1].Name()).To(Equal("slack"))
+		})
+
+		DescribeTable("should reject a bad --notify",
+			func(notify []string, message string) {
+				config.Notify = notify
+				_, err := newTargets(config, slog.New(slog.DiscardHandler))
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("unknown target", []string{"pager"}, `unknown notification target "pager" (choose from command, exec, desktop, slack, email, sms)`),
+			Entry("repeated target", []string{"desktop", "desktop"}, `--notify names "desktop" more than once`),
+			Entry("slack without a webhook", []string{"slack"}, "slack notifications require --slack-webhook"),
+			Entry("email without addresses", []string{"email"}, "email notifications require --email-to"),
+			Entry("sms without numbers", []string{"sms"}, "sms notifications require --sms-to"),
+			Entry("command without a command", []string{"command"}, "command notifications require --command"),
+			Entry("exec without a program", []string{"exec"}, "exec notifications require --exec"),
+		)
+
+		Describe("registered targets", func() {
+			var fake *fakeTarget
+
+			BeforeEach(func() {
+				DeferCleanup(func(registry []targetDefinition) { targetRegistry = registry }, targetRegistry)
+				fake = &fakeTarget{name: "pigeon", format: formatPlain}
+				registerTarget(targetDefinition{
+					name:    "pigeon",
+					enabled: func(config *Config) bool { return false },
+					create: func(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+						return fake, nil
+					},
+				})
+			})
+
+			It("should send notifications to a target chosen with --notify", func() {
+				config.Notify = []string{"pigeon"}
+				d, err := newDispatcher(config, slog.New(slog.DiscardHandler))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(d.targets).To(Equal([]NotificationTarget{fake}))
+
+				// Without a filter option, only arrivals are sent
+				d.send(context.Background(), relish.OrderStatusPlaced, MessageData{OrderInfo: relish.OrderInfo{Status: relish.OrderStatusPreparing}}, "preparing")
+				d.send(context.Background(), relish.OrderStatusPreparing, data, "arrived")
+				Expect(fake.sent).To(HaveLen(1))
+				Expect(fake.sent[0].Message).To(Equal("arrived"))
+			})
+
+			It("should leave out a target that isn't turned on", func() {
+				targets, err := newTargets(config, slog.New(slog.DiscardHandler))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(targets).To(BeEmpty())
+			})
+
+			It("should refuse to register a name twice", func() {
+				Expect(func() { registerTarget(targetDefinition{name: "slack"}) }).To(PanicWith(ContainSubstring(`"slack" is already registered`)))
+			})
+		})
+	})
+
+	Describe("command targets", func() {
+		It("should pass the message to shell commands in the environment", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "out")
+			target := &commandTarget{command: `printf '%s' "$RELISH_MESSAGE" > ` + out}
+
+			Expect(target.Send(context.Background(), Notification{Data: data, Message: "lunch"})).To(Succeed())
+			Expect(os.ReadFile(out)).To(Equal([]byte("lunch")))
+		})
+
+		It("should send a JSON description on stdin when asked to", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "out")
+			target := &commandTarget{command: "cat > " + out, stdinJSON: true}
+			data := data
+			data.Event = eventStatus
+			data.Time = time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+
+			Expect(target.Send(context.Background(), Notification{Data: data, Message: "lunch"})).To(Succeed())
+			Expect(os.ReadFile(out)).To(MatchJSON(`{
+				"status": "Order Arrived",
+				"vendor": "Chipotle",
+				"arrived": true,
+				"message": "lunch",
+				"event": "status",
+				"hostname": "",
+				"time": "2025-06-01T12:30:00Z"
+			}`))
+		})
+
+		It("should leave stdin empty by default", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "out")
+			target := &commandTarget{command: "cat > " + out}
+
+			Expect(target.Send(context.Background(), Notification{Data: data, Message: "lunch"})).To(Succeed())
+			Expect(os.ReadFile(out)).To(BeEmpty())
+		})
+
+		It("should log what the command prints with --command-log-output log", func() {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+			target := &commandTarget{command: "echo sent; echo oops >&2; exit 3", logOutput: commandOutputLog, logger: logger}
+
+			Expect(target.Send(context.Background(), Notification{Data: data})).NotTo(Succeed())
+			Expect(buf.String()).To(ContainSubstring(`msg="command output" status="Order Arrived" output="sent\noops\n" error="exit status 3"`))
+		})
+
+		It("should append what the command prints to a file", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "command.log")
+			target := &commandTarget{command: "echo sent", logOutput: out, logger: slog.New(slog.DiscardHandler)}
+			data := data
+			data.Time = time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+
+			Expect(target.Send(context.Background(), Notification{Data: data})).To(Succeed())
+			Expect(target.Send(context.Background(), Notification{Data: data})).To(Succeed())
+			entry := "--- 2025-06-01T12:30:00Z, order status Order Arrived\nsent\n"
+			Expect(os.ReadFile(out)).To(Equal([]byte(entry + entry)))
+		})
+
+		It("should cut very long output short", func() {
+			output := &limitedBuffer{limit: 4}
+			fmt.Fprint(output, "abc")
+			fmt.Fprint(output, "defgh")
+
+			Expect(output.String()).To(Equal("abcd\n[output truncated: 4 more bytes]"))
+		})
+
+		It("should stop commands that run longer than the timeout", func() {
+			target := &commandTarget{command: "sleep 10", timeout: 50 * time.Millisecond}
+
+			start := time.Now()
+			Expect(target.Send(context.Background(), Notification{Data: data})).NotTo(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+
+		It("should pass the error to the error command", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "out")
+			config := &Config{NotifyCommandOnError: `printf '%s %s' "$RELISH_EVENT" "$RELISH_ERROR" > ` + out}
+
+			Expect(runErrorCommand(context.Background(), config, errors.New("status element not found"))).To(Succeed())
+			Expect(os.ReadFile(out)).To(Equal([]byte("error status element not found")))
+		})
+
+		It("should report a failed pre-login command with its output", func() {
+			Expect(runPreLoginCommand(context.Background(), &Config{PreLoginCommand: "true"})).To(Succeed())
+
+			err := runPreLoginCommand(context.Background(), &Config{PreLoginCommand: "echo vpn is down >&2; exit 1"})
+			Expect(err).To(MatchError("pre-login command failed: exit status 1: vpn is down"))
+		})
+
+		It("should stop a pre-login command that runs longer than the timeout", func() {
+			config := &Config{PreLoginCommand: "sleep 10", PreLoginTimeout: 50 * time.Millisecond}
+
+			start := time.Now()
+			Expect(runPreLoginCommand(context.Background(), config)).To(MatchError(ContainSubstring("timed out after 50ms")))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+
+		It("should run programs with rendered arguments", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "out")
+			args, err := parseExecArgs([]string{"-c", `printf '%s' "$1" > "$2"`, "sh", "{{ .Vendor }}", out})
+			Expect(err).NotTo(HaveOccurred())
+			target := &execTarget{program: "sh", args: args}
+
+			Expect(target.Send(context.Background(), Notification{Data: data})).To(Succeed())
+			Expect(os.ReadFile(out)).To(Equal([]byte("Chipotle")))
+		})
+	})
+
+	Describe("slack target", func() {
+		It("should post the markdown message", func() {
+			var body map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			}))
+			defer server.Close()
+
+			target := &slackTarget{url: server.URL, client: server.Client()}
+			Expect(target.Format()).To(Equal(formatMarkdown))
+			Expect(target.Send(context.Background(), Notification{Text: "*Order Arrived*"})).To(Succeed())
+			Expect(body).To(Equal(map[string]string{"text": "*Order Arrived*"}))
+		})
+
+		It("should report webhook errors", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "invalid_token", http.StatusForbidden)
+			}))
+			defer server.Close()
+
+			target := &slackTarget{url: server.URL, client: server.Client()}
+			Expect(target.Send(context.Background(), Notification{Text: "hi"})).To(MatchError(ContainSubstring("403")))
+		})
+	})
+})
+
+// fakeSMTPServer accepts a single message and sends its DATA on the returned channel
+func fakeSMTPServer() (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(listener.Close)
+
+	received := make(chan string, 1)
+	go func() {
+		defer GinkgoRecover()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() //nolint:errcheck
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+		reply("220 localhost ready")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+var _ = Describe("Email Notifications", func() {
+	var notification Notification
+
+	BeforeEach(func() {
+		notification = Notification{
+			Data: MessageData{OrderInfo: relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Tacos <&> More", ETA: "12:30 PM"}},
+			Text: "order from Tacos <&> More status: Order Arrived",
+		}
+	})
+
+	It("should send the plain text message", func() {
+		server, received := fakeSMTPServer()
+		target, err := newEmailTarget(&Config{EmailTo: "me@example.com, you@example.com", SMTPServer: server})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(target.Send(context.Background(), notification)).To(Succeed())
+
+		msg, err := mail.ReadMessage(strings.NewReader(<-received))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Header.Get("From")).To(Equal("me@example.com"))
+		Expect(msg.Header.Get("To")).To(Equal("me@example.com, you@example.com"))
+		Expect(msg.Header.Get("Subject")).To(Equal("Relish: Order Arrived"))
+		Expect(msg.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		Expect(err).NotTo(HaveOccurred())
+		// SMTP ends the data with a line break
+		Expect(strings.TrimSuffix(string(body), "\r\n")).To(Equal(notification.Text))
+	})
+
+	It("should send a styled HTML message with a plain text fallback", func() {
+		target := &emailTarget{from: "relish@example.com", to: []string{"me@example.com"}, html: true}
+		message, err := target.message(notification, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+
+		msg, err := mail.ReadMessage(bytes.NewReader(message))
+		Expect(err).NotTo(HaveOccurred())
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mediaType).To(Equal("multipart/alternative"))
+
+		parts := multipart.NewReader(msg.Body, params["boundary"])
+		text, err := parts.NextPart()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(text.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+		Expect(io.ReadAll(text)).To(BeEquivalentTo(notification.Text))
+
+		html, err := parts.NextPart()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(html.Header.Get("Content-Type")).To(HavePrefix("text/html"))
+		body, err := io.ReadAll(html)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("background: #2a7d2a;\">Order Arrived</span>"))
+		Expect(string(body)).To(ContainSubstring("<td>12:30 PM</td>"))
+		Expect(string(body)).To(ContainSubstring("Tacos &lt;&amp;&gt; More"))
+	})
+})
+
+var _ = Describe("SMS Notifications", func() {
+	It("should text each number the status and ETA", func() {
+		var bodies []url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/Accounts/AC123/Messages.json"))
+			user, password, ok := r.BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(user).To(Equal("AC123"))
+			Expect(password).To(Equal("secret"))
+			Expect(r.ParseForm()).To(Succeed())
+			bodies = append(bodies, r.PostForm)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+
+		target, err := newSMSTarget(&Config{TwilioSID: "AC123", TwilioToken: "secret", TwilioFrom: "+15555550100", SMSTo: "+15555550123, +15555550124"})
+		Expect(err).NotTo(HaveOccurred())
+		target.api, target.client = server.URL, server.Client()
+
+		notification := Notification{
+			Data:    MessageData{OrderInfo: relish.OrderInfo{Status: relish.OrderStatusArrived, Vendor: "Tacos", ETA: "12:30 PM"}, Event: eventStatus},
+			Message: "order from Tacos status: Order Arrived",
+		}
+		Expect(target.Send(context.Background(), notification)).To(Succeed())
+		Expect(bodies).To(HaveLen(2))
+		Expect(bodies[0].Get("To")).To(Equal("+15555550123"))
+		Expect(bodies[1].Get("To")).To(Equal("+15555550124"))
+		Expect(bodies[0].Get("From")).To(Equal("+15555550100"))
+		Expect(bodies[0].Get("Body")).To(Equal("Relish: Order Arrived, ETA 12:30 PM"))
+	})
+
+	It("should cut other messages to fit in a single SMS", func() {
+		body := smsBody(Notification{Data: MessageData{Event: eventFailure}, Message: strings.Repeat("failed\n", 40)})
+		Expect(body).To(HaveLen(smsLimit))
+		Expect(body).To(HaveSuffix("..."))
+		Expect(body).NotTo(ContainSubstring("\n"))
+	})
+
+	It("should report the error Twilio returns and still text the other numbers", func() {
+		var texted []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			to := r.FormValue("To")
+			texted = append(texted, to)
+			if to == "+1555" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"code": 21211, "message": "The 'To' number +1555 is not a valid phone number.", "status": 400}`) //nolint:errcheck
+			}
+		}))
+		defer server.Close()
+
+		target := &smsTarget{api: server.URL, sid: "AC123", token: "secret", from: "+15555550100", to: []string{"+1555", "+15555550123"}, client: server.Client()}
+		err := target.Send(context.Background(), Notification{Data: MessageData{Event: eventStatus}})
+		Expect(err).To(MatchError(ContainSubstring("+1555: The 'To' number +1555 is not a valid phone number. (Twilio error 21211)")))
+		Expect(texted).To(Equal([]string{"+1555", "+15555550123"}))
+	})
+
+	It("should fall back to the HTTP status when Twilio's error can't be read", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		target := &smsTarget{api: server.URL, sid: "AC123", token: "secret", to: []string{"+15555550123"}, client: server.Client()}
+		Expect(target.Send(context.Background(), Notification{})).To(MatchError(ContainSubstring("502 Bad Gateway")))
+	})
+
+	It("should read the token from RELISH_TWILIO_TOKEN", func() {
+		GinkgoT().Setenv("RELISH_TWILIO_TOKEN", "envtoken")
+
+		target, err := newSMSTarget(&Config{TwilioSID: "AC123", TwilioFrom: "+15555550100", SMSTo: "+15555550123", NoKeyring: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target.token).To(Equal("envtoken"))
+	})
+
+	It("should require an account and a number to send from", func() {
+		_, err := newSMSTarget(&Config{SMSTo: "+15555550123", TwilioSID: "AC123"})
+		Expect(err).To(MatchError(ContainSubstring("--twilio-from")))
+	})
+})
+
+var _ = Describe("Reloading", func() {
+	BeforeEach(func() {
+		keyring.MockInit()
+	})
+
+	It("should not log in again when the credentials are unchanged", func() {
+		Expect(keyring.Set(defaultKeyringService, "EMAIL", "me@example.com")).To(Succeed())
+		Expect(keyring.Set(defaultKeyringService, "PASSWORD", "secret")).To(Succeed())
+		GinkgoT().Setenv("RELISH_TOTP_SECRET", "")
+
+		config := &Config{}
+		source := &browserSource{
+			credentials: &relish.Credentials{Username: "me@example.com", Password: "secret"},
+			config:      config,
+			logger:      slog.New(slog.DiscardHandler),
+		}
+
+		// Relogin would fail without a browser, so success means it wasn't attempted
+		Expect(source.Reload(context.Background())).To(Succeed())
+	})
+
+	It("should refresh the page before checking again after a reload", func() {
+		config := &Config{Interval: time.Hour}
+		source := &fakeSource{results: []fakeResult{
+			{info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+			{info: relish.OrderInfo{Status: relish.OrderStatusArrived}},
+		}}
+		reload := make(chan os.Signal, 1)
+		reload <- syscall.SIGHUP
+
+		// The credentials are unchanged, so only a refresh keeps the check from reading the
+		// page it read before
+		Expect(monitor(context.Background(), source, monitorOptions{config: config, reload: reload})).To(Succeed())
+		Expect(source.reloads).To(Equal(1))
+		Expect(source.refreshes).To(Equal(1))
+		Expect(source.checks).To(Equal(2))
+	})
+
+	It("should pick up a new mailbox password", func() {
+		GinkgoT().Setenv("RELISH_IMAP_PASSWORD", "new-password")
+
+		config := &Config{}
+		source := &imapSource{config: config}
+		Expect(source.Reload(context.Background())).To(Succeed())
+		Expect(config.IMAP.Password).To(Equal("new-password"))
+	})
+})
+
+var _ = Describe("Profiles", func() {
+	BeforeEach(func() {
+		keyring.MockInit()
+		GinkgoT().Setenv("RELISH_USERNAME", "")
+		GinkgoT().Setenv("RELISH_PASSWORD", "")
+		GinkgoT().Setenv("RELISH_TOTP_SECRET", "")
+		GinkgoT().Setenv("RELISH_NO_KEYRING", "")
+		GinkgoT().Setenv("CREDENTIALS_DIRECTORY", "")
+	})
+
+	It("should namespace keyring accounts by profile", func() {
+		Expect(keyringAccount("", "EMAIL")).To(Equal("EMAIL"))
+		Expect(keyringAccount("work", "EMAIL")).To(Equal("work/EMAIL"))
+	})
+
+	It("should store and remove credentials for a profile", func() {
+		config := &Config{Profile: "work"}
+
+		login := newLoginCommand(config)
+		login.SetIn(strings.NewReader("me@work.example.com\nsecret\nJBSWY3DPEHPK3PXP\n"))
+		login.SetErr(io.Discard)
+		login.SetArgs([]string{})
+		Expect(login.Execute()).To(Succeed())
+
+		creds, err := getCredentials(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@work.example.com"))
+		Expect(creds.Password).To(Equal("secret"))
+		Expect(creds.TOTPSecret).To(Equal("JBSWY3DPEHPK3PXP"))
+
+		// Other profiles are unaffected
+		_, err = getCredentials(&Config{})
+		Expect(err).To(HaveOccurred())
+
+		logout := newLogoutCommand(config)
+		logout.SetErr(io.Discard)
+		logout.SetArgs([]string{})
+		Expect(logout.Execute()).To(Succeed())
+
+		_, err = getCredentials(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should keep credentials in the selected keyring service", func() {
+		GinkgoT().Setenv("RELISH_IMAP_PASSWORD", "")
+		config := &Config{KeyringService: "relish-notifier-test"}
+		Expect(keyring.Set("relish-notifier-test", "EMAIL", "me@test.example.com")).To(Succeed())
+		Expect(keyring.Set("relish-notifier-test", "PASSWORD", "secret")).To(Succeed())
+		Expect(keyring.Set("relish-notifier-test", "IMAP_PASSWORD", "mailbox")).To(Succeed())
+
+		creds, err := getCredentials(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@test.example.com"))
+		Expect(getIMAPPassword(config)).To(Equal("mailbox"))
+
+		// The default service has nothing stored
+		_, err = getCredentials(&Config{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should skip the keyring when it is disabled", func() {
+		Expect(keyring.Set(defaultKeyringService, "EMAIL", "me@keyring.example.com")).To(Succeed())
+		Expect(keyring.Set(defaultKeyringService, "PASSWORD", "keyring")).To(Succeed())
+		GinkgoT().Setenv("RELISH_USERNAME", "me@env.example.com")
+		GinkgoT().Setenv("RELISH_PASSWORD", "env")
+
+		creds, err := getCredentials(&Config{NoKeyring: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@env.example.com"))
+		Expect(creds.Password).To(Equal("env"))
+
+		GinkgoT().Setenv("RELISH_NO_KEYRING", "1")
+		creds, err = getCredentials(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@env.example.com"))
+
+		GinkgoT().Setenv("RELISH_PASSWORD", "")
+		_, err = getCredentials(&Config{})
+		Expect(err).To(MatchError(errKeyringDisabled))
+		Expect(err).To(MatchError(ContainSubstring("RELISH_PASSWORD")))
+	})
+
+	It("should read systemd credentials before the environment", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "RELISH_USERNAME"), []byte("me@systemd.example.com\n"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "RELISH_PASSWORD"), []byte("systemd"), 0o600)).To(Succeed())
+		GinkgoT().Setenv("CREDENTIALS_DIRECTORY", dir)
+		GinkgoT().Setenv("RELISH_USERNAME", "me@env.example.com")
+		GinkgoT().Setenv("RELISH_TOTP_SECRET", "JBSWY3DPEHPK3PXP")
+
+		creds, err := getCredentials(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@systemd.example.com"))
+		Expect(creds.Password).To(Equal("systemd"))
+		// Credentials systemd doesn't provide still come from the environment
+		Expect(creds.TOTPSecret).To(Equal("JBSWY3DPEHPK3PXP"))
+
+		// The keyring still comes first
+		Expect(keyring.Set(defaultKeyringService, "PASSWORD", "keyring")).To(Succeed())
+		creds, err = getCredentials(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Password).To(Equal("keyring"))
+	})
+
+	It("should use a session cookie instead of a username and password", func() {
+		GinkgoT().Setenv("RELISH_SESSION_COOKIE", "session=stored")
+
+		// A stored cookie is only used when there is no username and password
+		creds, err := loadCredentials(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*creds).To(Equal(relish.Credentials{SessionCookie: "session=stored"}))
+
+		GinkgoT().Setenv("RELISH_USERNAME", "me@example.com")
+		GinkgoT().Setenv("RELISH_PASSWORD", "secret")
+		creds, err = loadCredentials(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@example.com"))
+		Expect(creds.SessionCookie).To(BeEmpty())
+
+		// --session-cookie always wins
+		creds, err = loadCredentials(&Config{SessionCookie: "session=flag"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*creds).To(Equal(relish.Credentials{SessionCookie: "session=flag"}))
+	})
+
+	It("should not store credentials when the keyring is disabled", func() {
+		login := newLoginCommand(&Config{NoKeyring: true})
+		login.SetIn(strings.NewReader("me@example.com\nsecret\n\n"))
+		login.SetErr(io.Discard)
+		login.SetArgs([]string{})
+		Expect(login.Execute()).To(MatchError(ContainSubstring("keyring is disabled")))
+
+		_, err := keyring.Get(defaultKeyringService, "EMAIL")
+		Expect(err).To(MatchError(keyring.ErrNotFound))
+	})
+
+	It("should require an email and password", func() {
+		login := newLoginCommand(&Config{})
+		login.SetIn(strings.NewReader("\n\n\n"))
+		login.SetErr(io.Discard)
+		login.SetArgs([]string{})
+		Expect(login.Execute()).To(MatchError(ContainSubstring("email and password are required")))
+	})
+})
+
+var _ = Describe("Keyring Timeout", func() {
+	BeforeEach(func() {
+		keyring.MockInit()
+		GinkgoT().Setenv("RELISH_USERNAME", "me@env.example.com")
+		GinkgoT().Setenv("RELISH_PASSWORD", "env")
+		GinkgoT().Setenv("RELISH_TOTP_SECRET", "")
+		GinkgoT().Setenv("RELISH_NO_KEYRING", "")
+		GinkgoT().Setenv("CREDENTIALS_DIRECTORY", "")
+	})
+
+	It("should give up on a keyring that doesn't answer", func() {
+		release := make(chan struct{})
+		defer close(release)
+		hang := func() (string, error) {
+			<-release
+			return "too late", nil
+		}
+
+		var hung atomic.Bool
+		started := time.Now()
+		_, err := withKeyringTimeout(20*time.Millisecond, &hung, hang)
+		Expect(err).To(MatchError(errKeyringTimeout))
+		Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+		Expect(hung.Load()).To(BeTrue())
+
+		// Later lookups don't wait again
+		calls := 0
+		stored := func() (string, error) {
+			calls++
+			return "stored", nil
+		}
+		_, err = withKeyringTimeout(time.Hour, &hung, stored)
+		Expect(err).To(MatchError(errKeyringTimeout))
+		Expect(calls).To(BeZero())
+
+		// Without anywhere to remember it, each lookup asks
+		Expect(withKeyringTimeout(time.Hour, nil, stored)).To(Equal("stored"))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should return what the keyring answers in time", func() {
+		var hung atomic.Bool
+		value, err := withKeyringTimeout(time.Second, &hung, func() (string, error) { return "stored", nil })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("stored"))
+
+		_, err = withKeyringTimeout(time.Second, &hung, func() (string, error) { return "", keyring.ErrNotFound })
+		Expect(err).To(MatchError(keyring.ErrNotFound))
+		Expect(hung.Load()).To(BeFalse())
+	})
+
+	It("should fall back to the environment once the keyring has timed out", func() {
+		Expect(keyring.Set(defaultKeyringService, "EMAIL", "me@keyring.example.com")).To(Succeed())
+		config := &Config{KeyringTimeout: time.Second, keyringHung: new(atomic.Bool)}
+		config.keyringHung.Store(true)
+
+		creds, err := getCredentials(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@env.example.com"))
+
+		GinkgoT().Setenv("RELISH_PASSWORD", "")
+		_, err = getCredentials(config)
+		Expect(err).To(MatchError(ContainSubstring("keyring did not respond in time")))
+
+		// Without a timeout, the keyring is always asked
+		Expect(keyring.Set(defaultKeyringService, "PASSWORD", "keyring")).To(Succeed())
+		creds, err = getCredentials(&Config{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Username).To(Equal("me@keyring.example.com"))
+	})
+
+	It("should ask the keyring again after a reload", func() {
+		Expect(keyring.Set(defaultKeyringService, "IMAP_PASSWORD", "keyring")).To(Succeed())
+		GinkgoT().Setenv("RELISH_IMAP_PASSWORD", "env")
+
+		config := &Config{KeyringTimeout: time.Second, keyringHung: new(atomic.Bool)}
+		config.keyringHung.Store(true)
+		Expect(getIMAPPassword(config)).To(Equal("env"))
+
+		source := &imapSource{config: config}
+		Expect(source.Reload(context.Background())).To(Succeed())
+		Expect(config.IMAP.Password).To(Equal("keyring"))
+		Expect(config.keyringHung.Load()).To(BeFalse())
+	})
+})
+
+var _ = Describe("Several Profiles", func() {
+	It("should give each profile its own state files", func() {
+		Expect(profilePath("state.json", "work")).To(Equal("state-work.json"))
+		Expect(profilePath("/var/lib/relish/history", "home")).To(Equal("/var/lib/relish/history-home"))
+		Expect(profilePath("", "work")).To(BeEmpty())
+
+		config := profileConfig(&Config{
+			Profiles:       []string{"work", "home"},
+			StateFile:      "state.json",
+			ErrorBundleDir: "bundles",
+		}, "work")
+		Expect(config.Profile).To(Equal("work"))
+		Expect(config.Profiles).To(BeEmpty())
+		Expect(config.Incognito).To(BeTrue())
+		Expect(config.StateFile).To(Equal("state-work.json"))
+		Expect(config.HistoryFile).To(BeEmpty())
+		Expect(config.ErrorBundleDir).To(Equal(filepath.Join("bundles", "work")))
+	})
+
+	It("should reject options for a single account", func() {
+		Expect(validateProfiles(&Config{Profiles: []string{"work", "home"}})).To(Succeed())
+		Expect(validateProfiles(&Config{Profiles: []string{"work", "work"}})).To(MatchError(ContainSubstring(`"work" more than once`)))
+		Expect(validateProfiles(&Config{Profiles: []string{"work", ""}})).To(MatchError(ContainSubstring("empty profile name")))
+		Expect(validateProfiles(&Config{Profiles: []string{"work"}, Profile: "home"})).To(MatchError("--profile cannot be used with --profiles"))
+		Expect(validateProfiles(&Config{Profiles: []string{"work"}, TUI: true})).To(MatchError("--tui cannot be used with --profiles"))
+		Expect(validateProfiles(&Config{Profiles: []string{"work"}, Serve: "localhost:8080"})).To(MatchError("--serve cannot be used with --profiles"))
+	})
+
+	It("should mark each line with its profile", func() {
+		var out bytes.Buffer
+		shared := &sharedWriter{w: &out}
+		work := &profileWriter{profile: "work", out: shared}
+		home := &profileWriter{profile: "home", out: shared}
+
+		fmt.Fprint(work, "Out for ")                     //nolint:errcheck
+		fmt.Fprint(home, "{\"status\":\"Preparing\"}\n") //nolint:errcheck
+		fmt.Fprint(work, "Delivery\n{}\n")               //nolint:errcheck
+		fmt.Fprint(home, "not {json\n")                  //nolint:errcheck
+
+		Expect(out.String()).To(Equal("{\"profile\":\"home\",\"status\":\"Preparing\"}\n" +
+			"work: Out for Delivery\n" +
+			"{\"profile\":\"work\"}\n" +
+			"home: not {json\n"))
+	})
+
+	It("should monitor every profile", func() {
+		config := &Config{
+			Source:           sourceSimulate,
+			Profiles:         []string{"work", "home"},
+			Interval:         time.Millisecond,
+			Output:           outputText,
+			MessageTemplate:  "{{ .Status }}",
+			MarkdownTemplate: defaultMarkdownTemplate,
+			ConfirmArrived:   1,
+			OnUnknown:        onUnknownWarn,
+			UnknownThreshold: 3,
+		}
+
+		var stdout bytes.Buffer
+		Expect(runNotifier(config, &stdout)).To(Succeed())
+
+		lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+		Expect(lines).To(HaveLen(6))
+		for _, profile := range []string{"work", "home"} {
+			var seen []string
+			for _, line := range lines {
+				if status, ok := strings.CutPrefix(line, profile+": "); ok {
+					seen = append(seen, status)
+				}
+			}
+			Expect(seen).To(Equal([]string{"Driver Assigned", "Out for Delivery", "Order Arrived"}))
+		}
+	})
+})
+
+var _ = Describe("Status Dashboard", func() {
+	var (
+		events *broker
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		events = newBroker()
+		server = httptest.NewServer(newServeMux(events))
+		DeferCleanup(server.Close)
+	})
+
+	It("should serve the dashboard page", func() {
+		resp, err := http.Get(server.URL + "/")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/html"))
+	})
+
+	It("should stream the latest status and later updates as events", func() {
+		events.publish(relish.OrderInfo{Status: relish.OrderStatusPreparing, Vendor: "Chipotle"}, nil)
+
+		resp, err := http.Get(server.URL + "/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		reader := bufio.NewReader(resp.Body)
+		readEvent := func() map[string]any {
+			line, err := reader.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			_, err = reader.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+
+			var event map[string]any
+			Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)).To(Succeed())
+			return event
+		}
+
+		Expect(readEvent()).To(HaveKeyWithValue("status", "Preparing Your Order"))
+
+		events.publish(relish.OrderInfo{Status: relish.OrderStatusUnknown}, errors.New("timeout"))
+		event := readEvent()
+		Expect(event).To(HaveKeyWithValue("error", "timeout"))
+		Expect(event).To(HaveKey("time"))
+	})
+
+	It("should deliver the final event when shutting down", func() {
+		resp, err := http.Get(server.URL + "/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+
+		events.publish(relish.OrderInfo{Status: relish.OrderStatusArrived}, nil)
+		events.close()
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`"status":"Order Arrived"`))
+	})
+
+	It("should report a bad listen address", func() {
+		_, err := startServer("256.0.0.1:http", events, slog.New(slog.DiscardHandler))
+		Expect(err).To(MatchError(ContainSubstring("failed to start server")))
+	})
+})
+
+var _ = Describe("Failure Notifications", func() {
+	It("should report once when the threshold is reached and again on recovery", func() {
+		tracker := &failureTracker{threshold: 3}
+
+		Expect(tracker.failed()).To(BeFalse())
+		Expect(tracker.failed()).To(BeFalse())
+		Expect(tracker.failed()).To(BeTrue())
+		Expect(tracker.failed()).To(BeFalse())
+		Expect(tracker.succeeded()).To(BeTrue())
+		Expect(tracker.succeeded()).To(BeFalse())
+	})
+
+	It("should not report recovery from failures that were never reported", func() {
+		tracker := &failureTracker{threshold: 3}
+
+		tracker.failed()
+		tracker.failed()
+		Expect(tracker.succeeded()).To(BeFalse())
+		Expect(tracker.failed()).To(BeFalse())
+	})
+
+	It("should never report when disabled", func() {
+		tracker := &failureTracker{}
+
+		for range 5 {
+			Expect(tracker.failed()).To(BeFalse())
+		}
+		Expect(tracker.succeeded()).To(BeFalse())
+	})
+})
+
+var _ = Describe("Request Budget", func() {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	It("should allow ten minutes' worth of requests at once and then space them out", func() {
+		budget := newRequestBudget(60, start)
+
+		for range 10 {
+			Expect(budget.reserve(start)).To(BeZero())
+		}
+		Expect(budget.reserve(start)).To(Equal(time.Minute))
+		Expect(budget.reserve(start)).To(Equal(2 * time.Minute))
+
+		// Both of those have been paid for two minutes later
+		Expect(budget.reserve(start.Add(2 * time.Minute))).To(Equal(time.Minute))
+	})
+
+	It("should refill over time without going over capacity", func() {
+		budget := newRequestBudget(3, start)
+
+		Expect(budget.reserve(start)).To(BeZero())
+		Expect(budget.reserve(start)).To(Equal(20 * time.Minute))
+		Expect(budget.reserve(start.Add(5 * time.Hour))).To(BeZero())
+		Expect(budget.reserve(start.Add(5 * time.Hour))).To(Equal(20 * time.Minute))
+	})
+
+	It("should never wait without a budget", func() {
+		budget := newRequestBudget(0, start)
+		Expect(budget).To(BeNil())
+		Expect(budget.wait(context.Background(), slog.New(slog.DiscardHandler))).To(Succeed())
+	})
+})
+
+var _ = Describe("Arrival Confirmation", func() {
+	It("should confirm an arrival seen by enough checks in a row", func() {
+		tracker := &arrivalTracker{needed: 2}
+
+		Expect(tracker.observe(relish.OrderStatusArrived, nil)).To(BeFalse())
+		Expect(tracker.unconfirmed(relish.OrderStatusArrived)).To(BeTrue())
+		// A half rendered page showed the wrong status
+		Expect(tracker.observe(relish.OrderStatusPreparing, nil)).To(BeFalse())
+		Expect(tracker.observe(relish.OrderStatusArrived, nil)).To(BeFalse())
+		Expect(tracker.observe(relish.OrderStatusUnknown, errors.New("timed out"))).To(BeFalse())
+		Expect(tracker.observe(relish.OrderStatusArrived, nil)).To(BeFalse())
+		Expect(tracker.observe(relish.OrderStatusArrived, nil)).To(BeTrue())
+		Expect(tracker.unconfirmed(relish.OrderStatusArrived)).To(BeFalse())
+	})
+
+	It("should confirm the first arrival by default", func() {
+		tracker := &arrivalTracker{}
+
+		Expect(tracker.unconfirmed(relish.OrderStatusPreparing)).To(BeFalse())
+		Expect(tracker.observe(relish.OrderStatusArrived, nil)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Order Tracking", func() {
+	arrived := relish.OrderInfo{Status: relish.OrderStatusArrived, OrderID: "A100"}
+	placed := relish.OrderInfo{Status: relish.OrderStatusPlaced, OrderID: "B200"}
+	empty := fmt.Errorf("check failed: %w: %w", relish.ErrStatusNotFound, relish.ErrStatusMissing)
+
+	It("should compare every check with the last one", func() {
+		tracker := &orderTracker{}
+		tracker.record(arrived)
+		tracker.failed(empty)
+
+		Expect(tracker.previous(placed)).To(Equal(relish.OrderStatusArrived))
+	})
+
+	It("should start over for a new order with --continue-after-arrival", func() {
+		tracker := &orderTracker{continuing: true}
+		tracker.record(arrived)
+
+		Expect(tracker.previous(arrived)).To(Equal(relish.OrderStatusArrived))
+		Expect(tracker.previous(placed)).To(BeEmpty())
+	})
+
+	It("should start over once the schedule is empty with --continue-after-arrival", func() {
+		tracker := &orderTracker{continuing: true}
+		tracker.record(relish.OrderInfo{Status: relish.OrderStatusArrived})
+		tracker.failed(errors.New("timed out"))
+		Expect(tracker.previous(relish.OrderInfo{Status: relish.OrderStatusArrived})).To(Equal(relish.OrderStatusArrived))
+
+		tracker.failed(empty)
+		Expect(tracker.previous(relish.OrderInfo{Status: relish.OrderStatusArrived})).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Waiting Reminders", func() {
+	start := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	It("should remind at the configured cadence with a summary of the wait", func() {
+		tracker := &waitingTracker{every: 5 * time.Minute}
+
+		for i := range 10 {
+			now := start.Add(time.Duration(i) * time.Minute)
+			tracker.checked(now)
+			Expect(tracker.due(now)).To(Equal(i == 5), "minute %d", i)
+		}
+
+		Expect(tracker.message(relish.OrderStatusPreparing, start.Add(10*time.Minute))).
+			To(Equal("relish-notifier: still waiting, order status: Preparing Your Order (checked 10 times over 10m0s)"))
+	})
+
+	It("should never remind when disabled", func() {
+		tracker := &waitingTracker{}
+
+		for i := range 10 {
+			now := start.Add(time.Duration(i) * time.Hour)
+			tracker.checked(now)
+			Expect(tracker.due(now)).To(BeFalse())
+		}
+	})
+})
+
+var _ = Describe("Doctor", func() {
+	It("should report each diagnostic and fail if any did", func() {
+		var out bytes.Buffer
+		err := runDiagnostics(context.Background(), &out, []diagnostic{
+			{"credentials", func(context.Context) (string, error) { return "found for me@example.com", nil }},
+			{"browser", func(context.Context) (string, error) { return "", errors.New("no chrome here") }},
+			{"website", func(context.Context) (string, error) { return "needs a working browser", errSkipped }},
+		})
+
+		Expect(err).To(MatchError("1 of 3 checks failed"))
+		Expect(out.String()).To(Equal("PASS  credentials: found for me@example.com\n" +
+			"FAIL  browser: no chrome here\n" +
+			"SKIP  website: needs a working browser\n"))
+	})
+
+	It("should check the credentials and send a test notification to each target", func() {
+		keyring.MockInit()
+		GinkgoT().Setenv("RELISH_NO_KEYRING", "")
+		GinkgoT().Setenv("CREDENTIALS_DIRECTORY", "")
+		GinkgoT().Setenv("RELISH_IMAP_PASSWORD", "secret")
+		out := filepath.Join(GinkgoT().TempDir(), "out")
+		config := &Config{
+			Source:           sourceIMAP,
+			Command:          `printf '%s' "$RELISH_EVENT" > ` + out,
+			MessageTemplate:  defaultMessageTemplate,
+			MarkdownTemplate: defaultMarkdownTemplate,
+		}
+
+		diagnostics, cleanup, err := doctorDiagnostics(config, slog.New(slog.DiscardHandler))
+		Expect(err).NotTo(HaveOccurred())
+		defer cleanup()
+
+		var report bytes.Buffer
+		Expect(runDiagnostics(context.Background(), &report, diagnostics)).To(Succeed())
+		Expect(report.String()).To(Equal("PASS  IMAP password: found\nPASS  notify command: sent a test notification\n"))
+		Expect(os.ReadFile(out)).To(Equal([]byte(eventTest)))
+	})
+
+	It("should accept the same flags as a normal run", func() {
+		config := &Config{}
+		root := &cobra.Command{Use: "relish-notifier"}
+		root.Flags().StringVar(&config.Source, "source", sourceBrowser, "")
+		doctor := newDoctorCommand(config, root)
+
+		Expect(doctor.ParseFlags([]string{"--source", sourceSimulate})).To(Succeed())
+		Expect(config.Source).To(Equal(sourceSimulate))
+	})
+})
+
+var _ = Describe("Replay", func() {
+	var dir string
+
+	record := func(name string, recording relish.Recording, html string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(path, 0o700)).To(Succeed())
+		result, err := json.Marshal(recording)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(path, relish.RecordingResult), result, 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, relish.RecordingHTML), []byte(html), 0o600)).To(Succeed())
+	}
+
+	// replay reads the status from the page text, the way a working selector would
+	replay := func(_ context.Context, html string) (relish.OrderInfo, error) {
+		if html == "" {
+			return relish.OrderInfo{Status: relish.OrderStatusUnknown}, relish.ErrStatusNotFound
+		}
+		return relish.OrderInfo{Status: relish.OrderStatus(html)}, nil
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should report each recorded check and fail if any changed", func() {
+		record("0001", relish.Recording{Info: relish.OrderInfo{Status: relish.OrderStatusPlaced}}, string(relish.OrderStatusPlaced))
+		record("0002", relish.Recording{Error: "status not found"}, "")
+		record("0003", relish.Recording{Info: relish.OrderInfo{Status: relish.OrderStatusArrived}}, "Lost in Space")
+
+		var out bytes.Buffer
+		err := replayRecordings(context.Background(), &out, dir, replay)
+		Expect(err).To(MatchError("1 of 3 recorded checks no longer match"))
+		Expect(out.String()).To(Equal(fmt.Sprintf("PASS  0001: %s\n", relish.OrderStatusPlaced) +
+			"PASS  0002: failed as recorded\n" +
+			fmt.Sprintf("FAIL  0003: recorded %s, replay found Lost in Space\n", relish.OrderStatusArrived)))
+	})
+
+	It("should read each schedule page in a HAR file and record it", func() {
+		har := filepath.Join(GinkgoT().TempDir(), "capture.har")
+		Expect(os.WriteFile(har, []byte(`{"log": {"entries": [
+			{"startedDateTime": "2025-06-01T12:00:00Z", "request": {"url": "https://relish.ezcater.com/schedule"},
+			 "response": {"status": 200, "content": {"mimeType": "text/html", "text": "Order Placed"}}},
+			{"startedDateTime": "2025-06-01T12:10:00Z", "request": {"url": "https://relish.ezcater.com/schedule"},
+			 "response": {"status": 200, "content": {"mimeType": "text/html", "text": ""}}}
+		]}}`), 0o600)).To(Succeed())
+
+		var out bytes.Buffer
+		err := replayHAR(context.Background(), &out, har, dir, replay)
+		Expect(err).To(MatchError("1 of 2 captured pages gave no order status"))
+		Expect(out.String()).To(Equal("OK    1 (2025-06-01T12:00:00Z): Order Placed\n" +
+			"FAIL  2 (2025-06-01T12:10:00Z): " + relish.ErrStatusNotFound.Error() + "\n"))
+
+		// The recordings replay the same way
+		out.Reset()
+		Expect(replayRecordings(context.Background(), &out, dir, replay)).To(Succeed())
+		Expect(out.String()).To(Equal("PASS  0001: Order Placed\nPASS  0002: failed as recorded\n"))
+	})
+
+	It("should describe what a replayed check found", func() {
+		Expect(describeReplay(relish.OrderInfo{Status: relish.OrderStatusPlaced, OrderID: "A100", Vendor: "Tasty Tacos", ETA: "12:30 PM"})).
+			To(Equal("Order Placed, order A100, from Tasty Tacos, ETA 12:30 PM"))
+	})
+
+	It("should fail when there is nothing to replay", func() {
+		err := replayRecordings(context.Background(), io.Discard, dir, replay)
+		Expect(err).To(MatchError(ContainSubstring("no recorded checks found")))
+	})
+
+	DescribeTable("compareReplay function",
+		func(recording relish.Recording, info relish.OrderInfo, err error, expected string) {
+			Expect(compareReplay(recording, info, err)).To(Equal(expected))
+		},
+		Entry("same status", relish.Recording{Info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+			relish.OrderInfo{Status: relish.OrderStatusPlaced}, nil, ""),
+		Entry("both failed", relish.Recording{Error: "timeout"},
+			relish.OrderInfo{Status: relish.OrderStatusUnknown}, errors.New("status not found"), ""),
+		Entry("no longer fails", relish.Recording{Error: "timeout"},
+			relish.OrderInfo{Status: relish.OrderStatusPlaced}, nil, `recorded error "timeout", replay found `+string(relish.OrderStatusPlaced)),
+		Entry("now fails", relish.Recording{Info: relish.OrderInfo{Status: relish.OrderStatusPlaced}},
+			relish.OrderInfo{Status: relish.OrderStatusUnknown}, errors.New("status not found"),
+			"recorded "+string(relish.OrderStatusPlaced)+", replay failed: status not found"),
+		Entry("different ETA", relish.Recording{Info: relish.OrderInfo{Status: relish.OrderStatusPlaced, ETA: "12:45 PM"}},
+			relish.OrderInfo{Status: relish.OrderStatusPlaced}, nil,
+			fmt.Sprintf("recorded %+v, replay found %+v",
+				relish.OrderInfo{Status: relish.OrderStatusPlaced, ETA: "12:45 PM"}, relish.OrderInfo{Status: relish.OrderStatusPlaced})),
+	)
+})
+
+var _ = Describe("Inspect", func() {
+	It("should report what the selector matched", func() {
+		var highlighted bool
+		inspect := func(ctx context.Context, selector string, highlight bool) (relish.SelectorMatch, error) {
+			Expect(selector).To(Equal(".order-status"))
+			highlighted = highlight
+			return relish.SelectorMatch{URL: "https://example.com/schedule", Count: 2, Text: "Order Placed"}, nil
+		}
+
+		output := &bytes.Buffer{}
+		Expect(inspectSelector(context.Background(), output, ".order-status", true, inspect)).To(Succeed())
+		Expect(highlighted).To(BeTrue())
+		Expect(output.String()).To(Equal("page:     https://example.com/schedule\n" +
+			"selector: .order-status\n" +
+			"matches:  2\n" +
+			"text:     \"Order Placed\"\n"))
+	})
+
+	It("should fail when the selector matches nothing", func() {
+		inspect := func(ctx context.Context, selector string, highlight bool) (relish.SelectorMatch, error) {
+			return relish.SelectorMatch{URL: "https://example.com/schedule"}, nil
+		}
+
+		output := &bytes.Buffer{}
+		err := inspectSelector(context.Background(), output, ".missing", false, inspect)
+		Expect(err).To(MatchError(ContainSubstring(`".missing" matches nothing`)))
+		Expect(output.String()).To(ContainSubstring("matches:  0\n"))
+		Expect(output.String()).NotTo(ContainSubstring("text:"))
+	})
+
+	It("should need the browser source", func() {
+		_, _, err := openInspector(context.Background(), &Config{Source: sourceIMAP}, slog.New(slog.DiscardHandler))
+		Expect(err).To(MatchError(ContainSubstring("--source browser")))
+	})
+})
+
+var _ = Describe("Control Socket", func() {
+	var (
+		path    string
+		control *controller
+		notices []relish.OrderInfo
+		stop    func()
+	)
+
+	BeforeEach(func() {
+		// Unix socket paths are limited in length, so avoid the long GinkgoT().TempDir()
+		dir, err := os.MkdirTemp("", "relish")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		path = filepath.Join(dir, "control.sock")
+
+		notices = nil
+		control = newController(make(chan struct{}, 1), func(_ context.Context, info relish.OrderInfo) error {
+			notices = append(notices, info)
+			return nil
+		}, slog.New(slog.DiscardHandler))
+
+		stop, err = startControlSocket(context.Background(), path, control)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { stop() })
+	})
+
+	It("should report that no checks have completed", func() {
+		resp, err := sendControlRequest(path, controlRequest{Command: controlStatus})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.OK).To(BeFalse())
+		Expect(resp.Error).To(ContainSubstring("no checks"))
+	})
+
+	It("should report the latest status", func() {
+		control.record(newCheckResult(relish.OrderInfo{Status: relish.OrderStatusPreparing, Vendor: "Tacos"}, "", nil))
+
+		resp, err := sendControlRequest(path, controlRequest{Command: controlStatus})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.OK).To(BeTrue())
+		Expect(resp.Result.Status).To(Equal(relish.OrderStatusPreparing))
+		Expect(resp.Result.Vendor).To(Equal("Tacos"))
+	})
+
+	It("should wake the main loop to check now", func() {
+		for range 2 {
+			resp, err := sendControlRequest(path, controlRequest{Command: controlCheck})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.OK).To(BeTrue())
+		}
+		Expect(control.checkNow).To(HaveLen(1))
+	})
+
+	It("should send a test notification about the latest status", func() {
+		control.record(newCheckResult(relish.OrderInfo{Status: relish.OrderStatusPlaced}, "", nil))
+
+		resp, err := sendControlRequest(path, controlRequest{Command: controlTestNotify})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.OK).To(BeTrue())
+		Expect(notices).To(ConsistOf(relish.OrderInfo{Status: relish.OrderStatusPlaced}))
+	})
+
+	It("should not block when a check is already pending", func() {
+		checkNow := make(chan struct{}, 1)
+		requestCheck(checkNow)
+		requestCheck(checkNow)
+		Expect(checkNow).To(HaveLen(1))
+	})
+
+	It("should reject unknown commands", func() {
+		resp, err := sendControlRequest(path, controlRequest{Command: "self-destruct"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.OK).To(BeFalse())
+		Expect(resp.Error).To(ContainSubstring("unknown command"))
+	})
+
+	It("should refuse a socket that is already in use", func() {
+		_, err := startControlSocket(context.Background(), path, control)
+		Expect(err).To(MatchError(ContainSubstring("in use")))
+	})
+
+	It("should replace a stale socket", func() {
+		stop()
+		listener, err := net.Listen("unix", path)
+		Expect(err).NotTo(HaveOccurred())
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		Expect(listener.Close()).To(Succeed())
+
+		stop, err = startControlSocket(context.Background(), path, control)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject oversized messages", func() {
+		var buf bytes.Buffer
+		buf.Write([]byte{0xff, 0xff, 0xff, 0xff})
+		var req controlRequest
+		Expect(readControlMessage(&buf, &req)).To(MatchError(ContainSubstring("too large")))
+	})
+})
+
+var _ = Describe("Time Zones", func() {
+	It("should use the local time zone by default", func() {
+		Expect(loadTimeZone("")).To(Equal(time.Local))
+	})
+
+	It("should load IANA time zones", func() {
+		loc, err := loadTimeZone("Europe/Paris")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loc.String()).To(Equal("Europe/Paris"))
+	})
+
+	It("should reject unknown time zones", func() {
+		_, err := loadTimeZone("Mars/Olympus_Mons")
+		Expect(err).To(MatchError(ContainSubstring(`invalid time zone "Mars/Olympus_Mons"`)))
+	})
+
+	It("should leave the ETA time empty when there is no ETA", func() {
+		data := newMessageData(relish.OrderInfo{Status: relish.OrderStatusPlaced}, time.Now())
+		Expect(data.ETATime.IsZero()).To(BeTrue())
+		Expect(messageEnv(data, "")).To(ContainElement("RELISH_ETA_TIME="))
+	})
+
+	It("should put the ETA on the day and in the time zone it was observed in", func() {
+		paris, err := time.LoadLocation("Europe/Paris")
+		Expect(err).NotTo(HaveOccurred())
+		now := time.Date(2024, 3, 15, 23, 30, 0, 0, time.UTC).In(paris)
+
+		data := newMessageData(relish.OrderInfo{Status: relish.OrderStatusOutForDelivery, ETA: "12:45 PM"}, now)
+		Expect(data.ETATime).To(Equal(time.Date(2024, 3, 16, 12, 45, 0, 0, paris)))
+		Expect(data.Time.Location()).To(Equal(paris))
+	})
+
+	It("should not change the process time zone", func() {
+		local := time.Local
+		config := &Config{}
+		config.Location = time.UTC
+		Expect(config.now().Location()).To(Equal(time.UTC))
+		Expect(time.Local).To(BeIdenticalTo(local))
+	})
+})
+
+var _ = Describe("Terminal Display", func() {
+	var (
+		out     *bytes.Buffer
+		display *statusDisplay
+		now     time.Time
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		display = newStatusDisplay(out, func(time.Time) time.Duration { return time.Minute }, time.UTC)
+		now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	It("should show that no check has happened yet", func() {
+		Expect(display.render(now)).To(ContainSubstring("Status:      Unknown"))
+		Expect(display.render(now)).To(ContainSubstring("Last check:  never"))
+	})
+
+	It("should show the status and count down to the next check", func() {
+		display.update(relish.OrderInfo{Status: relish.OrderStatusPreparing, Vendor: "Tasty Tacos", ETA: "12:30 PM"}, now)
+		Expect(out.String()).To(HavePrefix(clearScreen))
+
+		text := display.render(now.Add(15 * time.Second))
+		Expect(text).To(ContainSubstring("Status:      Preparing Your Order"))
+		Expect(text).To(ContainSubstring("Vendor:      Tasty Tacos"))
+		Expect(text).To(ContainSubstring("ETA:         12:30 PM"))
+		Expect(text).To(ContainSubstring("Last check:  12:00:00 (15s ago)"))
+		Expect(text).To(ContainSubstring("Next check:  in 45s"))
+	})
+
+	It("should not count down once the order has arrived", func() {
+		display.update(relish.OrderInfo{Status: relish.OrderStatusArrived}, now)
+		Expect(display.render(now)).NotTo(ContainSubstring("Next check"))
+	})
+
+	It("should show the driver while the order is on the way", func() {
+		display.update(relish.OrderInfo{Status: relish.OrderStatusPreparing, Driver: "Sam", DriverLocation: "2 stops away"}, now)
+		Expect(display.render(now)).To(ContainSubstring("Driver:      Sam (2 stops away)"))
+	})
+
+	It("should show recent warnings and errors from the log", func() {
+		logger := slog.New(display.Handler()).With("attempt", 1)
+		logger.Info("checking again")
+		for i := range displayMaxErrors + 2 {
+			logger.Error("failed to check order status", "error", fmt.Sprintf("timeout %d", i))
+		}
+
+		text := display.render(now)
+		Expect(text).NotTo(ContainSubstring("checking again"))
+		Expect(text).NotTo(ContainSubstring("timeout 1\n"))
+		Expect(text).To(ContainSubstring("failed to check order status attempt=1 error=timeout 6"))
+		Expect(strings.Count(text, "failed to check order status")).To(Equal(displayMaxErrors))
+	})
+
+	It("should draw one last time when stopped", func() {
+		go display.run(context.Background())
+		display.stop()
+		display.stop()
+
+		Expect(strings.Count(out.String(), clearScreen)).To(Equal(1))
+	})
+})
+
+var _ = Describe("Markup Baseline", func() {
+	card := []string{
+		"div.schedule-card",
+		"div.schedule-card>div",
+		"div.schedule-card>div.schedule-card-label",
+		"div.schedule-card>div.schedule-card-vendor",
+	}
+
+	var (
+		logs  bytes.Buffer
+		path  string
+		watch *markupWatch
+	)
+
+	BeforeEach(func() {
+		logs.Reset()
+		path = filepath.Join(GinkgoT().TempDir(), "state.json")
+		watch = &markupWatch{state: &State{}, path: path, logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	})
+
+	It("should save the first markup seen with a known status", func() {
+		watch.observe(relish.NewMarkup(card[:1]), relish.OrderStatusUnknown)
+		Expect(watch.state.MarkupBaseline).To(BeNil())
+
+		markup := relish.NewMarkup(card)
+		watch.observe(markup, relish.OrderStatusPlaced)
+		Expect(logs.String()).To(ContainSubstring("saved the schedule page markup as the baseline"))
+
+		state, err := loadState(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.MarkupBaseline).To(Equal(&markup))
+	})
+
+	It("should warn once when the markup changes significantly", func() {
+		watch.observe(relish.NewMarkup(card), relish.OrderStatusPlaced)
+
+		// A driver's name appearing isn't a change to the site
+		logs.Reset()
+		watch.observe(relish.NewMarkup(append(slices.Clone(card), "div.schedule-card>div.schedule-card-driver-name")), relish.OrderStatusDriverAssigned)
+		Expect(logs.String()).To(BeEmpty())
+
+		redesigned := relish.NewMarkup([]string{"article.order", "article.order>span.order-status", "div.schedule-card>div.schedule-card-label"})
+		watch.observe(redesigned, relish.OrderStatusPlaced)
+		Expect(logs.String()).To(ContainSubstring("level=WARN"))
+		Expect(logs.String()).To(ContainSubstring("selectors may need updating"))
+		Expect(logs.String()).To(ContainSubstring("similarity=17%"))
+
+		logs.Reset()
+		watch.observe(redesigned, relish.OrderStatusPlaced)
+		Expect(logs.String()).To(BeEmpty())
+	})
+
+	It("should replace the baseline with --markup-baseline", func() {
+		watch.state.MarkupBaseline = &relish.Markup{Hash: "0123456789abcdef"}
+		watch.update = true
+
+		markup := relish.NewMarkup(card)
+		watch.observe(markup, relish.OrderStatusUnknown)
+		Expect(watch.state.MarkupBaseline).To(Equal(&markup))
+
+		// Only the first check of the run replaces it
+		watch.observe(relish.NewMarkup(card[:2]), relish.OrderStatusPlaced)
+		Expect(watch.state.MarkupBaseline).To(Equal(&markup))
+	})
+})
+
+var _ = Describe("PID File", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "relish.pid")
+	})
+
+	It("should write our PID and remove it when done", func() {
+		remove, err := writePIDFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(path)).To(Equal([]byte(strconv.Itoa(os.Getpid()) + "\n")))
+
+		remove()
+		Expect(path).NotTo(BeAnExistingFile())
+	})
+
+	It("should refuse to replace the PID file of a running process", func() {
+		cmd := exec.Command("sleep", "10")
+		Expect(cmd.Start()).To(Succeed())
+		DeferCleanup(func() {
+			cmd.Process.Kill() //nolint:errcheck
+			cmd.Wait()         //nolint:errcheck
+		})
+		Expect(os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0o644)).To(Succeed())
+
+		_, err := writePIDFile(path)
+		Expect(err).To(MatchError(ContainSubstring("already running")))
+	})
+
+	It("should replace a stale PID file", func() {
+		cmd := exec.Command("true")
+		Expect(cmd.Run()).To(Succeed())
+		Expect(os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0o644)).To(Succeed())
+
+		remove, err := writePIDFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer remove()
+		Expect(readPIDFile(path)).To(Equal(os.Getpid()))
+	})
+
+	It("should leave a PID file written by another process", func() {
+		remove, err := writePIDFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path, []byte("1\n"), 0o644)).To(Succeed())
+
+		remove()
+		Expect(path).To(BeAnExistingFile())
+	})
+})
+
+// fakeCapturer is a StatusSource that can capture its page
+type fakeCapturer struct {
+	fakeSource
+}
+
+func (f *fakeCapturer) Capture(ctx context.Context) (string, []byte, error) {
+	return "<html>lunch</html>", []byte("png"), nil
+}
+
+var _ = Describe("Error Bundles", func() {
+	It("should keep only the most recent log lines", func() {
+		ring := newLogRing(3)
+		logger := slog.New(ring.Handler(slog.DiscardHandler, nil))
+		for i := range 5 {
+			logger.Debug("line", "n", i)
+		}
+
+		lines := ring.Lines()
+		Expect(lines).To(HaveLen(3))
+		for i, line := range lines {
+			Expect(line).To(HaveSuffix(fmt.Sprintf("msg=line n=%d", i+2)))
+		}
+	})
+
+	It("should pass records on at the level of the handler it wraps", func() {
+		var out bytes.Buffer
+		ring := newLogRing(10)
+		logger := slog.New(ring.Handler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn}), nil)).With("run", 1)
+
+		logger.Debug("hidden")
+		logger.Warn("shown")
+
+		Expect(out.String()).To(ContainSubstring("msg=shown run=1"))
+		Expect(out.String()).NotTo(ContainSubstring("hidden"))
+		Expect(ring.Lines()).To(HaveLen(2))
+		Expect(ring.Lines()[0]).To(ContainSubstring("msg=hidden run=1"))
+	})
+
+	DescribeTable("isFatal function",
+		func(err error, fatal bool) {
+			Expect(isFatal(err)).To(Equal(fatal))
+		},
+		Entry("no error", nil, false),
+		Entry("order cancelled", exitCodeError{code: 2}, false),
+		Entry("maximum checks", exitCodeError{code: exitMaxChecks}, false),
+		Entry("unknown status", exitCodeError{code: exitUnknownStatus, err: errors.New("unknown")}, true),
+		Entry("failed check", errors.New("failed to check order status"), true),
+	)
+
+	It("should zip the error, logs, page, and configuration without secrets", func() {
+		dir := GinkgoT().TempDir()
+		ring := newLogRing(10)
+		logger := slog.New(ring.Handler(slog.DiscardHandler, nil))
+		logger.Info("checking")
+		config := &Config{ErrorBundleDir: dir, SlackWebhook: "https://hooks.slack.com/secret"}
+
+		writeErrorBundle(context.Background(), errors.New("browser stopped responding"), config, ring, &fakeCapturer{}, logger)
+
+		paths, err := filepath.Glob(filepath.Join(dir, "relish-notifier-error-*.zip"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(HaveLen(1))
+
+		archive, err := zip.OpenReader(paths[0])
+		Expect(err).NotTo(HaveOccurred())
+		defer archive.Close() //nolint:errcheck
+
+		files := map[string]string{}
+		for _, f := range archive.File {
+			r, err := f.Open()
+			Expect(err).NotTo(HaveOccurred())
+			data, err := io.ReadAll(r)
+			Expect(err).NotTo(HaveOccurred())
+			files[f.Name] = string(data)
+		}
+
+		Expect(files).To(HaveKeyWithValue("error.txt", "browser stopped responding\n"))
+		Expect(files).To(HaveKeyWithValue("page.html", "<html>lunch</html>"))
+		Expect(files).To(HaveKeyWithValue("screenshot.png", "png"))
+		Expect(files).To(HaveKeyWithValue("version.txt", ContainSubstring("relish-notifier")))
+		Expect(files).To(HaveKeyWithValue("log.txt", ContainSubstring("msg=checking")))
+		Expect(files).To(HaveKeyWithValue("config.json", ContainSubstring(redactedConfig)))
+		Expect(files["config.json"]).NotTo(ContainSubstring("secret"))
+	})
+
+	It("should not write a bundle when the run ends normally", func() {
+		dir := GinkgoT().TempDir()
+		config := &Config{ErrorBundleDir: dir}
+
+		writeErrorBundle(context.Background(), exitCodeError{code: 2}, config, newLogRing(10), nil, slog.New(slog.DiscardHandler))
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
 	})
 })
@@ -0,0 +1,89 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"relish-notifier/relish"
+)
+
+// markupChangeThreshold is the similarity to the baseline below which a schedule card
+// counts as changed. A card gains and loses a few elements as an order progresses, such
+// as the driver's name, so small differences are expected.
+const markupChangeThreshold = 0.75
+
+// markupWatch compares the markup of the schedule page after each check with the baseline
+// in the state file, to warn that the site has changed before the selectors stop working
+type markupWatch struct {
+	state *State
+	path  string
+	// update replaces the baseline with the markup of the next check, for --markup-baseline
+	update bool
+	// warned is the hash of the markup last warned about, so that a change is only
+	// reported once
+	warned string
+	logger *slog.Logger
+}
+
+// observe compares markup, read from the page after a check that found status, with the
+// baseline. The first markup seen with a known status becomes the baseline, unless there
+// already is one.
+func (w *markupWatch) observe(markup relish.Markup, status relish.OrderStatus) {
+	baseline := w.state.MarkupBaseline
+
+	switch {
+	case w.update, baseline == nil && status != relish.OrderStatusUnknown:
+		w.update = false
+		w.state.MarkupBaseline = &markup
+		if err := w.state.save(w.path); err != nil {
+			w.logger.Warn("failed to save state", "error", err)
+		}
+		w.logger.Info("saved the schedule page markup as the baseline", "markup", markup.Hash, "elements", len(markup.Elements))
+		return
+	case baseline == nil, baseline.Hash == markup.Hash:
+		return
+	}
+
+	similarity := baseline.Similarity(markup)
+	attrs := []any{"baseline", baseline.Hash, "markup", markup.Hash, "similarity", fmt.Sprintf("%.0f%%", similarity*100)}
+	if similarity >= markupChangeThreshold || markup.Hash == w.warned {
+		w.logger.Debug("schedule page markup differs from the baseline", attrs...)
+		return
+	}
+
+	w.warned = markup.Hash
+	w.logger.Warn("schedule page markup has changed since the baseline, so the selectors may need updating; "+
+		"try them with the inspect command, then run with --markup-baseline to accept the new markup", attrs...)
+}
+
+// checkMarkup reads the markup of the schedule page after a check that found status, and
+// passes it to the markupWatch
+func (b *browserSource) checkMarkup(ctx context.Context, status relish.OrderStatus) {
+	markup, err := b.ScheduleMarkup(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.logger.Debug("failed to read schedule page markup", "error", err)
+		}
+		return
+	}
+	b.markup.observe(markup, status)
+}
@@ -0,0 +1,201 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+const defaultMessageTemplate string = "order {{ with .Vendor }}from {{ . }} {{ end }}status: {{ .Status }}{{ with .ETA }} (ETA {{ . }}){{ end }}" + driverTemplate
+
+// defaultMarkdownTemplate is used for targets that render markdown, and highlights the status
+const defaultMarkdownTemplate string = "order {{ with .Vendor }}from {{ . }} {{ end }}status: *{{ .Status }}*{{ with .ETA }} (ETA {{ . }}){{ end }}" + driverTemplate
+
+// driverTemplate describes the delivery driver, when the site shows one
+const driverTemplate string = "{{ with .Driver }}, driver {{ . }}{{ with $.DriverLocation }} is {{ . }}{{ end }}{{ end }}"
+
+// Events that cause a notification
+const (
+	eventStatus   = "status"
+	eventFailure  = "failure"
+	eventRecovery = "recovery"
+	eventTest     = "test"
+	eventError    = "error"
+	eventWaiting  = "waiting"
+	eventUnknown  = "unknown"
+)
+
+// MessageData is the value passed to the message template
+type MessageData struct {
+	relish.OrderInfo
+	Time time.Time
+	// ETATime is the estimated arrival time on the day of Time, or zero if there is no ETA
+	ETATime  time.Time
+	Hostname string
+	// Event is why the notification was sent: a notable status, a failed check, checks failing
+	// or recovering, a reminder that the order is still on its way, or a test
+	Event string
+}
+
+// newMessageData builds template data for the given order information, observed at now.
+// Times in the data are in now's time zone.
+func newMessageData(info relish.OrderInfo, now time.Time) MessageData {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	data := MessageData{
+		OrderInfo: info,
+		Time:      now,
+		Hostname:  hostname,
+		Event:     eventStatus,
+	}
+	data.ETATime = etaTime(info.ETA, data.Time)
+	return data
+}
+
+// etaTime converts an ETA to a time on the day of now, or returns zero if there is no valid ETA
+func etaTime(eta string, now time.Time) time.Time {
+	if eta == "" {
+		return time.Time{}
+	}
+	t, err := relish.ETATime(eta, now)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// loadTimeZone returns the named IANA time zone, or the local zone if name is empty
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// parseMessageTemplate parses the user supplied message template
+func parseMessageTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderMessage executes the message template against the provided data
+func renderMessage(tmpl *template.Template, data MessageData) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// ExecData is the value passed to --exec-arg templates
+type ExecData struct {
+	MessageData
+	// Message is the rendered --message-template
+	Message string
+}
+
+// parseExecArgs parses the argument templates given with --exec-arg
+func parseExecArgs(args []string) ([]*template.Template, error) {
+	tmpls := make([]*template.Template, 0, len(args))
+	for i, arg := range args {
+		tmpl, err := template.New(fmt.Sprintf("exec-arg-%d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse exec argument %q: %w", arg, err)
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls, nil
+}
+
+// renderExecArgs executes the argument templates, producing one argument per template
+func renderExecArgs(tmpls []*template.Template, data MessageData, message string) ([]string, error) {
+	args := make([]string, 0, len(tmpls))
+	for _, tmpl := range tmpls {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, ExecData{MessageData: data, Message: message}); err != nil {
+			return nil, fmt.Errorf("failed to render exec argument: %w", err)
+		}
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+// messagePayload is the JSON description of a notification given to --command on stdin
+type messagePayload struct {
+	checkResult
+	ETATime  time.Time `json:"eta_time,omitzero"`
+	Event    string    `json:"event"`
+	Hostname string    `json:"hostname"`
+	Time     time.Time `json:"time"`
+}
+
+// messageJSON encodes a notification as JSON for external commands
+func messageJSON(data MessageData, message string) ([]byte, error) {
+	payload, err := json.Marshal(messagePayload{
+		checkResult: newCheckResult(data.OrderInfo, message, nil),
+		ETATime:     data.ETATime,
+		Event:       data.Event,
+		Hostname:    data.Hostname,
+		Time:        data.Time,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return payload, nil
+}
+
+// messageEnv returns the environment variables describing a notification for use by external commands
+func messageEnv(data MessageData, message string) []string {
+	return []string{
+		"RELISH_MESSAGE=" + message,
+		"RELISH_STATUS=" + data.Status.String(),
+		"RELISH_ETA=" + data.ETA,
+		"RELISH_VENDOR=" + data.Vendor,
+		"RELISH_DRIVER=" + data.Driver,
+		"RELISH_DRIVER_LOCATION=" + data.DriverLocation,
+		"RELISH_TIME=" + data.Time.Format(time.RFC3339),
+		"RELISH_EVENT=" + data.Event,
+		"RELISH_ETA_TIME=" + formatTime(data.ETATime),
+	}
+}
+
+// formatTime formats t as RFC 3339, or returns an empty string if t is zero
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,92 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// statsdPrefix is prepended to the name of every metric sent to StatsD
+const statsdPrefix = "relish_notifier."
+
+// Metrics records measurements of each check for a monitoring system
+type Metrics interface {
+	// Check records a check that took duration and failed with err, if it isn't nil
+	Check(duration time.Duration, err error)
+	// Close releases any resources held by the Metrics
+	Close() error
+}
+
+// newMetrics returns the Metrics selected by the configuration, which record nothing
+// unless --statsd-addr is set
+func newMetrics(config *Config, logger *slog.Logger) (Metrics, error) {
+	if config.StatsdAddr == "" {
+		return noMetrics{}, nil
+	}
+	return newStatsdMetrics(config.StatsdAddr, logger)
+}
+
+// noMetrics discards all measurements
+type noMetrics struct{}
+
+func (noMetrics) Check(time.Duration, error) {}
+func (noMetrics) Close() error               { return nil }
+
+// statsdMetrics sends measurements to a StatsD server over UDP
+type statsdMetrics struct {
+	conn   net.Conn
+	logger *slog.Logger
+}
+
+// newStatsdMetrics creates Metrics that send to the StatsD server at addr (host:port)
+func newStatsdMetrics(addr string, logger *slog.Logger) (*statsdMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD at %s: %w", addr, err)
+	}
+	return &statsdMetrics{conn: conn, logger: logger}, nil
+}
+
+// Check counts the check, and the failure if there was one, and records its duration
+func (m *statsdMetrics) Check(duration time.Duration, err error) {
+	lines := []string{
+		statsdPrefix + "checks:1|c",
+		fmt.Sprintf("%scheck_duration:%d|ms", statsdPrefix, duration.Milliseconds()),
+	}
+	if err != nil {
+		lines = append(lines, statsdPrefix+"failures:1|c")
+	}
+	m.send(lines)
+}
+
+// send writes lines to the server in a single packet. StatsD doesn't answer, so a lost
+// packet only costs a data point and is not worth more than a debug message.
+func (m *statsdMetrics) send(lines []string) {
+	if _, err := m.conn.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		m.logger.Debug("failed to send metrics", "error", err)
+	}
+}
+
+func (m *statsdMetrics) Close() error {
+	return m.conn.Close()
+}
@@ -0,0 +1,481 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"relish-notifier/relish"
+)
+
+// messageFormat is the markup understood by a notification target
+type messageFormat string
+
+const (
+	// formatPlain is unadorned text, for desktop notifications, commands, and the like
+	formatPlain messageFormat = "plain"
+	// formatMarkdown is Slack style markdown, where *text* is bold
+	formatMarkdown messageFormat = "markdown"
+)
+
+// Notification is a rendered message about an order, ready to be delivered
+type Notification struct {
+	Data MessageData
+	// Text is the message rendered in the target's format
+	Text string
+	// Message is the plain text message, which is also exposed to commands
+	Message string
+}
+
+// NotificationTarget delivers notifications to a particular destination
+type NotificationTarget interface {
+	// Name identifies the target in log messages
+	Name() string
+	// Format is the markup the target wants its message rendered in
+	Format() messageFormat
+	// Send delivers a notification
+	Send(ctx context.Context, n Notification) error
+}
+
+// dispatcher renders notifications and sends them to every configured target
+type dispatcher struct {
+	targets   []NotificationTarget
+	templates map[messageFormat]*template.Template
+	// filters select the status changes each target, by name, is notified about. Targets
+	// without a filter use the default.
+	filters map[string]statusFilter
+	logger  *slog.Logger
+	// dedupe, if set, keeps each status of an order from being notified more than once
+	dedupe *notificationDedupe
+}
+
+// newDispatcher parses the message templates and builds the targets selected on the command line
+func newDispatcher(config *Config, logger *slog.Logger) (*dispatcher, error) {
+	plain, err := parseMessageTemplate(config.MessageTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	markdown, err := parseMessageTemplate(config.MarkdownTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := newTargets(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := map[string]statusFilter{}
+	for _, def := range targetRegistry {
+		var spec string
+		if def.filter != nil {
+			spec = def.filter(config)
+		}
+		filter, err := parseStatusFilter(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s-on: %w", def.name, err)
+		}
+		filter.quiet = def.quiet
+		filters[def.name] = filter
+	}
+
+	return &dispatcher{
+		targets: targets,
+		filters: filters,
+		templates: map[messageFormat]*template.Template{
+			formatPlain:    plain,
+			formatMarkdown: markdown,
+		},
+		logger: logger,
+	}, nil
+}
+
+// render renders the message for the given format, falling back to a generic message on error
+func (d *dispatcher) render(format messageFormat, data MessageData) string {
+	message, err := renderMessage(d.templates[format], data)
+	if err != nil {
+		d.logger.Error("failed to render message", "format", format, "error", err)
+		return fmt.Sprintf("order status: %s", data.Status)
+	}
+	return message
+}
+
+// wants reports whether the change from previous to current is worth reporting, either
+// on stdout or to any target's filter
+func (d *dispatcher) wants(previous, current relish.OrderStatus) bool {
+	if shouldNotify(previous, current) {
+		return true
+	}
+	for _, target := range d.targets {
+		if d.filters[target.Name()].matches(previous, current) {
+			return true
+		}
+	}
+	return false
+}
+
+// send delivers a notification about the change from previous to the status in data to
+// every target whose filter selects it, given the already rendered plain text message.
+// Other formats are rendered at most once.
+func (d *dispatcher) send(ctx context.Context, previous relish.OrderStatus, data MessageData, message string) {
+	rendered := map[messageFormat]string{formatPlain: message}
+
+	include := func(target NotificationTarget) bool {
+		return d.filters[target.Name()].matches(previous, data.Status)
+	}
+	d.deliver(ctx, data, message, include, func(format messageFormat) string {
+		text, ok := rendered[format]
+		if !ok {
+			text = d.render(format, data)
+			rendered[format] = text
+		}
+		return text
+	})
+}
+
+// announce delivers the same fixed text, regardless of format, to every target whose filter
+// selects the event in data. It is used for messages about relish-notifier itself rather
+// than the order.
+func (d *dispatcher) announce(ctx context.Context, data MessageData, text string) {
+	include := func(target NotificationTarget) bool {
+		return d.filters[target.Name()].announces(data.Event)
+	}
+	d.deliver(ctx, data, text, include, func(messageFormat) string { return text })
+}
+
+// deliver sends a notification to every target that include selects, using textFor to get
+// the text in each target's format. The targets are sent to at the same time, so a slow one
+// doesn't hold up the rest, but deliver waits for all of them before returning.
+func (d *dispatcher) deliver(ctx context.Context, data MessageData, message string,
+	include func(NotificationTarget) bool, textFor func(messageFormat) string) {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(d.targets))
+	)
+	for i, target := range d.targets {
+		if !include(target) {
+			continue
+		}
+		// Render here, since textFor isn't safe to call from more than one goroutine
+		n := Notification{Data: data, Text: textFor(target.Format()), Message: message}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := target.Send(ctx, n); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target.Name(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		d.logger.Error("failed to send notification", "error", err)
+	}
+}
+
+// dedupeRetention is how long notifications are remembered when there is no dedupe window,
+// which is long after the order they were for could come up again
+const dedupeRetention = 30 * 24 * time.Hour
+
+// notificationDedupe keeps a status of an order from being notified more than once, even
+// across restarts, by recording each notification in the state file
+type notificationDedupe struct {
+	state *State
+	path  string
+	// window is how long a notification holds back the same one; zero means for good
+	window time.Duration
+	// force sends every notification, though they are still recorded
+	force  bool
+	logger *slog.Logger
+}
+
+// notificationKey identifies a status of an order. Orders without an ID are told apart by
+// their day, in the time zone of now, and vendor; the ETA isn't used, since it changes as
+// the order goes. If there is nothing to tell the order apart from others that day, the
+// key is empty.
+func notificationKey(info relish.OrderInfo, now time.Time) string {
+	order := info.OrderID
+	if order == "" {
+		if info.Vendor == "" {
+			return ""
+		}
+		order = now.Format(time.DateOnly) + "/" + info.Vendor
+	}
+	return order + "/" + string(info.Status)
+}
+
+// allow reports whether the status in info hasn't been notified for its order yet, and if
+// so, records that it has been now. An order that can't be told apart from others is
+// always allowed, since holding it back could drop a different order's notification.
+func (d *notificationDedupe) allow(info relish.OrderInfo, now time.Time) bool {
+	key := notificationKey(info, now)
+	if key == "" {
+		d.logger.Debug("order has nothing to identify it, not checking for earlier notifications")
+		return true
+	}
+	if sent, ok := d.state.Notified[key]; ok && (d.window <= 0 || now.Sub(sent) < d.window) {
+		if !d.force {
+			d.logger.Info("already notified, not notifying again", "key", key, "sent", sent)
+			return false
+		}
+		d.logger.Info("already notified, notifying again because of --force-notify", "key", key)
+	}
+
+	if d.state.Notified == nil {
+		d.state.Notified = map[string]time.Time{}
+	}
+	for old, sent := range d.state.Notified {
+		if now.Sub(sent) > max(d.window, dedupeRetention) {
+			delete(d.state.Notified, old)
+		}
+	}
+	d.state.Notified[key] = now
+	if err := d.state.save(d.path); err != nil {
+		d.logger.Warn("failed to save state", "error", err)
+	}
+	return true
+}
+
+// What to do about checks that find a status that isn't recognized, for --on-unknown
+const (
+	onUnknownIgnore = "ignore"
+	onUnknownWarn   = "warn"
+	onUnknownNotify = "notify"
+	onUnknownFail   = "fail"
+)
+
+// validateOnUnknown checks that policy is a supported --on-unknown value
+func validateOnUnknown(policy string) error {
+	switch policy {
+	case onUnknownIgnore, onUnknownWarn, onUnknownNotify, onUnknownFail:
+		return nil
+	default:
+		return fmt.Errorf("invalid --on-unknown %q (must be %s, %s, %s, or %s)", policy,
+			onUnknownIgnore, onUnknownWarn, onUnknownNotify, onUnknownFail)
+	}
+}
+
+// failureTracker counts consecutive failed checks to decide when to report that
+// monitoring is failing, and when it has recovered. It counts checks that find an unknown
+// status for --on-unknown the same way.
+type failureTracker struct {
+	// threshold is the number of consecutive failures that triggers a report; zero disables reports
+	threshold int
+	failures  int
+}
+
+// failed records a failed check and reports whether it is the one that reaches the threshold
+func (t *failureTracker) failed() bool {
+	t.failures++
+	return t.threshold > 0 && t.failures == t.threshold
+}
+
+// succeeded records a successful check and reports whether it ends a reported run of failures
+func (t *failureTracker) succeeded() bool {
+	recovered := t.threshold > 0 && t.failures >= t.threshold
+	t.failures = 0
+	return recovered
+}
+
+// orderTracker remembers the order seen by the last successful check, to tell which checks
+// find a change of status. With --continue-after-arrival, a different order, or a schedule
+// page without one in between, starts over, so that each order is notified about in turn.
+type orderTracker struct {
+	continuing bool
+	status     relish.OrderStatus
+	orderID    string
+}
+
+// previous returns the status that info changes from
+func (t *orderTracker) previous(info relish.OrderInfo) relish.OrderStatus {
+	if t.continuing && info.OrderID != t.orderID {
+		return ""
+	}
+	return t.status
+}
+
+// record remembers info as the latest order seen
+func (t *orderTracker) record(info relish.OrderInfo) {
+	t.status, t.orderID = info.Status, info.OrderID
+}
+
+// failed records a failed check. One that found no order on the page means the last one
+// has cleared, so whatever shows up next is a new order.
+func (t *orderTracker) failed(err error) {
+	if t.continuing && errors.Is(err, relish.ErrStatusMissing) {
+		t.status, t.orderID = "", ""
+	}
+}
+
+// arrivalTracker counts consecutive checks that found the order arrived, so that an arrival
+// shown by a half rendered page doesn't end the run before --confirm-arrived checks agree
+type arrivalTracker struct {
+	// needed is the number of consecutive checks that confirm an arrival
+	needed int
+	seen   int
+}
+
+// observe records the result of a check and reports whether it confirms that the order
+// has arrived. A failed check or any other status starts the count over.
+func (t *arrivalTracker) observe(status relish.OrderStatus, err error) bool {
+	if err != nil || status != relish.OrderStatusArrived {
+		t.seen = 0
+		return false
+	}
+	t.seen++
+	return t.seen >= max(t.needed, 1)
+}
+
+// unconfirmed reports whether status is an arrival that hasn't been confirmed yet
+func (t *arrivalTracker) unconfirmed(status relish.OrderStatus) bool {
+	return status == relish.OrderStatusArrived && t.seen < max(t.needed, 1)
+}
+
+// waitingTracker decides when to send a reminder that the order is still on its way
+type waitingTracker struct {
+	// every is the time between reminders; zero disables them
+	every   time.Duration
+	started time.Time
+	// last is when the last reminder was sent, or when checking started
+	last   time.Time
+	checks int
+}
+
+// checked records a check, successful or not, at now
+func (t *waitingTracker) checked(now time.Time) {
+	if t.started.IsZero() {
+		t.started, t.last = now, now
+	}
+	t.checks++
+}
+
+// due reports whether a reminder should be sent at now, and if so, starts the wait for the next one
+func (t *waitingTracker) due(now time.Time) bool {
+	if t.every <= 0 || t.started.IsZero() || now.Sub(t.last) < t.every {
+		return false
+	}
+	t.last = now
+	return true
+}
+
+// message summarizes the wait so far for a reminder
+func (t *waitingTracker) message(status relish.OrderStatus, now time.Time) string {
+	return fmt.Sprintf("relish-notifier: still waiting, order status: %s (checked %d times over %s)",
+		status, t.checks, now.Sub(t.started).Round(time.Second))
+}
+
+// filterEvents are the announcements about relish-notifier itself that a filter can name
+var filterEvents = []string{eventWaiting, eventFailure, eventRecovery, eventUnknown}
+
+// statusFilter selects the status changes and announcements a target is notified about.
+// The zero value selects only the order arriving, and every announcement, so targets hear
+// about other status changes only when asked to.
+type statusFilter struct {
+	// all selects every change of status
+	all bool
+	// statuses, if not empty, selects changes to any of these statuses
+	statuses []relish.OrderStatus
+	// events, if not empty, selects these announcements instead of the default
+	events []string
+	// quiet leaves out announcements that events doesn't name, for targets such as commands
+	// that are usually written for the order arriving
+	quiet bool
+}
+
+// parseStatusFilter parses a --*-on value: empty for the default, "all", or a comma
+// separated list of status and event names such as "arrived,out-for-delivery,failure"
+func parseStatusFilter(spec string) (statusFilter, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "":
+		return statusFilter{}, nil
+	case "all":
+		return statusFilter{all: true}, nil
+	}
+
+	names := map[string]relish.OrderStatus{}
+	for _, known := range relish.KnownStatuses() {
+		names[statusFilterName(known)] = known.Status
+	}
+
+	var filter statusFilter
+	for name := range strings.SplitSeq(spec, ",") {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if slices.Contains(filterEvents, key) {
+			filter.events = append(filter.events, key)
+			continue
+		}
+		status, ok := names[key]
+		if !ok {
+			return statusFilter{}, fmt.Errorf("unknown status %q (expected all, or some of %s, %s)", name,
+				strings.Join(slices.Sorted(maps.Keys(names)), ", "), strings.Join(filterEvents, ", "))
+		}
+		filter.statuses = append(filter.statuses, status)
+	}
+	return filter, nil
+}
+
+// statusFilterName returns the name used for a status in filters, such as "out-for-delivery"
+// for OrderStatusOutForDelivery
+func statusFilterName(known relish.StatusDefinition) string {
+	var b strings.Builder
+	for i, r := range strings.TrimPrefix(known.Name, "OrderStatus") {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// matches reports whether the filter selects the change from previous to current
+func (f statusFilter) matches(previous, current relish.OrderStatus) bool {
+	switch {
+	case f.all:
+		return current != previous
+	case len(f.statuses) > 0:
+		return current != previous && slices.Contains(f.statuses, current)
+	default:
+		return current == relish.OrderStatusArrived && current != previous
+	}
+}
+
+// announces reports whether the filter selects an announcement for event. A test
+// notification always goes through, since its point is to try the target out.
+func (f statusFilter) announces(event string) bool {
+	switch {
+	case event == eventTest:
+		return true
+	case len(f.events) > 0:
+		return slices.Contains(f.events, event)
+	default:
+		return !f.quiet
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+const (
+	outputText string = "text"
+	outputJSON string = "json"
+)
+
+// checkResult is the outcome of a check as reported on stdout
+type checkResult struct {
+	Status         relish.OrderStatus `json:"status"`
+	ETA            string             `json:"eta,omitempty"`
+	Vendor         string             `json:"vendor,omitempty"`
+	Driver         string             `json:"driver,omitempty"`
+	DriverLocation string             `json:"driver_location,omitempty"`
+	Arrived        bool               `json:"arrived"`
+	Message        string             `json:"message,omitempty"`
+	Error          string             `json:"error,omitempty"`
+}
+
+// validateOutput checks that format is a supported output format
+func validateOutput(format string) error {
+	switch format {
+	case outputText, outputJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q (must be %q or %q)", format, outputText, outputJSON)
+	}
+}
+
+// newCheckResult builds a check result from the scraped order information and any check error
+func newCheckResult(info relish.OrderInfo, message string, err error) checkResult {
+	result := checkResult{
+		Status:         info.Status,
+		ETA:            info.ETA,
+		Vendor:         info.Vendor,
+		Driver:         info.Driver,
+		DriverLocation: info.DriverLocation,
+		Arrived:        info.Status == relish.OrderStatusArrived,
+		Message:        message,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// writeResult writes a check result to w in the requested format
+func writeResult(w io.Writer, format string, result checkResult) error {
+	if format == outputJSON {
+		return json.NewEncoder(w).Encode(result)
+	}
+
+	if result.Message != "" {
+		_, err := fmt.Fprintln(w, result.Message)
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, "order has not arrived")
+	return err
+}
+
+// streamedCheck is a check result written by --stream-json
+type streamedCheck struct {
+	Time time.Time `json:"time"`
+	checkResult
+}
+
+// streamResult writes a check result made at t to w as a single line of JSON. The line is
+// written with one call, so nothing is left buffered between checks.
+func streamResult(w io.Writer, result checkResult, t time.Time) error {
+	return json.NewEncoder(w).Encode(streamedCheck{Time: t, checkResult: result})
+}
+
+// redactedConfig replaces secret configuration values that are set
+const redactedConfig = "[REDACTED]"
+
+// printConfig writes config as indented JSON, with secrets redacted, for --print-config
+func printConfig(w io.Writer, config Config) error {
+	for _, secret := range []*string{&config.TOTPSecret, &config.SessionCookie, &config.SlackWebhook, &config.TwilioToken, &config.IMAP.Password} {
+		if *secret != "" {
+			*secret = redactedConfig
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(configFields(reflect.ValueOf(config)))
+}
+
+// configFields flattens a configuration struct into a map from field name to value. Embedded
+// structs are merged into their parent, and durations are written the way flags accept them.
+func configFields(v reflect.Value) map[string]any {
+	fields := map[string]any{}
+	for i := range v.NumField() {
+		field, value := v.Type().Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if loc, ok := value.Interface().(*time.Location); ok && loc != nil {
+			fields[field.Name] = loc.String()
+			continue
+		}
+
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				fields[field.Name] = nil
+				continue
+			}
+			value = value.Elem()
+		}
+
+		switch {
+		case value.Type() == reflect.TypeFor[time.Duration]():
+			fields[field.Name] = time.Duration(value.Int()).String()
+		case value.Kind() == reflect.Struct && field.Anonymous:
+			for name, v := range configFields(value) {
+				fields[name] = v
+			}
+		case value.Kind() == reflect.Struct:
+			fields[field.Name] = configFields(value)
+		default:
+			fields[field.Name] = value.Interface()
+		}
+	}
+	return fields
+}
@@ -0,0 +1,68 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// writePIDFile records the current process ID in path. It refuses to replace a PID file
+// that names another running process. The returned function removes the file, as long as
+// it still holds our PID.
+func writePIDFile(path string) (func(), error) {
+	if pid, err := readPIDFile(path); err == nil && pid != os.Getpid() && processRunning(pid) {
+		return nil, fmt.Errorf("already running with PID %d (from %s)", pid, path)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	pid := os.Getpid()
+	if err := os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+
+	return func() {
+		// Don't remove a PID file that another instance has since taken over
+		if current, err := readPIDFile(path); err == nil && current == pid {
+			os.Remove(path) //nolint:errcheck
+		}
+	}, nil
+}
+
+// readPIDFile returns the process ID recorded in path
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		// A garbled file can't name a running process, so it is safe to replace
+		return 0, nil
+	}
+	return pid, nil
+}
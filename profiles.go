@@ -0,0 +1,178 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// validateProfiles checks that --profiles names each profile once, and isn't combined with
+// options that only make sense for a single account
+func validateProfiles(config *Config) error {
+	if len(config.Profiles) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, profile := range config.Profiles {
+		if profile == "" {
+			return fmt.Errorf("--profiles has an empty profile name")
+		}
+		if seen[profile] {
+			return fmt.Errorf("--profiles names %q more than once", profile)
+		}
+		seen[profile] = true
+	}
+
+	for flag, set := range map[string]bool{
+		"--profile":        config.Profile != "",
+		"--session-cookie": config.SessionCookie != "",
+		"--totp-secret":    config.TOTPSecret != "",
+		"--tui":            config.TUI,
+		"--serve":          config.Serve != "",
+		"--control-socket": config.ControlSocket != "",
+	} {
+		if set {
+			return fmt.Errorf("%s cannot be used with --profiles", flag)
+		}
+	}
+	return nil
+}
+
+// profileConfig returns the configuration for the run for profile, as one of --profiles.
+// Each profile keeps its own state, history, calendar, and error bundles, and a remote
+// browser is shared with a browser context for each.
+func profileConfig(config *Config, profile string) *Config {
+	c := *config
+	c.Profiles = nil
+	c.Profile = profile
+	c.Incognito = true
+	c.StateFile = profilePath(config.StateFile, profile)
+	c.HistoryFile = profilePath(config.HistoryFile, profile)
+	c.ICalFile = profilePath(config.ICalFile, profile)
+	if config.ErrorBundleDir != "" {
+		c.ErrorBundleDir = filepath.Join(config.ErrorBundleDir, profile)
+	}
+	return &c
+}
+
+// profilePath adds profile to the name of the file at path, before its extension, such
+// as state-work.json for state.json. An empty path stays empty.
+func profilePath(path, profile string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + profile + ext
+}
+
+// runProfiles runs the monitoring loop for every one of --profiles at once, each with its
+// own browser and credentials. A profile that fails doesn't stop the others. Once they
+// have all finished, it returns the error of the first profile, in the order given, that
+// ended with one.
+func runProfiles(config *Config, stdout io.Writer, logger *slog.Logger) error {
+	out := &sharedWriter{w: stdout}
+	errs := make([]error, len(config.Profiles))
+
+	var wg sync.WaitGroup
+	for i, profile := range config.Profiles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			profileLogger := logger.With("profile", profile)
+			errs[i] = runProfile(profileConfig(config, profile), &profileWriter{profile: profile, out: out}, profileLogger)
+			if errs[i] != nil {
+				profileLogger.Error("stopped monitoring profile", "error", errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			if exitErr.err == nil {
+				return exitErr
+			}
+			return exitCodeError{code: exitErr.code, err: fmt.Errorf("profile %s: %w", config.Profiles[i], exitErr.err)}
+		}
+		return fmt.Errorf("profile %s: %w", config.Profiles[i], err)
+	}
+	return nil
+}
+
+// sharedWriter is the stdout shared by the runs of several profiles
+type sharedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// profileWriter writes one profile's output to a sharedWriter a whole line at a time, so
+// that the lines of different profiles don't run together, marked with the profile. A
+// line of JSON gets a "profile" field; any other line is prefixed with the profile name.
+type profileWriter struct {
+	profile string
+	out     *sharedWriter
+	// partial is the start of a line that hasn't been ended yet
+	partial []byte
+}
+
+func (w *profileWriter) Write(p []byte) (int, error) {
+	w.out.mu.Lock()
+	defer w.out.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexByte(w.partial, '\n')
+		if end < 0 {
+			break
+		}
+		line := w.label(w.partial[:end])
+		w.partial = w.partial[end+1:]
+		if _, err := w.out.w.Write(append(line, '\n')); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// label marks line with the profile
+func (w *profileWriter) label(line []byte) []byte {
+	if !bytes.HasPrefix(line, []byte("{")) || !json.Valid(line) {
+		return append([]byte(w.profile+": "), line...)
+	}
+
+	name, _ := json.Marshal(w.profile)
+	labeled := append([]byte(`{"profile":`), name...)
+	if rest := bytes.TrimSpace(line[1:]); !bytes.Equal(rest, []byte("}")) {
+		labeled = append(labeled, ',')
+	}
+	return append(labeled, line[1:]...)
+}
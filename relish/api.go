@@ -0,0 +1,169 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package relish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fields of the API response read by default, as dotted paths
+const (
+	DefaultAPIStatusField         = "status"
+	DefaultAPIETAField            = "eta"
+	DefaultAPIOrderIDField        = "id"
+	DefaultAPIVendorField         = "vendor"
+	DefaultAPIDriverField         = "driver"
+	DefaultAPIDriverLocationField = "driver_location"
+)
+
+// apiFields are the dotted paths of the fields read from an API response
+type apiFields struct {
+	status         string
+	eta            string
+	orderID        string
+	vendor         string
+	driver         string
+	driverLocation string
+}
+
+// apiFields returns the configured paths of the API response fields, using the defaults
+// for any that aren't set
+func (c *Config) apiFields() apiFields {
+	return apiFields{
+		status:         selectorOrDefault(c.APIStatusField, DefaultAPIStatusField),
+		eta:            selectorOrDefault(c.APIETAField, DefaultAPIETAField),
+		orderID:        selectorOrDefault(c.APIOrderIDField, DefaultAPIOrderIDField),
+		vendor:         selectorOrDefault(c.APIVendorField, DefaultAPIVendorField),
+		driver:         selectorOrDefault(c.APIDriverField, DefaultAPIDriverField),
+		driverLocation: selectorOrDefault(c.APIDriverLocationField, DefaultAPIDriverLocationField),
+	}
+}
+
+// apiFetchScript requests a URL from the page, so that the request carries the session
+// cookies, and returns the response body
+const apiFetchScript = `async (url) => {
+	const resp = await fetch(url, {credentials: "include", headers: {Accept: "application/json"}});
+	if (!resp.ok) {
+		throw new Error("HTTP " + resp.status);
+	}
+	return await resp.text();
+}`
+
+// checkAPI asks the JSON endpoint at Config.APIURL for the order status
+func (n *Notifier) checkAPI(ctx context.Context) (OrderInfo, error) {
+	n.logger.Debug("requesting order status from API", "url", n.config.APIURL)
+
+	if err := n.beforeLoad(ctx); err != nil {
+		return OrderInfo{Status: OrderStatusUnknown}, err
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	body, err := page.Eval(apiFetchScript, n.config.APIURL)
+	if err != nil {
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("failed to request order status from API: %w", err)
+	}
+
+	return parseAPIResponse([]byte(body.Value.Str()), n.config.apiFields(), n.config.OrderID, n.config.location())
+}
+
+// parseAPIResponse reads the order from the fields of an API response at the given paths.
+// A status that isn't one shown on the schedule page is an error, as is an order other
+// than orderID, if it is set, so that the page can be read instead. An ETA given as a
+// timestamp is shown as a time of day in loc. An order that is still being prepared but
+// names a driver has OrderStatusDriverAssigned.
+func parseAPIResponse(body []byte, fields apiFields, orderID string, loc *time.Location) (OrderInfo, error) {
+	// Order IDs may be numbers, which mustn't lose any digits
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var response any
+	if err := decoder.Decode(&response); err != nil {
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("failed to parse API response: %w", err)
+	}
+
+	text, ok := lookupJSONString(response, fields.status)
+	if !ok {
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("API response has no %q field", fields.status)
+	}
+
+	status := ParseOrderStatus(strings.TrimSpace(text))
+	if status == OrderStatusUnknown {
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("unknown order status %q in API response", text)
+	}
+
+	info := OrderInfo{Status: status}
+	switch id, _ := lookupJSON(response, fields.orderID); id := id.(type) {
+	case string:
+		info.OrderID = id
+	case json.Number:
+		info.OrderID = id.String()
+	}
+	if orderID != "" && info.OrderID != orderID {
+		if info.OrderID == "" {
+			return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("API response has no %q field to find order %s by", fields.orderID, orderID)
+		}
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("API response is for order %s, not %s", info.OrderID, orderID)
+	}
+
+	if eta, ok := lookupJSONString(response, fields.eta); ok {
+		// The page shows times like "12:30 PM", and so should the ETA from the API
+		if t, err := time.Parse(time.RFC3339, eta); err == nil {
+			eta = t.In(loc).Format("3:04 PM")
+		}
+		info.ETA = eta
+	}
+	info.Vendor, _ = lookupJSONString(response, fields.vendor)
+	info.Driver, _ = lookupJSONString(response, fields.driver)
+	info.DriverLocation, _ = lookupJSONString(response, fields.driverLocation)
+	// As on the page, a driver can be named before the status changes
+	return withDriverAssigned(info), nil
+}
+
+// lookupJSONString returns the string at path in a decoded JSON value
+func lookupJSONString(value any, path string) (string, bool) {
+	value, _ = lookupJSON(value, path)
+	s, ok := value.(string)
+	return s, ok
+}
+
+// lookupJSON returns the value at path in a decoded JSON value. The path is a list of
+// object keys and array indexes separated by dots, such as "orders.0.status".
+func lookupJSON(value any, path string) (any, bool) {
+	for key := range strings.SplitSeq(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
@@ -0,0 +1,58 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import "testing"
+
+// Benchmarks for the parsing done on every check. Compare runs with benchstat rather than
+// asserting on wall clock times, which vary from machine to machine.
+
+// benchmarkLabels mixes known statuses with text that matches none of them
+var benchmarkLabels = []string{
+	"Order Placed",
+	"Preparing Your Order",
+	"Order Arrived",
+	"Invalid Status",
+}
+
+func BenchmarkParseOrderStatus(b *testing.B) {
+	for i := 0; b.Loop(); i++ {
+		ParseOrderStatus(benchmarkLabels[i%len(benchmarkLabels)])
+	}
+}
+
+func BenchmarkOrderStatusString(b *testing.B) {
+	statuses := []OrderStatus{OrderStatusPlaced, OrderStatusPreparing, OrderStatusArrived, OrderStatusUnknown}
+	for i := 0; b.Loop(); i++ {
+		_ = statuses[i%len(statuses)].String()
+	}
+}
+
+func BenchmarkSuggestOrderStatus(b *testing.B) {
+	for b.Loop() {
+		SuggestOrderStatus("Order Arived")
+	}
+}
+
+func BenchmarkParseETA(b *testing.B) {
+	text := "Tasty Tacos\nPreparing Your Order\nArriving at 12:30 PM\nDelivery to 3rd floor"
+	for b.Loop() {
+		parseETA(text)
+	}
+}
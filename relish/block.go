@@ -0,0 +1,83 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package relish
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// blockedResourceTypes are the requests Config.BlockResources stops the page from making
+var blockedResourceTypes = []proto.NetworkResourceType{
+	proto.NetworkResourceTypeImage,
+	proto.NetworkResourceTypeFont,
+	proto.NetworkResourceTypeMedia,
+}
+
+// blockResources fails every request the page makes for one of the blockedResourceTypes,
+// counting them in blocked. The returned router must be stopped when the page is replaced.
+func blockResources(page *rod.Page, blocked *atomic.Int64) (*rod.HijackRouter, error) {
+	router := page.HijackRequests()
+	for _, resourceType := range blockedResourceTypes {
+		// Only requests of the given type are intercepted, so everything else loads as usual
+		err := router.Add("*", resourceType, func(h *rod.Hijack) {
+			blocked.Add(1)
+			h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to block %s requests: %w", resourceType, err)
+		}
+	}
+
+	go router.Run()
+	return router, nil
+}
+
+// pageLoadScript returns the time in milliseconds the current page took to load, or zero
+// if it hasn't finished loading
+const pageLoadScript = `() => {
+	const nav = performance.getEntriesByType("navigation")[0];
+	return nav ? nav.duration : 0;
+}`
+
+// logPageLoad logs how long the current page took to load, and how many requests have been
+// blocked since the last time, so that the effect of Config.BlockResources can be measured
+func (n *Notifier) logPageLoad(ctx context.Context) {
+	if !n.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	result, err := page.Eval(pageLoadScript)
+	if err != nil {
+		n.logger.Debug("failed to get page load time", "error", err)
+		return
+	}
+
+	loadTime := time.Duration(result.Value.Num() * float64(time.Millisecond)).Round(time.Millisecond)
+	n.logger.Debug("page load", "load_time", loadTime, "block_resources", n.config.BlockResources,
+		"blocked_requests", n.blocked.Swap(0))
+}
@@ -0,0 +1,59 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package relish monitors the status of an ezCater Relish order using browser
+// automation.
+//
+// A typical program creates a Notifier, starts the browser, logs in, and then
+// polls CheckOrderStatus until the order arrives. Methods that talk to the site
+// accept a context; cancelling it interrupts any page load in progress.
+//
+//	notifier := relish.NewNotifier(&relish.Config{
+//		Headless:    true,
+//		PageTimeout: 10 * time.Second,
+//	}, &relish.Credentials{
+//		Username: "user@example.com",
+//		Password: "secret",
+//	}, slog.Default())
+//	defer notifier.Close()
+//
+//	if err := notifier.InitializeBrowser(); err != nil {
+//		return err
+//	}
+//	if err := notifier.Login(ctx); err != nil {
+//		return err
+//	}
+//
+//	for {
+//		info, err := notifier.CheckOrderStatus(ctx)
+//		if err == nil && info.Status == relish.OrderStatusArrived {
+//			break
+//		}
+//		time.Sleep(30 * time.Second)
+//		if err := notifier.Refresh(ctx); err != nil {
+//			return err
+//		}
+//	}
+//
+// Programs that want to react to every check, rather than only inspecting the
+// return value, can set the OnStatus and OnError callbacks on the Notifier.
+//
+// When the website is unavailable, an IMAPSource can read the status from order
+// emails instead, and a SimulatedSource steps through a canned sequence of
+// updates for testing. All of them implement the StatusSource interface.
+package relish
@@ -0,0 +1,56 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import "errors"
+
+// ErrSessionExpired is returned by CheckOrderStatus when the site has redirected back to the login page
+var ErrSessionExpired = errors.New("session expired: login page is displayed")
+
+// ErrNoOrderEmail is returned by IMAPSource when the mailbox has no order emails from today
+var ErrNoOrderEmail = errors.New("no order email found")
+
+// ErrStatusNotFound is returned by CheckOrderStatus when the page has no order status element
+var ErrStatusNotFound = errors.New("failed to find order status element")
+
+// ErrUnexpectedPage is returned by Login when logging in ends up somewhere other than the schedule page
+var ErrUnexpectedPage = errors.New("unexpected page after login")
+
+// ErrLoginFailed is returned by Login when the page never shows that logging in worked,
+// for example because the site silently sent the browser back to the login form
+var ErrLoginFailed = errors.New("login failed")
+
+// ErrInvalidCredentials is returned by Login when the site rejects the email or password, and by
+// IMAPSource when the mail server rejects the login
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrBrowserDisconnected is returned by CheckOrderStatus when a check fails because the browser
+// has stopped responding, for example because it crashed. Restart replaces it.
+var ErrBrowserDisconnected = errors.New("browser disconnected")
+
+// ErrOrderNotFound is returned by CheckOrderStatus when no schedule card matches Config.OrderID
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrPageLoading accompanies ErrStatusNotFound when the page was still loading when the wait
+// for the order status ran out, so the status may simply not have been shown yet
+var ErrPageLoading = errors.New("page still loading")
+
+// ErrStatusMissing accompanies ErrStatusNotFound when the page finished loading without an
+// order status, because there is no order or the site's markup has changed
+var ErrStatusMissing = errors.New("page loaded without an order status")
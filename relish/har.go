@@ -0,0 +1,101 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HARPage is a page the browser loaded, saved in a HAR file such as the ones a browser's
+// developer tools export
+type HARPage struct {
+	Time time.Time
+	URL  string
+	HTML string
+}
+
+// harFile is the part of the HAR format that ReadHARPages needs
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				URL string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ReadHARPages reads the HAR file at path and returns the HTML pages in it that were
+// loaded successfully from pageURL's path, on any host, in the order they were requested.
+// Together with Notifier.Replay, this reads the order status from a capture of the real
+// site without going to it.
+func ReadHARPages(path, pageURL string) ([]HARPage, error) {
+	want, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL %q: %w", pageURL, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HAR file: %w", err)
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR file %s: %w", path, err)
+	}
+
+	var pages []HARPage
+	for _, entry := range har.Log.Entries {
+		got, err := url.Parse(entry.Request.URL)
+		if err != nil || got.Path != want.Path {
+			continue
+		}
+		content := entry.Response.Content
+		if entry.Response.Status != http.StatusOK || !strings.HasPrefix(content.MimeType, "text/html") {
+			continue
+		}
+
+		html := content.Text
+		if content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode response from %s: %w", entry.Request.URL, err)
+			}
+			html = string(decoded)
+		}
+		pages = append(pages, HARPage{Time: entry.StartedDateTime, URL: entry.Request.URL, HTML: html})
+	}
+	return pages, nil
+}
@@ -0,0 +1,433 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultIMAPMailbox is the folder searched for order emails
+	DefaultIMAPMailbox = "INBOX"
+	// DefaultIMAPFrom matches the sender of ezCater order emails
+	DefaultIMAPFrom = "ezcater.com"
+)
+
+// IMAPConfig describes the mailbox searched by an IMAPSource
+type IMAPConfig struct {
+	// Server is the host[:port] of the IMAP server. The port defaults to 993,
+	// or 143 when DisableTLS is set.
+	Server   string
+	Username string
+	Password string
+	// Mailbox is the folder searched for order emails
+	Mailbox string
+	// From restricts the search to messages whose sender contains this string
+	From string
+	// DisableTLS connects without TLS, e.g. to a mail bridge running on localhost
+	DisableTLS bool
+}
+
+// Validate checks the IMAP configuration for errors
+func (c *IMAPConfig) Validate() error {
+	if c.Server == "" {
+		return fmt.Errorf("invalid IMAP configuration: no server specified")
+	}
+	if c.Username == "" || c.Password == "" {
+		return fmt.Errorf("invalid IMAP configuration: missing credentials")
+	}
+
+	// These are sent as quoted strings, which cannot contain line breaks
+	for _, value := range []string{c.Username, c.Password, c.Mailbox, c.From} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid IMAP configuration: values may not contain line breaks")
+		}
+	}
+
+	return nil
+}
+
+// address returns the server address with the default port filled in
+func (c *IMAPConfig) address() string {
+	if _, _, err := net.SplitHostPort(c.Server); err == nil {
+		return c.Server
+	}
+	if c.DisableTLS {
+		return net.JoinHostPort(c.Server, "143")
+	}
+	return net.JoinHostPort(c.Server, "993")
+}
+
+// emailStatusPatterns map phrases used in order emails to a status, most advanced first
+var emailStatusPatterns = []struct {
+	status  OrderStatus
+	pattern *regexp.Regexp
+}{
+	{OrderStatusCancelled, regexp.MustCompile(`(?i)order\s+(?:has\s+been\s+|was\s+)?cancell?ed`)},
+	{OrderStatusArrived, regexp.MustCompile(`(?i)order\s+(?:has\s+)?arrived`)},
+	{OrderStatusOutForDelivery, regexp.MustCompile(`(?i)out\s+for\s+delivery`)},
+	{OrderStatusDriverAssigned, regexp.MustCompile(`(?i)driver\s+(?:has\s+been\s+)?assigned`)},
+	{OrderStatusDelayed, regexp.MustCompile(`(?i)order\s+(?:has\s+been\s+|is\s+|was\s+)?delayed`)},
+	{OrderStatusPreparing, regexp.MustCompile(`(?i)preparing\s+your\s+order`)},
+	{OrderStatusPlaced, regexp.MustCompile(`(?i)order\s+(?:has\s+been\s+)?placed`)},
+}
+
+var (
+	// literalPattern matches the size of a literal at the end of a response line
+	literalPattern = regexp.MustCompile(`\{(\d+)\}$`)
+	// hiddenPattern matches HTML elements whose content is not displayed
+	hiddenPattern = regexp.MustCompile(`(?is)<style.*?</style>|<script.*?</script>`)
+	// tagPattern matches HTML tags
+	tagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// IMAPSource reads the order status from the most recent order email in a mailbox.
+// It is an alternative to the Notifier for when the website is unavailable.
+type IMAPSource struct {
+	Callbacks
+
+	config *IMAPConfig
+	logger *slog.Logger
+}
+
+// NewIMAPSource creates a new IMAPSource. If logger is nil, log output is discarded.
+func NewIMAPSource(config *IMAPConfig, logger *slog.Logger) *IMAPSource {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	s := &IMAPSource{config: config}
+	s.logger = newRedactLogger(logger, s.secrets)
+	return s
+}
+
+// secrets returns the mailbox password, which must never appear in logs or errors
+func (s *IMAPSource) secrets() []string {
+	return []string{s.config.Password}
+}
+
+// CheckStatus searches the mailbox for today's order emails and parses the status
+// from the most recent one. The OnStatus and OnError callbacks are invoked with the result.
+func (s *IMAPSource) CheckStatus(ctx context.Context) (OrderInfo, error) {
+	info, err := s.checkStatus(ctx)
+	err = redactError(err, s.secrets())
+	s.report(ctx, info, err)
+	return info, err
+}
+
+// checkStatus performs the mailbox search for CheckStatus
+func (s *IMAPSource) checkStatus(ctx context.Context) (OrderInfo, error) {
+	s.logger.Debug("checking order status via IMAP", "server", s.config.Server)
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return OrderInfo{}, fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// Unblock any pending reads if the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close() //nolint:errcheck
+	})
+	defer stop()
+
+	c := &imapConn{r: bufio.NewReader(conn), w: conn}
+	if err := c.greeting(); err != nil {
+		return OrderInfo{}, err
+	}
+
+	if _, err := c.command("LOGIN %s %s", imapQuote(s.config.Username), imapQuote(s.config.Password)); err != nil {
+		// A refusal, as opposed to a dropped connection, means the password is wrong
+		if errors.Is(err, errIMAPRejected) {
+			return OrderInfo{}, fmt.Errorf("failed to log in to IMAP server: %w: %w", ErrInvalidCredentials, err)
+		}
+		return OrderInfo{}, fmt.Errorf("failed to log in to IMAP server: %w", err)
+	}
+	defer c.command("LOGOUT") //nolint:errcheck
+
+	mailbox := s.config.Mailbox
+	if mailbox == "" {
+		mailbox = DefaultIMAPMailbox
+	}
+	// EXAMINE opens the mailbox read-only so that we don't change any flags
+	if _, err := c.command("EXAMINE %s", imapQuote(mailbox)); err != nil {
+		return OrderInfo{}, fmt.Errorf("failed to open mailbox %s: %w", mailbox, err)
+	}
+
+	from := s.config.From
+	if from == "" {
+		from = DefaultIMAPFrom
+	}
+	since := time.Now().Format("2-Jan-2006")
+	resp, err := c.command("SEARCH FROM %s SINCE %s", imapQuote(from), since)
+	if err != nil {
+		return OrderInfo{}, fmt.Errorf("failed to search mailbox: %w", err)
+	}
+
+	ids := parseSearch(resp.lines)
+	if len(ids) == 0 {
+		return OrderInfo{}, ErrNoOrderEmail
+	}
+
+	// Message sequence numbers increase with arrival, so the last one is the newest
+	latest := ids[len(ids)-1]
+	s.logger.Debug("fetching order email", "message", latest, "matches", len(ids))
+	resp, err = c.command("FETCH %d BODY.PEEK[]", latest)
+	if err != nil {
+		return OrderInfo{}, fmt.Errorf("failed to fetch message %d: %w", latest, err)
+	}
+	if len(resp.literals) == 0 {
+		return OrderInfo{}, fmt.Errorf("failed to fetch message %d: no message body returned", latest)
+	}
+
+	text, err := messageText(resp.literals[0])
+	if err != nil {
+		return OrderInfo{}, fmt.Errorf("failed to parse message %d: %w", latest, err)
+	}
+
+	return OrderInfo{
+		Status: parseEmailStatus(text),
+		ETA:    parseETA(text),
+	}, nil
+}
+
+// dial connects to the IMAP server
+func (s *IMAPSource) dial(ctx context.Context) (net.Conn, error) {
+	if s.config.DisableTLS {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", s.config.address())
+	}
+
+	var dialer tls.Dialer
+	return dialer.DialContext(ctx, "tcp", s.config.address())
+}
+
+// errIMAPRejected is returned by command when the server answers NO or BAD
+var errIMAPRejected = errors.New("server responded")
+
+// imapConn implements just enough of the IMAP4rev1 protocol to search for and fetch a message
+type imapConn struct {
+	r   *bufio.Reader
+	w   io.Writer
+	tag int
+}
+
+// imapResponse holds the untagged responses and literals returned by a command
+type imapResponse struct {
+	lines    []string
+	literals [][]byte
+}
+
+// greeting reads the greeting sent by the server when the connection is opened
+func (c *imapConn) greeting() error {
+	line, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("failed to read IMAP greeting: %w", err)
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return fmt.Errorf("unexpected IMAP greeting: %s", line)
+	}
+	return nil
+}
+
+// command sends a command and collects responses until the matching tagged response
+func (c *imapConn) command(format string, args ...any) (*imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.w, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	resp := &imapResponse{}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		// A literal is followed by the rest of the response line
+		for {
+			match := literalPattern.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			size, err := strconv.Atoi(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid literal size: %w", err)
+			}
+			literal := make([]byte, size)
+			if _, err := io.ReadFull(c.r, literal); err != nil {
+				return nil, err
+			}
+			resp.literals = append(resp.literals, literal)
+
+			rest, err := c.readLine()
+			if err != nil {
+				return nil, err
+			}
+			line += rest
+		}
+
+		if status, ok := strings.CutPrefix(line, tag+" "); ok {
+			if strings.HasPrefix(status, "OK") {
+				return resp, nil
+			}
+			return nil, fmt.Errorf("%w: %s", errIMAPRejected, status)
+		}
+		resp.lines = append(resp.lines, line)
+	}
+}
+
+// readLine reads a single CRLF terminated line
+func (c *imapConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// imapQuote returns s as an IMAP quoted string
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// parseSearch extracts message sequence numbers from SEARCH responses
+func parseSearch(lines []string) []int {
+	var ids []int
+	for _, line := range lines {
+		rest, ok := strings.CutPrefix(line, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(rest) {
+			if id, err := strconv.Atoi(field); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// parseEmailStatus determines the order status from the text of an order email
+func parseEmailStatus(text string) OrderStatus {
+	for _, candidate := range emailStatusPatterns {
+		if candidate.pattern.MatchString(text) {
+			return candidate.status
+		}
+	}
+	return OrderStatusUnknown
+}
+
+// messageText returns the subject and readable text of a raw email message
+func messageText(raw []byte) (string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+
+	var decoder mime.WordDecoder
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	body, err := partText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return subject + "\n" + body, nil
+}
+
+// partText returns the readable text of a (possibly multipart) message body
+func partText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// RFC 2045 says to treat a missing or invalid content type as plain text
+		mediaType = "text/plain"
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var texts []string
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := partText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			texts = append(texts, text)
+		}
+		return strings.Join(texts, "\n"), nil
+	}
+
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if mediaType == "text/html" {
+		return htmlText(string(data)), nil
+	}
+	return string(data), nil
+}
+
+// htmlText crudely converts HTML to plain text
+func htmlText(s string) string {
+	s = hiddenPattern.ReplaceAllString(s, " ")
+	s = tagPattern.ReplaceAllString(s, " ")
+	return html.UnescapeString(s)
+}
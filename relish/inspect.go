@@ -0,0 +1,83 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// highlightScript outlines an element, so that it can be seen in a headful browser
+const highlightScript = `() => { this.style.outline = "3px solid #e00"; this.style.outlineOffset = "2px"; }`
+
+// SelectorMatch is what a selector matched on the current page
+type SelectorMatch struct {
+	// URL is the address of the page the selector was tried on
+	URL string
+	// Count is the number of elements the selector matched
+	Count int
+	// Text is the text of the first match, with surrounding whitespace removed
+	Text string
+}
+
+// Inspect tries selector on the current page, normally the schedule after Login, without
+// waiting for it to appear. With highlight set, the matches are outlined and the first is
+// scrolled into view, for someone watching a headful browser.
+func (n *Notifier) Inspect(ctx context.Context, selector string, highlight bool) (SelectorMatch, error) {
+	if n.page == nil {
+		return SelectorMatch{}, fmt.Errorf("no page is open")
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	info, err := page.Info()
+	if err != nil {
+		return SelectorMatch{}, fmt.Errorf("failed to get page URL: %w", err)
+	}
+	match := SelectorMatch{URL: info.URL}
+
+	elements, err := page.Elements(selector)
+	if err != nil {
+		return match, fmt.Errorf("failed to find %q: %w", selector, err)
+	}
+	match.Count = len(elements)
+	if match.Count == 0 {
+		return match, nil
+	}
+
+	text, err := elements.First().Text()
+	if err != nil {
+		return match, fmt.Errorf("failed to get text of %q: %w", selector, err)
+	}
+	match.Text = redact(strings.TrimSpace(text), n.secrets())
+
+	if highlight {
+		for _, element := range elements {
+			if _, err := element.Eval(highlightScript); err != nil {
+				n.logger.Debug("failed to highlight element", "selector", selector, "error", err)
+			}
+		}
+		if err := elements.First().ScrollIntoView(); err != nil {
+			n.logger.Debug("failed to scroll to element", "selector", selector, "error", err)
+		}
+	}
+	return match, nil
+}
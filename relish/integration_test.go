@@ -0,0 +1,675 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package relish
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// mockSite imitates the parts of the ezCater login flow and schedule page that the
+// Notifier relies on
+type mockSite struct {
+	password string
+
+	mu     sync.Mutex
+	status OrderStatus
+	// expired makes the schedule page send every visitor back to the login form
+	expired bool
+	// driver, when set, is shown on the schedule card along with a location
+	driver string
+	// images counts requests for the logo on the schedule page
+	images int
+	// empty shows a schedule page without any orders
+	empty bool
+	// stalled adds an image to the schedule page that never finishes loading
+	stalled bool
+	// hung makes the schedule page itself never respond
+	hung bool
+	// careless makes the login form repeat a rejected password back in its error
+	careless bool
+}
+
+const mockLoginPage = `<html><body>
+<form method="post" action="/login">
+<input id="identity_email" name="email">
+<button type="submit" name="commit">Continue</button>
+</form>
+</body></html>`
+
+const mockPasswordPage = `<html><body>
+<form method="post" action="/login/password">
+%s
+<input id="password" name="password" type="password">
+<button type="submit" name="action">Log in</button>
+</form>
+</body></html>`
+
+const mockSchedulePage = `<html><body>
+<img src="/logo.png" alt="ezCater">
+<div class="schedule-card" data-order-id="A100">
+<div class="schedule-card-vendor">Tasty Tacos</div>
+<div class="schedule-card-label">%s</div>
+<div>Arriving at 12:30 PM</div>
+%s
+</div>
+<div class="schedule-card" data-order-id="B200">
+<div class="schedule-card-vendor">Pizza Palace</div>
+<div class="schedule-card-label">Order Delayed</div>
+<div>Arriving at 1:15 PM</div>
+</div>
+</body></html>`
+
+const mockEmptySchedulePage = `<html><body>
+<h1 class="schedule-header">Your Schedule</h1>
+<p>You have no upcoming orders.</p>
+</body></html>`
+
+// mockLogo is a one pixel PNG
+var mockLogo, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII=")
+
+// imageRequests returns the number of requests for the logo on the schedule page
+func (m *mockSite) imageRequests() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.images
+}
+
+// setStatus changes the status shown on the schedule page
+func (m *mockSite) setStatus(status OrderStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = status
+}
+
+// setDriver shows a delivery driver on the schedule card
+func (m *mockSite) setDriver(driver string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.driver = driver
+}
+
+// update changes the site while it is running
+func (m *mockSite) update(change func(m *mockSite)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(m)
+}
+
+// expire ends every session
+func (m *mockSite) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expired = true
+}
+
+func (m *mockSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// This never finishes, so it mustn't hold the lock
+	if r.URL.Path == "/stalled.png" {
+		<-r.Context().Done()
+		return
+	}
+	m.mu.Lock()
+	hung := m.hung
+	m.mu.Unlock()
+	if hung && r.URL.Path == "/schedule" {
+		<-r.Context().Done()
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/schedule":
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "ok" || m.expired {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		if m.stalled {
+			fmt.Fprint(w, `<html><body><img src="/stalled.png">`)
+		}
+		if m.empty {
+			fmt.Fprint(w, mockEmptySchedulePage)
+			return
+		}
+		driver := ""
+		if m.driver != "" {
+			driver = fmt.Sprintf(`<div class="schedule-card-driver-name">%s</div><div class="schedule-card-driver-location">2 stops away</div>`, m.driver)
+		}
+		fmt.Fprintf(w, mockSchedulePage, m.status, driver)
+	case r.URL.Path == "/logo.png":
+		m.images++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(mockLogo) //nolint:errcheck
+	case r.URL.Path == "/api/order":
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "ok" || m.expired {
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"order": {"id": "A100", "vendor": "Tasty Tacos", "status": %q, "eta": "12:45 PM"}}`, m.status)
+	case r.URL.Path == "/login" && r.Method == http.MethodGet:
+		fmt.Fprint(w, mockLoginPage)
+	case r.URL.Path == "/login" && r.Method == http.MethodPost:
+		http.Redirect(w, r, "/login/password", http.StatusFound)
+	case r.URL.Path == "/login/password" && r.Method == http.MethodGet:
+		fmt.Fprintf(w, mockPasswordPage, "")
+	case r.URL.Path == "/login/password" && r.Method == http.MethodPost:
+		if r.FormValue("password") != m.password {
+			message := "Wrong email or password"
+			if m.careless {
+				message = "Wrong password " + html.EscapeString(r.FormValue("password"))
+			}
+			fmt.Fprintf(w, mockPasswordPage, `<span id="error-element-password">`+message+`</span>`)
+			return
+		}
+		m.expired = false
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok", Path: "/"})
+		http.Redirect(w, r, "/schedule", http.StatusFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var _ = Describe("Mock Site", func() {
+	var (
+		site   *mockSite
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		site = &mockSite{password: "hunter2", status: OrderStatusPlaced}
+		server = httptest.NewServer(site)
+		DeferCleanup(server.Close)
+	})
+
+	It("should send visitors without a session to the login form", func() {
+		resp, err := server.Client().Get(server.URL + "/schedule")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+		Expect(resp.Request.URL.Path).To(Equal("/login"))
+	})
+
+	It("should show the schedule after the login form is completed", func() {
+		jar, err := cookiejar.New(nil)
+		Expect(err).NotTo(HaveOccurred())
+		client := &http.Client{Jar: jar}
+
+		resp, err := client.PostForm(server.URL+"/login/password", url.Values{"password": {"wrong"}})
+		Expect(err).NotTo(HaveOccurred())
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close() //nolint:errcheck
+		Expect(string(body)).To(ContainSubstring("Wrong email or password"))
+
+		resp, err = client.PostForm(server.URL+"/login/password", url.Values{"password": {"hunter2"}})
+		Expect(err).NotTo(HaveOccurred())
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close() //nolint:errcheck
+		Expect(resp.Request.URL.Path).To(Equal("/schedule"))
+		Expect(parseETA(string(body))).To(Equal("12:30 PM"))
+		Expect(string(body)).To(ContainSubstring(`<div class="schedule-card-label">Order Placed</div>`))
+	})
+
+	// These drive a real headless browser through the login flow, so they only run
+	// where Chrome or Chromium is installed
+	Describe("with a browser", func() {
+		var notifier *Notifier
+
+		newNotifierLogging := func(password string, logger *slog.Logger) *Notifier {
+			bin, found := launcher.LookPath()
+			if !found {
+				Skip("no Chrome or Chromium browser found")
+			}
+
+			config := &Config{
+				Headless:    true,
+				ChromeBin:   bin,
+				NoSandbox:   true,
+				PageTimeout: 10 * time.Second,
+			}
+			n := NewNotifier(config, &Credentials{Username: "user@example.com", Password: password}, logger)
+			n.loginUrl = server.URL + "/schedule"
+
+			Expect(n.InitializeBrowser()).To(Succeed())
+			DeferCleanup(n.Close)
+			return n
+		}
+
+		newNotifier := func(password string) *Notifier {
+			return newNotifierLogging(password, newTestLogger())
+		}
+
+		It("should load the login page without logging in", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.OpenLoginPage(context.Background())).To(Succeed())
+
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrSessionExpired))
+		})
+
+		It("should log in and read the order status", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info).To(Equal(OrderInfo{Status: OrderStatusPlaced, ETA: "12:30 PM", Vendor: "Tasty Tacos", OrderID: "A100"}))
+
+			site.setStatus(OrderStatusArrived)
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+
+			info, err = notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusArrived))
+		})
+
+		It("should read the driver when one is shown", func() {
+			notifier = newNotifier("hunter2")
+			site.setDriver("Sam")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			// The order hasn't been sent out yet, so the driver has only been assigned
+			Expect(info.Status).To(Equal(OrderStatusDriverAssigned))
+			Expect(info.Driver).To(Equal("Sam"))
+			Expect(info.DriverLocation).To(Equal("2 stops away"))
+		})
+
+		It("should read the order with the configured ID", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.OrderID = "B200"
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info).To(Equal(OrderInfo{Status: OrderStatusDelayed, ETA: "1:15 PM", Vendor: "Pizza Palace", OrderID: "B200"}))
+
+			notifier.config.OrderID = "C300"
+			_, err = notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrOrderNotFound))
+			Expect(err).To(MatchError(ContainSubstring("found A100, B200")))
+		})
+
+		It("should click the configured login buttons", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.EmailButtonSelector = "form[action='/login'] button[type='submit']"
+			notifier.config.PasswordButtonSelector = "form[action='/login/password'] button[type='submit']"
+
+			Expect(notifier.Login(context.Background())).To(Succeed())
+		})
+
+		It("should report rejected credentials", func() {
+			notifier = newNotifier("wrong")
+			Expect(notifier.Login(context.Background())).To(MatchError(ErrInvalidCredentials))
+		})
+
+		It("should save the page when the status is unknown", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.SnapshotDir = GinkgoT().TempDir()
+			site.setStatus("Lost in Space")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusUnknown))
+
+			snapshots, err := filepath.Glob(filepath.Join(notifier.config.SnapshotDir, "relish-*.html"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(HaveLen(1))
+			Expect(os.ReadFile(snapshots[0])).To(ContainSubstring("Lost in Space"))
+		})
+
+		It("should load the logo normally", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+			Eventually(site.imageRequests).Should(BeNumerically(">", 0))
+		})
+
+		It("should block images when requested", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.BlockResources = true
+			Expect(notifier.Restart()).To(Succeed())
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusPlaced))
+			Consistently(site.imageRequests, 200*time.Millisecond).Should(BeZero())
+		})
+
+		It("should read the status from the API", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.APIMode = true
+			notifier.config.APIURL = "/api/order"
+			notifier.config.APIStatusField = "order.status"
+			notifier.config.APIETAField = "order.eta"
+			notifier.config.APIOrderIDField = "order.id"
+			notifier.config.APIVendorField = "order.vendor"
+			site.setStatus(OrderStatusOutForDelivery)
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			// The page shows 12:30 PM, so this came from the API
+			Expect(info).To(Equal(OrderInfo{Status: OrderStatusOutForDelivery, ETA: "12:45 PM", Vendor: "Tasty Tacos", OrderID: "A100"}))
+		})
+
+		It("should read the page when the API reports another order", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.APIMode = true
+			notifier.config.APIURL = "/api/order"
+			notifier.config.APIStatusField = "order.status"
+			notifier.config.APIOrderIDField = "order.id"
+			notifier.config.OrderID = "B200"
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info).To(Equal(OrderInfo{Status: OrderStatusDelayed, ETA: "1:15 PM", Vendor: "Pizza Palace", OrderID: "B200"}))
+		})
+
+		It("should read the page when the API request fails", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.APIMode = true
+			notifier.config.APIURL = "/api/missing"
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusPlaced))
+			Expect(info.ETA).To(Equal("12:30 PM"))
+		})
+
+		It("should keep the password out of logs and errors when logging in fails", func() {
+			const password = "correct-horse-battery"
+			site.update(func(m *mockSite) { m.careless = true })
+
+			buf := &bytes.Buffer{}
+			logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			notifier = newNotifierLogging(password, logger)
+
+			err := notifier.Login(context.Background())
+			Expect(err).To(MatchError(ErrInvalidCredentials))
+			Expect(err.Error()).To(ContainSubstring("Wrong password " + redacted))
+			logger.Error("failed to log in", "error", err)
+
+			Expect(buf.String()).To(ContainSubstring(redacted))
+			Expect(buf.String()).NotTo(ContainSubstring(password))
+		})
+
+		It("should fail to log in when nothing shows that it worked", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.PageTimeout = time.Second
+			notifier.config.LoginSuccessSelector = ".not-on-the-page"
+
+			err := notifier.Login(context.Background())
+			Expect(err).To(MatchError(ErrLoginFailed))
+			Expect(err).To(MatchError(ContainSubstring(server.URL + "/schedule")))
+		})
+
+		It("should count a login to an empty schedule as successful", func() {
+			notifier = newNotifier("hunter2")
+			site.update(func(m *mockSite) { m.empty = true })
+
+			Expect(notifier.Login(context.Background())).To(Succeed())
+		})
+
+		It("should capture the current page", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			html, screenshot, err := notifier.Capture(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(html).To(ContainSubstring("Tasty Tacos"))
+			Expect(screenshot).NotTo(BeEmpty())
+		})
+
+		It("should show what a selector matches on the schedule", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			match, err := notifier.Inspect(context.Background(), ".schedule-card-label", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(match.URL).To(HaveSuffix("/schedule"))
+			Expect(match.Count).To(Equal(1))
+			Expect(match.Text).To(Equal("Order Placed"))
+
+			match, err = notifier.Inspect(context.Background(), ".no-such-thing", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(match.Count).To(BeZero())
+
+			_, err = notifier.Inspect(context.Background(), "[[", false)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should describe the markup of the first schedule card", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			markup, err := notifier.ScheduleMarkup(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(markup.Elements).To(Equal([]string{
+				"div.schedule-card",
+				"div.schedule-card>div",
+				"div.schedule-card>div.schedule-card-label",
+				"div.schedule-card>div.schedule-card-vendor",
+			}))
+
+			// The status text isn't part of the structure
+			site.setStatus(OrderStatusArrived)
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+			again, err := notifier.ScheduleMarkup(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again.Hash).To(Equal(markup.Hash))
+		})
+
+		It("should stop loading a page that never responds as soon as it is cancelled", func() {
+			notifier = newNotifier("hunter2")
+			site.update(func(m *mockSite) { m.hung = true })
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(500*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := notifier.OpenLoginPage(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			// Well short of the page timeout
+			Expect(time.Since(start)).To(BeNumerically("<", notifier.config.PageTimeout/2))
+		})
+
+		It("should give logging in and checks their own page timeouts", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.LoginTimeout = time.Second
+			notifier.config.CheckTimeout = time.Second
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			site.update(func(m *mockSite) { m.hung = true })
+			start := time.Now()
+			Expect(notifier.Refresh(context.Background())).NotTo(Succeed())
+			// Each reload gave up after the check timeout rather than the page timeout
+			Expect(time.Since(start)).To(BeNumerically("<", notifier.config.PageTimeout))
+		})
+
+		It("should tell a page without an order from one that is still loading", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+			notifier.config.PageTimeout = time.Second
+			notifier.config.ReadySelector = ".schedule-header"
+
+			site.update(func(m *mockSite) { m.empty = true })
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrStatusNotFound))
+			Expect(err).To(MatchError(ErrStatusMissing))
+
+			site.update(func(m *mockSite) { m.stalled = true })
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+			_, err = notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrStatusNotFound))
+			Expect(err).To(MatchError(ErrPageLoading))
+		})
+
+		It("should not count a page without the ready element as loaded", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+			notifier.config.PageTimeout = time.Second
+			notifier.config.ReadySelector = ".not-on-the-page"
+
+			site.update(func(m *mockSite) { m.empty = true })
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrPageLoading))
+		})
+
+		It("should record each check and replay it", func() {
+			notifier = newNotifier("hunter2")
+			notifier.config.RecordDir = GinkgoT().TempDir()
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			dirs, err := RecordingDirs(notifier.config.RecordDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dirs).To(HaveLen(1))
+			Expect(filepath.Join(dirs[0], RecordingScreenshot)).To(BeAnExistingFile())
+
+			recording, html, err := ReadRecording(dirs[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recording.Info.Status).To(Equal(OrderStatusPlaced))
+			Expect(html).NotTo(ContainSubstring("hunter2"))
+
+			// The replay reads the recorded page, not the site
+			site.setStatus("Lost in Space")
+			info, err := notifier.Replay(context.Background(), html)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info).To(Equal(recording.Info))
+		})
+
+		It("should log in with a session cookie", func() {
+			notifier = newNotifier("")
+			notifier.credentials.SessionCookie = "session=ok"
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusPlaced))
+		})
+
+		It("should report a session cookie the site doesn't accept", func() {
+			notifier = newNotifier("")
+			notifier.credentials.SessionCookie = "session=stale"
+
+			err := notifier.Login(context.Background())
+			Expect(err).To(MatchError(ErrInvalidCredentials))
+			Expect(err.Error()).NotTo(ContainSubstring("stale"))
+		})
+
+		It("should log in again after restarting the browser", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			Expect(notifier.Restart()).To(Succeed())
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusPlaced))
+		})
+
+		It("should recover from the browser crashing", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			// Closing the browser out from under the notifier looks the same as a crash
+			Expect(proto.BrowserClose{}.Call(notifier.browser)).To(Succeed())
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrBrowserDisconnected))
+
+			Expect(notifier.Restart()).To(Succeed())
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			info, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusPlaced))
+		})
+
+		It("should ask before every page load", func() {
+			notifier = newNotifier("hunter2")
+			loads := 0
+			notifier.BeforeLoad = func(ctx context.Context) error {
+				loads++
+				return nil
+			}
+
+			Expect(notifier.Login(context.Background())).To(Succeed())
+			Expect(loads).To(Equal(1))
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+			Expect(loads).To(Equal(2))
+
+			// A quick retry reloads the page too
+			notifier.config.PageTimeout = time.Second
+			notifier.config.QuickRetries = 1
+			notifier.config.QuickRetryDelay = time.Millisecond
+			site.update(func(m *mockSite) { m.empty = true })
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrStatusNotFound))
+			Expect(loads).To(Equal(3))
+		})
+
+		It("should not load the page when BeforeLoad fails", func() {
+			notifier = newNotifier("hunter2")
+			notifier.BeforeLoad = func(ctx context.Context) error {
+				return context.Canceled
+			}
+
+			Expect(notifier.Login(context.Background())).To(MatchError(context.Canceled))
+		})
+
+		It("should notice when the session expires", func() {
+			notifier = newNotifier("hunter2")
+			Expect(notifier.Login(context.Background())).To(Succeed())
+
+			site.expire()
+			Expect(notifier.Refresh(context.Background())).To(Succeed())
+
+			_, err := notifier.CheckOrderStatus(context.Background())
+			Expect(err).To(MatchError(ErrSessionExpired))
+		})
+	})
+})
@@ -0,0 +1,114 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// markupScript describes every element under the first element matching a selector by its
+// path of tag names and classes from there, such as "div.schedule-card>span.label". It
+// returns the descriptions as JSON, or null if nothing matches.
+const markupScript = `(selector) => {
+	const root = document.querySelector(selector);
+	if (!root) {
+		return null;
+	}
+	const elements = [];
+	const walk = (element, path) => {
+		const classes = Array.from(element.classList).sort();
+		const shape = (path ? path + ">" : "") + [element.tagName.toLowerCase(), ...classes].join(".");
+		elements.push(shape);
+		for (const child of element.children) {
+			walk(child, shape);
+		}
+	};
+	walk(root, "");
+	return JSON.stringify(elements);
+}`
+
+// Markup describes the structure of a schedule card, leaving out its text, so that a change
+// to the site's markup can be noticed before it breaks the selectors
+type Markup struct {
+	// Hash identifies the structure. It changes whenever Elements does.
+	Hash string `json:"hash"`
+	// Elements describes each distinct element of the card by its path of tag names and
+	// classes from the card, in sorted order
+	Elements []string `json:"elements"`
+}
+
+// NewMarkup creates the Markup of a card with the given elements
+func NewMarkup(elements []string) Markup {
+	elements = slices.Clone(elements)
+	slices.Sort(elements)
+	elements = slices.Compact(elements)
+
+	sum := sha256.Sum256([]byte(strings.Join(elements, "\n")))
+	return Markup{Hash: hex.EncodeToString(sum[:8]), Elements: elements}
+}
+
+// Similarity returns the share of the elements of either card that both have, from 0 for
+// cards with nothing in common to 1 for the same structure
+func (m Markup) Similarity(other Markup) float64 {
+	if m.Hash == other.Hash {
+		return 1
+	}
+
+	shared := 0
+	for _, element := range m.Elements {
+		if _, found := slices.BinarySearch(other.Elements, element); found {
+			shared++
+		}
+	}
+	total := len(m.Elements) + len(other.Elements) - shared
+	if total == 0 {
+		return 1
+	}
+	return float64(shared) / float64(total)
+}
+
+// ScheduleMarkup returns the Markup of the first schedule card on the current page
+func (n *Notifier) ScheduleMarkup(ctx context.Context) (Markup, error) {
+	if n.page == nil {
+		return Markup{}, fmt.Errorf("no page is open")
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	result, err := page.Eval(markupScript, cardSelector)
+	if err != nil {
+		return Markup{}, fmt.Errorf("failed to read page markup: %w", err)
+	}
+	if result.Value.Nil() {
+		return Markup{}, fmt.Errorf("%q matches nothing on the page", cardSelector)
+	}
+
+	var elements []string
+	if err := json.Unmarshal([]byte(result.Value.Str()), &elements); err != nil {
+		return Markup{}, fmt.Errorf("failed to read page markup: %w", err)
+	}
+	return NewMarkup(elements), nil
+}
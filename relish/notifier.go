@@ -0,0 +1,1385 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// DefaultLoginURL is the page the Notifier navigates to in order to log in
+const DefaultLoginURL string = "https://relish.ezcater.com/schedule"
+
+const (
+	// loginErrorSelector matches the error messages shown by the login form
+	loginErrorSelector = "#error-element-password, #error-element-username, .ulp-input-error-message"
+	emailSelector      = "#identity_email"
+	otpSelector        = "#code"
+	cardSelector       = ".schedule-card"
+	orderIDAttribute   = "data-order-id"
+	vendorSelector     = ".schedule-card-vendor"
+	driverSelector     = ".schedule-card-driver-name"
+	// driverLocationSelector matches a rough description of where the driver is, such as "2 stops away"
+	driverLocationSelector = ".schedule-card-driver-location"
+)
+
+// Default selectors for the elements the Notifier looks for
+const (
+	// DefaultStatusSelector matches the element holding the order status
+	DefaultStatusSelector = ".schedule-card-label"
+	// DefaultEmailButtonSelector matches the button that submits the email address
+	DefaultEmailButtonSelector = "[name='commit']"
+	// DefaultPasswordButtonSelector matches the button that submits the password, and the
+	// two-factor authentication code
+	DefaultPasswordButtonSelector = "[name='action']"
+	// DefaultLoginSuccessSelector matches elements that are only shown once logged in: a
+	// schedule card, or the header of a schedule without any orders
+	DefaultLoginSuccessSelector = ".schedule-card, .schedule-header"
+)
+
+// DefaultLanguage is the language the status text is expected to be in
+const DefaultLanguage = "en-US"
+
+// languagePattern matches a language tag such as "en" or "es-MX"
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// refreshRetryDelay is the wait between attempts to reload the page
+const refreshRetryDelay = time.Second
+
+// invalidCredentialsPattern matches the messages shown when the email or password is wrong
+var invalidCredentialsPattern = regexp.MustCompile(`(?i)(wrong|invalid|incorrect)\s+(email|username|password|credentials)`)
+
+// The headless modes accepted by Config.HeadlessMode
+const (
+	HeadlessModeOld = "old"
+	HeadlessModeNew = "new"
+)
+
+// Config controls how the Notifier launches and drives the browser
+type Config struct {
+	Headless    bool
+	Extensions  bool
+	PageTimeout time.Duration
+	// LoginTimeout and CheckTimeout replace PageTimeout for each page operation while
+	// logging in, and while checking the order status or refreshing the page, so that a
+	// slow login doesn't make checks slow to notice a problem. If zero, PageTimeout is used.
+	LoginTimeout time.Duration
+	CheckTimeout time.Duration
+	// HeadlessMode selects Chrome's headless implementation when Headless is set:
+	// HeadlessModeOld (or empty) for the legacy one, or HeadlessModeNew, which renders pages
+	// the same way as a normal browser window
+	HeadlessMode string
+	// DisableStealth launches a plain browser without the options that hide automation
+	DisableStealth bool
+	// ChromeBin is the path to the Chrome or Chromium binary. If empty, the browser is located automatically.
+	ChromeBin string
+	// ChromeFlags are extra command line flags for a browser that is launched, each either
+	// "name" or "name=value", with or without the leading dashes. They are applied after the
+	// built in options, so they can override them.
+	ChromeFlags []string
+	// RemoteURL is the DevTools URL of an already running browser to use instead of launching one.
+	// Both http(s):// endpoints and ws(s):// debugger URLs are accepted.
+	RemoteURL string
+	// Incognito opens the page in a remote browser in its own incognito browser context,
+	// so that several Notifiers can share the browser without sharing cookies. Closing the
+	// Notifier then disposes of the context. A browser the Notifier launches is its own
+	// already, so this only applies with RemoteURL.
+	Incognito bool
+	// WindowWidth and WindowHeight set the browser window and viewport size. If either is zero,
+	// the browser default is used.
+	WindowWidth  int
+	WindowHeight int
+	// QuickRetries is the number of times a check reloads the page and tries again, after
+	// waiting QuickRetryDelay, when the status element is missing
+	QuickRetries    int
+	QuickRetryDelay time.Duration
+	// RefreshRetries is the number of times a failed page reload is retried before the
+	// page is replaced with a new one
+	RefreshRetries int
+	// NoSandbox disables the Chrome sandbox, which is required when running as root in
+	// many containers. It also keeps Chrome from relying on a small /dev/shm.
+	NoSandbox bool
+	// BlockResources stops the page from loading images, fonts, and media, which aren't
+	// needed to read the order status, to make each check faster and lighter
+	BlockResources bool
+	// Throttle, if set, slows down the page's network connection. It is meant for testing.
+	Throttle *Throttle
+	// Warmup visits the site's home page, and waits WarmupDelay, before going to the login
+	// page, the way a person would
+	Warmup      bool
+	WarmupDelay time.Duration
+	// Language is a language tag such as "en-US" that the browser uses for its interface and
+	// asks the site for with Accept-Language. If empty, the browser default is used.
+	Language string
+	// StatusSelectors are the selectors tried, in order, to find the order status. The first
+	// one that matches an element is used. If empty, DefaultStatusSelector is used.
+	StatusSelectors []string
+	// SnapshotDir, if set, is a directory where the page HTML is saved whenever a check fails
+	// or finds an unknown status
+	SnapshotDir string
+	// RecordDir, if set, is a directory where every check is recorded: a numbered directory
+	// for each check holds a screenshot, the page HTML, and what was read from the page.
+	// Recordings can be checked against the current selectors with Notifier.Replay.
+	RecordDir string
+	// ReadySelector, if set, matches an element that is always on the schedule page once it
+	// has loaded, such as the page header. When the order status can't be found, the page
+	// counts as loaded only if it has finished loading and this element is there.
+	ReadySelector string
+	// EmailButtonSelector and PasswordButtonSelector match the buttons clicked to submit the
+	// email address and password. PasswordButtonSelector also submits the two-factor
+	// authentication code. If empty, the defaults are used.
+	EmailButtonSelector    string
+	PasswordButtonSelector string
+	// LoginSuccessSelector matches an element that is only shown once logged in. Login
+	// waits up to LoginTimeout for it, and returns ErrLoginFailed if it doesn't appear. If
+	// empty, DefaultLoginSuccessSelector is used.
+	LoginSuccessSelector string
+	// APIMode reads the order status from the JSON endpoint at APIURL, which the schedule
+	// page itself calls, instead of from the page. The request is made from the page with
+	// the logged in session. If it fails, the page is read as usual.
+	APIMode bool
+	APIURL  string
+	// APIStatusField, APIETAField, APIOrderIDField, APIVendorField, APIDriverField, and
+	// APIDriverLocationField are the dotted paths, such as "orders.0.status", of the
+	// details of the order in the API response. If empty, the defaults are used. With
+	// OrderID, the API is only used while it reports that order.
+	APIStatusField         string
+	APIETAField            string
+	APIOrderIDField        string
+	APIVendorField         string
+	APIDriverField         string
+	APIDriverLocationField string
+	// OrderID, if set, selects the schedule card for one order, matched against the card's
+	// data-order-id attribute, instead of using the first card on the page
+	OrderID string
+	// Location is the time zone that times read from the API are shown in. If nil, the
+	// local time zone is used.
+	Location *time.Location
+}
+
+// location returns the configured time zone, or the local one if none is set
+func (c *Config) location() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
+// selectorOrDefault returns selector, or fallback if selector is empty
+func selectorOrDefault(selector, fallback string) string {
+	if selector == "" {
+		return fallback
+	}
+	return selector
+}
+
+// statusSelectors returns the configured status selectors, or the default if none are set
+func (c *Config) statusSelectors() []string {
+	if len(c.StatusSelectors) == 0 {
+		return []string{DefaultStatusSelector}
+	}
+	return c.StatusSelectors
+}
+
+// Validate checks the configuration for problems that would otherwise only surface when launching the browser
+func (c *Config) Validate() error {
+	if c.ChromeBin != "" && c.RemoteURL != "" {
+		return fmt.Errorf("a chrome binary and a remote browser URL cannot be used together")
+	}
+
+	if len(c.ChromeFlags) > 0 && c.RemoteURL != "" {
+		return fmt.Errorf("chrome flags cannot be used with a remote browser")
+	}
+
+	for _, flag := range c.ChromeFlags {
+		if name, _ := parseChromeFlag(flag); name == "" {
+			return fmt.Errorf("invalid chrome flag %q: expected name or name=value", flag)
+		}
+	}
+
+	if c.ChromeBin != "" {
+		info, err := os.Stat(c.ChromeBin)
+		if err != nil {
+			return fmt.Errorf("invalid chrome binary: %w", err)
+		}
+		if info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+			return fmt.Errorf("invalid chrome binary: %s is not an executable file", c.ChromeBin)
+		}
+	}
+
+	switch c.HeadlessMode {
+	case "", HeadlessModeOld, HeadlessModeNew:
+	default:
+		return fmt.Errorf("invalid headless mode %q: expected %s or %s", c.HeadlessMode, HeadlessModeOld, HeadlessModeNew)
+	}
+
+	if c.APIMode && c.APIURL == "" {
+		return fmt.Errorf("API mode requires an API URL")
+	}
+
+	if c.WindowWidth < 0 || c.WindowHeight < 0 {
+		return fmt.Errorf("invalid window size %dx%d", c.WindowWidth, c.WindowHeight)
+	}
+
+	if c.PageTimeout < 0 || c.LoginTimeout < 0 || c.CheckTimeout < 0 {
+		return fmt.Errorf("invalid page timeout: values must not be negative")
+	}
+
+	if c.QuickRetries < 0 || c.QuickRetryDelay < 0 {
+		return fmt.Errorf("invalid quick retry settings: values must not be negative")
+	}
+
+	if c.Language != "" && !languagePattern.MatchString(c.Language) {
+		return fmt.Errorf("invalid language %q: expected a language tag such as en-US", c.Language)
+	}
+
+	if c.RefreshRetries < 0 {
+		return fmt.Errorf("invalid refresh retries %d: must not be negative", c.RefreshRetries)
+	}
+
+	if c.WarmupDelay < 0 {
+		return fmt.Errorf("invalid warmup delay %s: must not be negative", c.WarmupDelay)
+	}
+
+	for _, selector := range c.StatusSelectors {
+		if strings.TrimSpace(selector) == "" {
+			return fmt.Errorf("invalid status selector: selectors must not be empty")
+		}
+	}
+
+	if c.RemoteURL != "" {
+		u, err := url.Parse(c.RemoteURL)
+		if err != nil {
+			return fmt.Errorf("invalid remote browser URL: %w", err)
+		}
+
+		switch u.Scheme {
+		case "http", "https", "ws", "wss":
+		default:
+			return fmt.Errorf("invalid remote browser URL %q: scheme must be one of http, https, ws, or wss", c.RemoteURL)
+		}
+
+		if u.Host == "" {
+			return fmt.Errorf("invalid remote browser URL %q: missing host", c.RemoteURL)
+		}
+	}
+
+	return nil
+}
+
+// Credentials are used to log in to Relish
+type Credentials struct {
+	Username string
+	Password string
+	// TOTPSecret is the base32 encoded secret used to generate two-factor authentication codes
+	TOTPSecret string
+	// SessionCookie, if set, is used instead of the username and password. It holds the
+	// cookies of a logged in browser in Cookie header form, e.g. "session=abc; other=def".
+	SessionCookie string
+}
+
+// Notifier drives a browser session against the Relish website
+type Notifier struct {
+	Callbacks
+	// PromptOTP, if set, is called to obtain a two-factor authentication code when the
+	// site asks for one and no TOTP secret is available
+	PromptOTP func(ctx context.Context) (string, error)
+	// BeforeLoad, if set, is called before every page load and API request, such as to
+	// limit how often the site is asked for pages. If it returns an error, the load doesn't
+	// happen. Submitting the login form isn't a separate load.
+	BeforeLoad func(ctx context.Context) error
+
+	browser     *rod.Browser
+	page        *rod.Page
+	config      *Config
+	credentials *Credentials
+	logger      *slog.Logger
+	loginUrl    string
+	// blocker blocks resources on the current page when Config.BlockResources is set, and
+	// blocked counts the requests it has blocked
+	blocker *rod.HijackRouter
+	blocked atomic.Int64
+}
+
+// NewNotifier creates a new Notifier instance with the provided configuration, credentials, and logger.
+// If logger is nil, log output is discarded.
+func NewNotifier(config *Config, credentials *Credentials, logger *slog.Logger) *Notifier {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	n := &Notifier{
+		config:      config,
+		credentials: credentials,
+		loginUrl:    DefaultLoginURL,
+	}
+	n.logger = newRedactLogger(logger, n.secrets)
+	return n
+}
+
+// secrets returns the credentials that must never appear in logs or errors
+func (n *Notifier) secrets() []string {
+	if n.credentials == nil {
+		return nil
+	}
+	return []string{n.credentials.Password, n.credentials.TOTPSecret, n.credentials.SessionCookie}
+}
+
+// InitializeBrowser sets up the browser instance with stealth options and configures the page
+func (n *Notifier) InitializeBrowser() error {
+	n.logger.Debug("initializing browser")
+
+	if err := n.config.Validate(); err != nil {
+		return err
+	}
+
+	controlURL, launched, err := n.controlURL()
+	if err != nil {
+		return err
+	}
+
+	browser := rod.New().ControlURL(controlURL)
+
+	if err := browser.Connect(); err != nil {
+		if n.config.RemoteURL != "" {
+			return fmt.Errorf("failed to connect to remote browser at %s: %w", n.config.RemoteURL, err)
+		}
+		// Without a connection, the browser that was just launched can only be killed
+		launched.Kill()
+		launched.Cleanup()
+		return fmt.Errorf("failed to connect to browser: %w", err)
+	}
+
+	// Everything opened in the incognito browser stays in its context
+	if n.sharesBrowser() {
+		incognito, err := browser.Incognito()
+		if err != nil {
+			n.discardBrowser(browser)
+			return fmt.Errorf("failed to create incognito browser context: %w", err)
+		}
+		browser = incognito
+	}
+
+	page, err := n.openPage(browser)
+	if err != nil {
+		n.discardBrowser(browser)
+		return err
+	}
+
+	n.browser = browser
+	n.page = page
+
+	return nil
+}
+
+// discardBrowser closes a browser that InitializeBrowser connected to but couldn't set up,
+// so that a failed attempt, such as one of several by Restart, doesn't leave it running. A
+// remote browser is left running, though an incognito context opened in it is closed.
+func (n *Notifier) discardBrowser(browser *rod.Browser) {
+	if n.config.RemoteURL != "" && browser.BrowserContextID == "" {
+		return
+	}
+	if err := browser.Close(); err != nil {
+		n.logger.Debug("failed to close browser", "error", err)
+	}
+}
+
+// openPage opens a new page in the browser, with the configured viewport and throttling.
+// If the page can't be set up, it is closed again.
+func (n *Notifier) openPage(browser *rod.Browser) (*rod.Page, error) {
+	page, err := browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open page: %w", err)
+	}
+
+	if err := n.setUpPage(page); err != nil {
+		if closeErr := page.Close(); closeErr != nil {
+			n.logger.Debug("failed to close page", "error", closeErr)
+		}
+		return nil, err
+	}
+	return page, nil
+}
+
+// setUpPage applies the configured viewport, language, throttling, and resource blocking
+// to a new page
+func (n *Notifier) setUpPage(page *rod.Page) error {
+	if n.hasWindowSize() {
+		// The viewport must be set on the page as well, since a remote browser ignores launch flags
+		if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+			Width:             n.config.WindowWidth,
+			Height:            n.config.WindowHeight,
+			DeviceScaleFactor: 1,
+		}); err != nil {
+			return fmt.Errorf("failed to set viewport: %w", err)
+		}
+	}
+
+	// The launch flag only covers the browser's own interface, and a remote browser ignores it
+	if n.config.Language != "" {
+		if _, err := page.SetExtraHeaders([]string{"Accept-Language", n.config.Language}); err != nil {
+			return fmt.Errorf("failed to set language: %w", err)
+		}
+	}
+
+	if n.config.Throttle != nil {
+		n.logger.Warn("throttling network", "latency", n.config.Throttle.Latency,
+			"download_kbps", n.config.Throttle.DownloadKbps, "upload_kbps", n.config.Throttle.UploadKbps)
+		if err := (proto.NetworkEnable{}).Call(page); err != nil {
+			return fmt.Errorf("failed to enable network domain: %w", err)
+		}
+		if err := n.config.Throttle.networkConditions().Call(page); err != nil {
+			return fmt.Errorf("failed to throttle network: %w", err)
+		}
+	}
+
+	if n.config.BlockResources {
+		blocker, err := blockResources(page, &n.blocked)
+		if err != nil {
+			return err
+		}
+		// The page the old blocker was set up for is about to be replaced
+		if n.blocker != nil {
+			if err := n.blocker.Stop(); err != nil {
+				n.logger.Debug("failed to stop blocking resources on old page", "error", err)
+			}
+		}
+		n.blocker = blocker
+	}
+
+	return nil
+}
+
+// sharesBrowser reports whether the Notifier has a context of its own in a remote browser
+func (n *Notifier) sharesBrowser() bool {
+	return n.config.RemoteURL != "" && n.config.Incognito
+}
+
+// hasWindowSize reports whether a window size has been configured
+func (n *Notifier) hasWindowSize() bool {
+	return n.config.WindowWidth > 0 && n.config.WindowHeight > 0
+}
+
+// controlURL returns the DevTools websocket URL of the browser, launching a local browser
+// unless a remote one is configured. The launcher of a local browser is returned too, so
+// that it can be killed if connecting to it fails.
+func (n *Notifier) controlURL() (string, *launcher.Launcher, error) {
+	if n.config.RemoteURL == "" {
+		l := n.newLauncher()
+		u, err := l.Launch()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to launch browser: %w", err)
+		}
+		return u, l, nil
+	}
+
+	n.logger.Debug("using remote browser", "url", n.config.RemoteURL)
+
+	// Websocket URLs can be used as-is; http endpoints must be asked for their debugger URL
+	if strings.HasPrefix(n.config.RemoteURL, "ws://") || strings.HasPrefix(n.config.RemoteURL, "wss://") {
+		return n.config.RemoteURL, nil, nil
+	}
+
+	u, err := launcher.ResolveURL(n.config.RemoteURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to reach remote browser at %s: %w", n.config.RemoteURL, err)
+	}
+	return u, nil, nil
+}
+
+// newLauncher builds the browser launcher from the configuration
+func (n *Notifier) newLauncher() *launcher.Launcher {
+	l := launcher.New()
+
+	if n.config.ChromeBin != "" {
+		l = l.Bin(n.config.ChromeBin)
+	}
+
+	// Set headless mode explicitly (Rod defaults to headless=true)
+	l = l.Headless(n.config.Headless)
+	if n.config.Headless && n.config.HeadlessMode == HeadlessModeNew {
+		l = l.Set("headless", "new")
+	}
+
+	if n.hasWindowSize() {
+		l = l.Set("window-size", fmt.Sprintf("%d,%d", n.config.WindowWidth, n.config.WindowHeight))
+	}
+
+	if !n.config.Extensions {
+		l = l.Set("disable-extensions")
+	}
+
+	if n.config.Language != "" {
+		l = l.Set("lang", n.config.Language)
+	}
+
+	// Rod already disables the sandbox when it detects a container, but not every
+	// container runtime is detected
+	if n.config.NoSandbox {
+		l = l.NoSandbox(true).Set("disable-dev-shm-usage")
+	}
+
+	// Set stealth options similar to selenium-stealth
+	if n.config.DisableStealth {
+		n.logger.Debug("stealth options disabled")
+	} else {
+		l = l.
+			Set("exclude-switches", "enable-automation").
+			Set("disable-blink-features", "AutomationControlled").
+			Set("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	}
+
+	for _, flag := range n.config.ChromeFlags {
+		name, value := parseChromeFlag(flag)
+		if value == "" {
+			l = l.Set(flags.Flag(name))
+		} else {
+			l = l.Set(flags.Flag(name), value)
+		}
+	}
+	if len(n.config.ChromeFlags) > 0 {
+		n.logger.Debug("launching browser with flags", "flags", l.FormatArgs())
+	}
+
+	return l
+}
+
+// parseChromeFlag splits a flag given as "name" or "name=value", with or without leading
+// dashes, into its name and value
+func parseChromeFlag(flag string) (string, string) {
+	name, value, _ := strings.Cut(strings.TrimLeft(strings.TrimSpace(flag), "-"), "=")
+	return strings.TrimSpace(name), value
+}
+
+// pageTimeoutKey is the context key for the page timeout chosen with withPageTimeout
+type pageTimeoutKey struct{}
+
+// withPageTimeout returns ctx with pageFor limited to timeout instead of PageTimeout, or
+// ctx itself if timeout is zero
+func withPageTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, pageTimeoutKey{}, timeout)
+}
+
+// pageTimeout returns the timeout given to withPageTimeout for ctx, or else PageTimeout
+func (n *Notifier) pageTimeout(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(pageTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return n.config.PageTimeout
+}
+
+// pageFor returns the page bound to ctx and limited by its page timeout. The returned
+// function releases the timeout and must be called when the operation completes.
+func (n *Notifier) pageFor(ctx context.Context) (*rod.Page, func()) {
+	timeout := n.pageTimeout(ctx)
+
+	page := n.page.Context(ctx)
+	if timeout <= 0 {
+		return page, func() {}
+	}
+
+	page = page.Timeout(timeout)
+	return page, func() { page.CancelTimeout() }
+}
+
+// browserProbeTimeout limits how long connected waits for the browser to answer
+const browserProbeTimeout = 5 * time.Second
+
+// connected reports whether the browser still answers DevTools requests
+func (n *Notifier) connected() bool {
+	if n.browser == nil {
+		return false
+	}
+
+	_, err := proto.BrowserGetVersion{}.Call(n.browser.Timeout(browserProbeTimeout))
+	if err != nil {
+		n.logger.Debug("browser is not responding", "error", err)
+		return false
+	}
+	return true
+}
+
+// Close shuts down the browser instance if it exists. A remote browser is left
+// running and only the page opened by the Notifier, or with Incognito, its browser
+// context, is closed.
+func (n *Notifier) Close() {
+	if n.browser == nil {
+		return
+	}
+
+	if n.config.RemoteURL != "" && !n.config.Incognito {
+		if err := n.page.Close(); err != nil {
+			n.logger.Debug("failed to close page", "error", err)
+		}
+		return
+	}
+
+	// A browser that has crashed can't be closed, which isn't worth more than a mention
+	if err := n.browser.Close(); err != nil {
+		n.logger.Debug("failed to close browser", "error", err)
+	}
+}
+
+// Restart replaces the browser with a new one, which starts out logged out. This keeps a
+// long running browser from growing without bound, and recovers from one that has crashed
+// (see ErrBrowserDisconnected). The old browser is only closed once the
+// new one is running, so a failed restart leaves the Notifier as it was. With a remote
+// browser, only the page, or with Incognito, the browser context, is replaced.
+func (n *Notifier) Restart() error {
+	oldBrowser, oldPage := n.browser, n.page
+	if err := n.InitializeBrowser(); err != nil {
+		return fmt.Errorf("failed to restart browser: %w", err)
+	}
+
+	if n.config.RemoteURL != "" && !n.config.Incognito {
+		if err := oldPage.Close(); err != nil {
+			n.logger.Debug("failed to close page", "error", err)
+		}
+		return nil
+	}
+
+	if err := oldBrowser.Close(); err != nil {
+		n.logger.Debug("failed to close browser", "error", err)
+	}
+	return nil
+}
+
+// Login navigates to the Relish login page and authenticates using stored credentials, or
+// with Credentials.SessionCookie, if it is set, without entering them. It returns
+// ErrLoginFailed if Config.LoginSuccessSelector doesn't appear afterwards. Cancelling ctx
+// interrupts any navigation in progress. Errors never include the password.
+func (n *Notifier) Login(ctx context.Context) error {
+	return redactError(n.login(withPageTimeout(ctx, n.config.LoginTimeout)), n.secrets())
+}
+
+// OpenLoginPage loads the login page without logging in, to check that the site can be reached
+func (n *Notifier) OpenLoginPage(ctx context.Context) error {
+	if err := n.navigate(ctx, n.loginUrl); err != nil {
+		return fmt.Errorf("failed to load login page: %w", err)
+	}
+	return nil
+}
+
+// login performs the steps for Login
+func (n *Notifier) login(ctx context.Context) error {
+	n.logger.Info("logging in")
+
+	if n.config.Warmup {
+		if err := n.warmup(ctx); err != nil {
+			return err
+		}
+	}
+
+	if n.credentials.SessionCookie != "" {
+		return n.loginWithCookie(ctx)
+	}
+
+	if err := n.navigate(ctx, n.loginUrl); err != nil {
+		return fmt.Errorf("failed to navigate to login page: %w", err)
+	}
+
+	// Wait for and fill email field
+	emailButton := selectorOrDefault(n.config.EmailButtonSelector, DefaultEmailButtonSelector)
+	if err := n.waitAndSubmit(ctx, emailSelector, emailButton, n.credentials.Username); err != nil {
+		return fmt.Errorf("failed to submit email: %w", err)
+	}
+
+	// Wait for and fill password field
+	passwordButton := selectorOrDefault(n.config.PasswordButtonSelector, DefaultPasswordButtonSelector)
+	if err := n.waitAndSubmit(ctx, "#password", passwordButton, n.credentials.Password); err != nil {
+		return fmt.Errorf("failed to submit password: %w", err)
+	}
+
+	if err := n.checkLoginError(ctx); err != nil {
+		return err
+	}
+
+	if err := n.submitOTP(ctx); err != nil {
+		return err
+	}
+
+	// Make sure we ended up on the schedule page rather than somewhere unexpected
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	info, err := page.Info()
+	if err != nil {
+		return fmt.Errorf("failed to get page URL after login: %w", err)
+	}
+	if err := checkLandingURL(info.URL, n.loginUrl); err != nil {
+		return err
+	}
+	return n.waitForLogin(ctx)
+}
+
+// waitForLogin waits for the login success selector to confirm that logging in worked,
+// and returns ErrLoginFailed, with the URL of the page, if it doesn't appear in time
+func (n *Notifier) waitForLogin(ctx context.Context) error {
+	selector := selectorOrDefault(n.config.LoginSuccessSelector, DefaultLoginSuccessSelector)
+	n.logger.Debug("waiting for login to succeed", "selector", selector)
+
+	page, cancel := n.pageFor(ctx)
+	_, err := page.Element(selector)
+	cancel()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	current := "an unknown page"
+	if info, err := n.page.Context(ctx).Timeout(browserProbeTimeout).Info(); err == nil {
+		current = info.URL
+	}
+	return fmt.Errorf("%w: %q did not appear on %s", ErrLoginFailed, selector, current)
+}
+
+// loginWithCookie gives the browser the session cookie and loads the schedule page. If the
+// site sends it to the login form instead, the cookie is no good, and trying it again
+// won't help.
+func (n *Notifier) loginWithCookie(ctx context.Context) error {
+	cookies, err := http.ParseCookie(n.credentials.SessionCookie)
+	if err != nil {
+		return fmt.Errorf("invalid session cookie: %w", err)
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	params := make([]*proto.NetworkCookieParam, 0, len(cookies))
+	for _, cookie := range cookies {
+		params = append(params, &proto.NetworkCookieParam{Name: cookie.Name, Value: cookie.Value, URL: n.loginUrl})
+	}
+	if err := page.SetCookies(params); err != nil {
+		return fmt.Errorf("failed to set session cookie: %w", err)
+	}
+
+	if err := n.beforeLoad(ctx); err != nil {
+		return err
+	}
+	if err := page.Navigate(n.loginUrl); err != nil {
+		return fmt.Errorf("failed to navigate to schedule page: %w", err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		return fmt.Errorf("failed to load schedule page: %w", err)
+	}
+
+	if found, _, err := page.Has(emailSelector); err == nil && found {
+		return fmt.Errorf("%w: the site asked for a login, so the session cookie has expired or is wrong", ErrInvalidCredentials)
+	}
+
+	info, err := page.Info()
+	if err != nil {
+		return fmt.Errorf("failed to get page URL after login: %w", err)
+	}
+	if err := checkLandingURL(info.URL, n.loginUrl); err != nil {
+		return err
+	}
+	return n.waitForLogin(ctx)
+}
+
+// checkLandingURL verifies that the page reached after logging in is on the same site
+// and path as the expected URL
+func checkLandingURL(current, expected string) error {
+	want, err := url.Parse(expected)
+	if err != nil {
+		return fmt.Errorf("invalid expected URL %q: %w", expected, err)
+	}
+
+	got, err := url.Parse(current)
+	if err != nil || got.Host != want.Host || !strings.HasPrefix(got.Path, want.Path) {
+		return fmt.Errorf("%w: landed on %s instead of %s", ErrUnexpectedPage, current, expected)
+	}
+	return nil
+}
+
+// submitOTP completes the two-factor authentication step if the site asks for one
+func (n *Notifier) submitOTP(ctx context.Context) error {
+	found, _, err := n.page.Context(ctx).Has(otpSelector)
+	if err != nil {
+		return fmt.Errorf("failed to look for two-factor authentication prompt: %w", err)
+	}
+	if !found {
+		return nil
+	}
+
+	n.logger.Info("two-factor authentication required")
+
+	code, err := n.otpCode(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The two-factor form is submitted with the same kind of button as the password form
+	button := selectorOrDefault(n.config.PasswordButtonSelector, DefaultPasswordButtonSelector)
+	if err := n.waitAndSubmit(ctx, otpSelector, button, code); err != nil {
+		return fmt.Errorf("failed to submit two-factor authentication code: %w", err)
+	}
+
+	return nil
+}
+
+// otpCode returns a two-factor authentication code, generated from the TOTP secret or supplied by PromptOTP
+func (n *Notifier) otpCode(ctx context.Context) (string, error) {
+	switch {
+	case n.credentials.TOTPSecret != "":
+		return GenerateTOTP(n.credentials.TOTPSecret, time.Now())
+	case n.PromptOTP != nil:
+		code, err := n.PromptOTP(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read two-factor authentication code: %w", err)
+		}
+		return strings.TrimSpace(code), nil
+	default:
+		return "", fmt.Errorf("two-factor authentication code required but no TOTP secret is configured")
+	}
+}
+
+// checkLoginError returns ErrInvalidCredentials if the login form rejected the credentials
+func (n *Notifier) checkLoginError(ctx context.Context) error {
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	found, element, err := page.Has(loginErrorSelector)
+	if err != nil || !found {
+		return nil
+	}
+
+	text, err := element.Text()
+	if err != nil {
+		return nil
+	}
+
+	text = strings.TrimSpace(text)
+	if invalidCredentialsPattern.MatchString(text) {
+		return fmt.Errorf("%w: %s", ErrInvalidCredentials, text)
+	}
+
+	n.logger.Warn("login form reported an error", "error", text)
+	return nil
+}
+
+// warmup visits the home page of the site before logging in. Going straight to the
+// schedule page looks more like a bot, and draws more challenges.
+func (n *Notifier) warmup(ctx context.Context) error {
+	root, err := siteRoot(n.loginUrl)
+	if err != nil {
+		return err
+	}
+
+	n.logger.Debug("visiting home page before logging in", "url", root, "delay", n.config.WarmupDelay)
+	if err := n.navigate(ctx, root); err != nil {
+		// The login itself may still work, so don't give up here
+		n.logger.Warn("failed to visit home page", "error", err)
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(n.config.WarmupDelay):
+	}
+	return nil
+}
+
+// siteRoot returns the home page of the site that serves loginURL
+func siteRoot(loginURL string) (string, error) {
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid login URL: %w", err)
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String(), nil
+}
+
+// beforeLoad calls BeforeLoad, if it is set
+func (n *Notifier) beforeLoad(ctx context.Context) error {
+	if n.BeforeLoad == nil {
+		return nil
+	}
+	return n.BeforeLoad(ctx)
+}
+
+// navigate loads url in the page
+func (n *Notifier) navigate(ctx context.Context, url string) error {
+	if err := n.beforeLoad(ctx); err != nil {
+		return err
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	return page.Navigate(url)
+}
+
+// waitAndSubmit waits for a form field, fills it with data, then clicks the specified button
+func (n *Notifier) waitAndSubmit(ctx context.Context, fieldSelector, buttonSelector, data string) error {
+	n.logger.Debug("waiting for element before clicking", "field", fieldSelector, "button", buttonSelector)
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	// Wait for field to be present and fill it
+	field, err := page.Element(fieldSelector)
+	if err != nil {
+		return fmt.Errorf("failed to find field: %w", err)
+	}
+	if err := field.Input(data); err != nil {
+		return fmt.Errorf("failed to input data: %w", err)
+	}
+
+	// Find and click button
+	button, err := page.Element(buttonSelector)
+	if err != nil {
+		return fmt.Errorf("failed to find button: %w", err)
+	}
+
+	// Start listening for the navigation before clicking so it can't be missed
+	wait := page.WaitNavigation(proto.PageLifecycleEventNameNetworkAlmostIdle)
+	if err := button.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return fmt.Errorf("failed to click button: %w", err)
+	}
+
+	// Wait for navigation to complete
+	wait()
+
+	return page.GetContext().Err()
+}
+
+// CheckOrderStatus scrapes the order status from the Relish website and returns the parsed order information.
+// With Config.APIMode, the API is asked first. The OnStatus and OnError callbacks are invoked
+// with the result.
+func (n *Notifier) CheckOrderStatus(ctx context.Context) (OrderInfo, error) {
+	ctx = withPageTimeout(ctx, n.config.CheckTimeout)
+
+	if n.config.APIMode {
+		info, err := n.checkAPI(ctx)
+		if err == nil {
+			n.report(ctx, info, nil)
+			return info, nil
+		}
+		if ctx.Err() == nil {
+			n.logger.Warn("failed to get order status from API, reading the page instead", "error", err)
+		}
+	}
+
+	info, err := retryMissing(ctx, n.config.QuickRetries, n.config.QuickRetryDelay, n.logger,
+		n.checkOrderStatus, n.Refresh)
+	if err == nil {
+		n.logPageLoad(ctx)
+	}
+	if err != nil && ctx.Err() == nil && !n.connected() {
+		// There is no page left to snapshot
+		err = fmt.Errorf("%w: %w", ErrBrowserDisconnected, err)
+	} else if n.config.SnapshotDir != "" && ctx.Err() == nil && (err != nil || info.Status == OrderStatusUnknown) {
+		n.snapshotHTML(ctx)
+	}
+	if n.config.RecordDir != "" && ctx.Err() == nil && !errors.Is(err, ErrBrowserDisconnected) {
+		n.recordCheck(ctx, info, err)
+	}
+	n.report(ctx, info, err)
+	return info, err
+}
+
+// snapshotHTML saves the HTML of the current page to the snapshot directory
+func (n *Notifier) snapshotHTML(ctx context.Context) {
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	html, err := page.HTML()
+	if err != nil {
+		n.logger.Warn("failed to get page HTML for snapshot", "error", err)
+		return
+	}
+
+	path, err := writeSnapshot(n.config.SnapshotDir, redact(html, n.secrets()), time.Now())
+	if err != nil {
+		n.logger.Warn("failed to save page snapshot", "error", err)
+		return
+	}
+	n.logger.Info("saved page snapshot", "path", path)
+}
+
+// writeSnapshot writes html to a file in dir named for the time t, and returns its path
+func writeSnapshot(dir, html string, t time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	path := filepath.Join(dir, "relish-"+t.Format("20060102-150405.000")+".html")
+	if err := os.WriteFile(path, []byte(html), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return path, nil
+}
+
+// retryMissing calls check, and if the status element is missing, waits for delay,
+// calls refresh, and tries again up to retries more times
+func retryMissing(ctx context.Context, retries int, delay time.Duration, logger *slog.Logger,
+	check func(context.Context) (OrderInfo, error), refresh func(context.Context) error) (OrderInfo, error) {
+	info, err := check(ctx)
+	for attempt := 1; attempt <= retries && errors.Is(err, ErrStatusNotFound); attempt++ {
+		logger.Info("order status not found, retrying", "attempt", attempt, "retries", retries, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return info, err
+		case <-time.After(delay):
+		}
+
+		if err := refresh(ctx); err != nil {
+			logger.Warn("failed to refresh page", "error", err)
+		}
+		info, err = check(ctx)
+	}
+	return info, err
+}
+
+// CheckStatus implements StatusSource by calling CheckOrderStatus
+func (n *Notifier) CheckStatus(ctx context.Context) (OrderInfo, error) {
+	return n.CheckOrderStatus(ctx)
+}
+
+// checkOrderStatus performs the scraping for CheckOrderStatus
+func (n *Notifier) checkOrderStatus(ctx context.Context) (OrderInfo, error) {
+	n.logger.Debug("checking order status")
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	// If the session has expired the site sends us back to the login form
+	if expired, _, err := page.Has(emailSelector); err == nil && expired {
+		return OrderInfo{Status: OrderStatusUnknown}, ErrSessionExpired
+	}
+
+	var (
+		scope   elementFinder = page
+		card    *rod.Element
+		element *rod.Element
+		err     error
+	)
+	if n.config.OrderID != "" {
+		card, err = n.findOrderCard(page, n.config.OrderID)
+		if errors.Is(err, ErrStatusNotFound) {
+			return OrderInfo{Status: OrderStatusUnknown}, n.explainMissing(ctx, err)
+		} else if err != nil {
+			return OrderInfo{Status: OrderStatusUnknown}, err
+		}
+		// The card has already loaded, so there is nothing to wait for
+		scope = card
+		element, err = n.findStatusIn(card)
+	} else {
+		element, err = n.findStatusElement(page)
+		if found, first, hasErr := page.Has(cardSelector); hasErr == nil && found {
+			card = first
+		}
+	}
+	if err != nil {
+		return OrderInfo{Status: OrderStatusUnknown}, n.explainMissing(ctx, fmt.Errorf("%w: %w", ErrStatusNotFound, err))
+	}
+
+	text, err := element.Text()
+	if err != nil {
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("failed to get element text: %w", err)
+	}
+
+	status := ParseOrderStatus(strings.TrimSpace(text))
+	if status == OrderStatusUnknown {
+		if suggestion, ok := SuggestOrderStatus(strings.TrimSpace(text)); ok {
+			n.logger.Warn("unknown order status", "status", text, "did_you_mean", suggestion)
+		} else {
+			n.logger.Warn("unknown order status", "status", text)
+		}
+	}
+
+	return withDriverAssigned(OrderInfo{
+		Status:         status,
+		ETA:            n.scrapeETA(card),
+		Vendor:         n.scrapeText(scope, vendorSelector),
+		OrderID:        scrapeOrderID(card),
+		Driver:         n.scrapeText(scope, driverSelector),
+		DriverLocation: n.scrapeText(scope, driverLocationSelector),
+	}), nil
+}
+
+// readinessTimeout limits how long explainMissing spends asking whether the page has loaded
+const readinessTimeout = 2 * time.Second
+
+// explainMissing adds ErrPageLoading or ErrStatusMissing to err, a failure to find the order
+// status, depending on whether the page had finished loading
+func (n *Notifier) explainMissing(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	if !n.pageLoaded(ctx) {
+		n.logger.Warn("timeout waiting for order status while the page was loading")
+		return fmt.Errorf("%w: %w", ErrPageLoading, err)
+	}
+	n.logger.Warn("page loaded without an order status")
+	return fmt.Errorf("%w: %w", ErrStatusMissing, err)
+}
+
+// pageLoaded reports whether the page has finished loading and, if Config.ReadySelector is
+// set, shows the element it matches. It has its own timeout, since the wait for the status
+// may already have used up the page timeout.
+func (n *Notifier) pageLoaded(ctx context.Context) bool {
+	page := n.page.Context(ctx).Timeout(readinessTimeout)
+	defer page.CancelTimeout()
+
+	state, err := page.Eval(`() => document.readyState`)
+	if err != nil {
+		n.logger.Debug("failed to get page ready state", "error", err)
+		return false
+	}
+	if state.Value.Str() != "complete" {
+		n.logger.Debug("page has not finished loading", "ready_state", state.Value.Str())
+		return false
+	}
+
+	if n.config.ReadySelector == "" {
+		return true
+	}
+	found, _, err := page.Has(n.config.ReadySelector)
+	if err != nil || !found {
+		n.logger.Debug("page has no ready element", "selector", n.config.ReadySelector)
+		return false
+	}
+	return true
+}
+
+// elementFinder looks for an element without waiting for it; both *rod.Page and
+// *rod.Element implement it, so scraping can be limited to a single schedule card
+type elementFinder interface {
+	Has(selector string) (bool, *rod.Element, error)
+}
+
+// findOrderCard waits for the schedule cards to load, then returns the one for the order
+// with the given ID
+func (n *Notifier) findOrderCard(page *rod.Page, orderID string) (*rod.Element, error) {
+	if _, err := page.Element(cardSelector); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStatusNotFound, err)
+	}
+
+	cards, err := page.Elements(cardSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedule cards: %w", err)
+	}
+
+	ids := make([]string, len(cards))
+	for i, card := range cards {
+		if id, err := card.Attribute(orderIDAttribute); err == nil && id != nil {
+			ids[i] = strings.TrimSpace(*id)
+		}
+	}
+
+	i, err := matchOrderID(ids, orderID)
+	if err != nil {
+		return nil, err
+	}
+	n.logger.Debug("found schedule card", "order_id", orderID)
+	return cards[i], nil
+}
+
+// matchOrderID returns the index of orderID in ids, the IDs of the cards on the page in
+// order. Cards without an ID have an empty string.
+func matchOrderID(ids []string, orderID string) (int, error) {
+	var present []string
+	for i, id := range ids {
+		if id == orderID {
+			return i, nil
+		}
+		if id != "" {
+			present = append(present, id)
+		}
+	}
+
+	if len(present) == 0 {
+		return 0, fmt.Errorf("%w: %s (no orders with IDs on the page)", ErrOrderNotFound, orderID)
+	}
+	return 0, fmt.Errorf("%w: %s (found %s)", ErrOrderNotFound, orderID, strings.Join(present, ", "))
+}
+
+// findStatusElement waits for any of the status selectors to match, then returns the element
+// matched by the earliest selector in the list
+func (n *Notifier) findStatusElement(page *rod.Page) (*rod.Element, error) {
+	selectors := n.config.statusSelectors()
+
+	race := page.Race()
+	for _, selector := range selectors {
+		race = race.Element(selector)
+	}
+	element, err := race.Do()
+	if err != nil {
+		return nil, err
+	}
+
+	// More than one selector may match, so prefer them in the order given
+	if preferred, err := n.findStatusIn(page); err == nil {
+		return preferred, nil
+	}
+	return element, nil
+}
+
+// findStatusIn returns the element within scope matched by the earliest status selector,
+// without waiting for one to appear
+func (n *Notifier) findStatusIn(scope elementFinder) (*rod.Element, error) {
+	selectors := n.config.statusSelectors()
+	for _, selector := range selectors {
+		if found, element, err := scope.Has(selector); err == nil && found {
+			n.logger.Debug("found order status", "selector", selector)
+			return element, nil
+		}
+	}
+	return nil, fmt.Errorf("no element matches %s", strings.Join(selectors, ", "))
+}
+
+// scrapeText returns the text of an optional element on the schedule card, or an empty
+// string if it isn't shown
+func (n *Notifier) scrapeText(scope elementFinder, selector string) string {
+	// Has does not wait for the element, so a missing element doesn't stall the check
+	found, element, err := scope.Has(selector)
+	if err != nil || !found {
+		n.logger.Debug("element not on schedule card", "selector", selector)
+		return ""
+	}
+
+	text, err := element.Text()
+	if err != nil {
+		n.logger.Debug("failed to get element text", "selector", selector, "error", err)
+		return ""
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// scrapeOrderID returns the order ID of the schedule card, or an empty string if there is no
+// card or it has no ID
+func scrapeOrderID(card *rod.Element) string {
+	if card == nil {
+		return ""
+	}
+	id, err := card.Attribute(orderIDAttribute)
+	if err != nil || id == nil {
+		return ""
+	}
+	return strings.TrimSpace(*id)
+}
+
+// scrapeETA returns the estimated arrival time from the schedule card, or an empty string if
+// there is no card or it shows no ETA
+func (n *Notifier) scrapeETA(card *rod.Element) string {
+	if card == nil {
+		return ""
+	}
+
+	text, err := card.Text()
+	if err != nil {
+		n.logger.Debug("failed to get schedule card text", "error", err)
+		return ""
+	}
+
+	return parseETA(text)
+}
+
+// Refresh reloads the current page in the browser. If reloading keeps failing, the page
+// is replaced with a new one, which loads the schedule again.
+func (n *Notifier) Refresh(ctx context.Context) error {
+	ctx = withPageTimeout(ctx, n.config.CheckTimeout)
+	return retryRefresh(ctx, n.config.RefreshRetries, refreshRetryDelay, n.logger, n.reload, n.replacePage)
+}
+
+// reload reloads the current page
+func (n *Notifier) reload(ctx context.Context) error {
+	n.logger.Debug("reloading page")
+
+	if err := n.beforeLoad(ctx); err != nil {
+		return err
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	return page.Reload()
+}
+
+// replacePage closes the current page and opens the schedule in a new one. If the
+// session was lost along the way, the next check finds the login form and reports
+// ErrSessionExpired.
+func (n *Notifier) replacePage(ctx context.Context) error {
+	page, err := n.openPage(n.browser)
+	if err != nil {
+		return err
+	}
+
+	if err := n.page.Close(); err != nil {
+		n.logger.Debug("failed to close page", "error", err)
+	}
+	n.page = page
+
+	if err := n.navigate(ctx, n.loginUrl); err != nil {
+		return fmt.Errorf("failed to load schedule page: %w", err)
+	}
+	return nil
+}
+
+// retryRefresh calls reload, and if it fails, waits for delay and tries again up to
+// retries more times. If reload still fails, it calls replace.
+func retryRefresh(ctx context.Context, retries int, delay time.Duration, logger *slog.Logger,
+	reload, replace func(context.Context) error) error {
+	err := reload(ctx)
+	for attempt := 1; attempt <= retries && err != nil; attempt++ {
+		logger.Warn("failed to reload page, retrying", "error", err, "attempt", attempt, "retries", retries)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		err = reload(ctx)
+	}
+	if err == nil {
+		return nil
+	}
+
+	logger.Warn("reloading keeps failing, opening a new page", "error", err)
+	if err := replace(ctx); err != nil {
+		return fmt.Errorf("failed to replace page: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package relish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// The files written to each directory of a recording made with Config.RecordDir
+const (
+	RecordingHTML       = "page.html"
+	RecordingScreenshot = "screenshot.png"
+	RecordingResult     = "result.json"
+)
+
+// Recording is the result of one recorded check
+type Recording struct {
+	Time time.Time `json:"time"`
+	Info OrderInfo `json:"info"`
+	// Text is the text of the schedule card the status was read from, if there was one
+	Text string `json:"text,omitempty"`
+	// Error is the error the check failed with, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// recordCheck saves the current page and the result of a check to a new numbered
+// directory under Config.RecordDir. Failures are logged, since a recording is never
+// worth failing a check over.
+func (n *Notifier) recordCheck(ctx context.Context, info OrderInfo, checkErr error) {
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	recording := Recording{Time: time.Now(), Info: info}
+	if checkErr != nil {
+		recording.Error = redact(checkErr.Error(), n.secrets())
+	}
+	if found, card, err := page.Has(cardSelector); err == nil && found {
+		if text, err := card.Text(); err == nil {
+			recording.Text = redact(text, n.secrets())
+		}
+	}
+
+	html, err := page.HTML()
+	if err != nil {
+		n.logger.Warn("failed to get page HTML for recording", "error", err)
+		return
+	}
+
+	screenshot, err := page.Screenshot(false, nil)
+	if err != nil {
+		n.logger.Warn("failed to take screenshot for recording", "error", err)
+	}
+
+	dir, err := WriteRecording(n.config.RecordDir, recording, redact(html, n.secrets()), screenshot)
+	if err != nil {
+		n.logger.Warn("failed to save recording", "error", err)
+		return
+	}
+	n.logger.Debug("recorded check", "path", dir)
+}
+
+// Capture returns the HTML of the current page, with the credentials removed, and a
+// screenshot of it, for diagnosing a failure. The screenshot is nil if it couldn't be taken.
+func (n *Notifier) Capture(ctx context.Context) (string, []byte, error) {
+	if n.page == nil {
+		return "", nil, fmt.Errorf("no page is open")
+	}
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	html, err := page.HTML()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get page HTML: %w", err)
+	}
+
+	screenshot, err := page.Screenshot(false, nil)
+	if err != nil {
+		n.logger.Debug("failed to take screenshot", "error", err)
+		screenshot = nil
+	}
+	return redact(html, n.secrets()), screenshot, nil
+}
+
+// WriteRecording writes a recording to the next numbered directory under dir, and returns
+// its path. The screenshot is skipped if it is empty.
+func WriteRecording(dir string, recording Recording, html string, screenshot []byte) (string, error) {
+	dirs, err := RecordingDirs(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	next := 1
+	if len(dirs) > 0 {
+		last, _ := strconv.Atoi(filepath.Base(dirs[len(dirs)-1]))
+		next = last + 1
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%04d", next))
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	result, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode recording: %w", err)
+	}
+
+	files := map[string][]byte{
+		RecordingResult: append(result, '\n'),
+		RecordingHTML:   []byte(html),
+	}
+	if len(screenshot) > 0 {
+		files[RecordingScreenshot] = screenshot
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(path, name), data, 0o600); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return path, nil
+}
+
+// RecordingDirs returns the paths of the checks recorded in dir, in the order they were made
+func RecordingDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording directory: %w", err)
+	}
+
+	var numbers []int
+	for _, entry := range entries {
+		if number, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			numbers = append(numbers, number)
+		}
+	}
+	slices.Sort(numbers)
+
+	dirs := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		dirs = append(dirs, filepath.Join(dir, fmt.Sprintf("%04d", number)))
+	}
+	return dirs, nil
+}
+
+// ReadRecording reads the result and page HTML saved in one directory of a recording
+func ReadRecording(dir string) (Recording, string, error) {
+	var recording Recording
+
+	result, err := os.ReadFile(filepath.Join(dir, RecordingResult))
+	if err != nil {
+		return recording, "", fmt.Errorf("failed to read recording: %w", err)
+	}
+	if err := json.Unmarshal(result, &recording); err != nil {
+		return recording, "", fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, RecordingResult), err)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, RecordingHTML))
+	if err != nil {
+		return recording, "", fmt.Errorf("failed to read recorded page: %w", err)
+	}
+	return recording, string(html), nil
+}
+
+// Replay loads html, such as a page saved by Config.RecordDir, into the browser and reads
+// the order status from it the same way a check would, without going to the website
+func (n *Notifier) Replay(ctx context.Context, html string) (OrderInfo, error) {
+	ctx = withPageTimeout(ctx, n.config.CheckTimeout)
+
+	page, cancel := n.pageFor(ctx)
+	defer cancel()
+
+	if err := page.SetDocumentContent(html); err != nil {
+		return OrderInfo{Status: OrderStatusUnknown}, fmt.Errorf("failed to load recorded page: %w", err)
+	}
+	return n.checkOrderStatus(ctx)
+}
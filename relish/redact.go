@@ -0,0 +1,126 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// redacted replaces secrets in log output and error messages
+const redacted = "[REDACTED]"
+
+// redact replaces every occurrence of the secrets in s
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	return s
+}
+
+// redactHandler removes secrets from log records before passing them on. The secrets are
+// looked up for every record, so credentials that change while running are still hidden.
+type redactHandler struct {
+	handler slog.Handler
+	secrets func() []string
+}
+
+// newRedactLogger returns a logger that removes the secrets from everything it logs
+func newRedactLogger(logger *slog.Logger, secrets func() []string) *slog.Logger {
+	return slog.New(&redactHandler{handler: logger.Handler(), secrets: secrets})
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	secrets := h.secrets()
+
+	clean := slog.NewRecord(r.Time, r.Level, redact(r.Message, secrets), r.PC)
+	r.Attrs(func(attr slog.Attr) bool {
+		clean.AddAttrs(redactAttr(attr, secrets))
+		return true
+	})
+	return h.handler.Handle(ctx, clean)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	secrets := h.secrets()
+
+	clean := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		clean = append(clean, redactAttr(attr, secrets))
+	}
+	return &redactHandler{handler: h.handler.WithAttrs(clean), secrets: h.secrets}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{handler: h.handler.WithGroup(name), secrets: h.secrets}
+}
+
+// redactAttr removes secrets from an attribute value, including errors and groups
+func redactAttr(attr slog.Attr, secrets []string) slog.Attr {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redact(value.String(), secrets))
+	case slog.KindGroup:
+		group := value.Group()
+		clean := make([]any, 0, len(group))
+		for _, member := range group {
+			clean = append(clean, redactAttr(member, secrets))
+		}
+		return slog.Group(attr.Key, clean...)
+	case slog.KindAny:
+		text := fmt.Sprint(value.Any())
+		if cleaned := redact(text, secrets); cleaned != text {
+			return slog.String(attr.Key, cleaned)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactedError hides secrets in the message of an error, while errors.Is and errors.As
+// still see the original
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+// redactError wraps err so that its message doesn't include the secrets
+func redactError(err error, secrets []string) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err, secrets: secrets}
+}
+
+func (e *redactedError) Error() string {
+	return redact(e.err.Error(), e.secrets)
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,1430 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// newTestLogger returns a debug level logger that writes to the Ginkgo output
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(GinkgoWriter, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+var _ = Describe("OrderStatus", func() {
+	Describe("String method", func() {
+		DescribeTable("should return correct string representation",
+			func(status OrderStatus, expected string) {
+				Expect(status.String()).To(Equal(expected))
+			},
+			Entry("Order Placed", OrderStatusPlaced, "Order Placed"),
+			Entry("Preparing Your Order", OrderStatusPreparing, "Preparing Your Order"),
+			Entry("Out for Delivery", OrderStatusOutForDelivery, "Out for Delivery"),
+			Entry("Order Arrived", OrderStatusArrived, "Order Arrived"),
+			Entry("Order Cancelled", OrderStatusCancelled, "Order Cancelled"),
+			Entry("Order Delayed", OrderStatusDelayed, "Order Delayed"),
+			Entry("Unknown", OrderStatusUnknown, "Unknown"),
+		)
+	})
+
+	Describe("IsFinal method", func() {
+		DescribeTable("should report whether the status can still change",
+			func(status OrderStatus, expected bool) {
+				Expect(status.IsFinal()).To(Equal(expected))
+			},
+			Entry("Order Placed", OrderStatusPlaced, false),
+			Entry("Preparing Your Order", OrderStatusPreparing, false),
+			Entry("Out for Delivery", OrderStatusOutForDelivery, false),
+			Entry("Order Delayed", OrderStatusDelayed, false),
+			Entry("Order Arrived", OrderStatusArrived, true),
+			Entry("Order Cancelled", OrderStatusCancelled, true),
+			Entry("Unknown", OrderStatusUnknown, false),
+		)
+	})
+
+	Describe("ParseOrderStatus function", func() {
+		Context("with valid status strings", func() {
+			DescribeTable("should return correct OrderStatus",
+				func(text string, expected OrderStatus) {
+					Expect(ParseOrderStatus(text)).To(Equal(expected))
+				},
+				Entry("Order Placed", "Order Placed", OrderStatusPlaced),
+				Entry("Preparing Your Order", "Preparing Your Order", OrderStatusPreparing),
+				Entry("Driver Assigned", "Driver Assigned", OrderStatusDriverAssigned),
+				Entry("Out for Delivery", "Out for Delivery", OrderStatusOutForDelivery),
+				Entry("Order Arrived", "Order Arrived", OrderStatusArrived),
+				Entry("Order Cancelled", "Order Cancelled", OrderStatusCancelled),
+				Entry("Order Delayed", "Order Delayed", OrderStatusDelayed),
+			)
+		})
+
+		Context("with invalid status strings", func() {
+			DescribeTable("should return OrderStatusUnknown",
+				func(text string) {
+					Expect(ParseOrderStatus(text)).To(Equal(OrderStatusUnknown))
+				},
+				Entry("invalid status", "Invalid Status"),
+				Entry("empty string", ""),
+				Entry("case sensitive - lowercase", "order placed"),
+				Entry("whitespace around", " Order Placed "),
+				Entry("partial match", "Order"),
+				Entry("extra text", "Order Placed - Confirmed"),
+			)
+		})
+	})
+})
+
+var _ = Describe("Notifier", func() {
+	var (
+		config      *Config
+		credentials *Credentials
+		logger      *slog.Logger
+	)
+
+	BeforeEach(func() {
+		config = &Config{
+			Headless:    true,
+			Extensions:  false,
+			PageTimeout: 30 * time.Second,
+		}
+
+		credentials = &Credentials{
+			Username: "test@example.com",
+			Password: "testpassword",
+		}
+
+		logger = newTestLogger()
+	})
+
+	Describe("NewNotifier constructor", func() {
+		It("should create a new notifier with correct configuration", func() {
+			notifier := NewNotifier(config, credentials, logger)
+
+			Expect(notifier).NotTo(BeNil())
+			Expect(notifier.config).To(Equal(config))
+			Expect(notifier.credentials).To(Equal(credentials))
+			Expect(notifier.logger.Handler()).To(BeAssignableToTypeOf(&redactHandler{}))
+			Expect(notifier.logger.Handler().(*redactHandler).handler).To(Equal(logger.Handler()))
+			Expect(notifier.loginUrl).To(Equal(DefaultLoginURL))
+		})
+
+		It("should initialize with nil browser and page", func() {
+			notifier := NewNotifier(config, credentials, logger)
+
+			Expect(notifier.browser).To(BeNil())
+			Expect(notifier.page).To(BeNil())
+		})
+
+		It("should handle nil inputs gracefully", func() {
+			// While not recommended, the constructor should not panic
+			Expect(func() {
+				NewNotifier(nil, nil, nil)
+			}).NotTo(Panic())
+		})
+
+		It("should supply a logger when none is provided", func() {
+			notifier := NewNotifier(config, credentials, nil)
+
+			Expect(notifier.logger).NotTo(BeNil())
+		})
+	})
+})
+
+var _ = Describe("Configuration", func() {
+	Describe("Headless flag behavior", func() {
+		It("should correctly handle headless configuration", func() {
+			// Test that headless setting is properly passed to launcher
+			config := &Config{Headless: true}
+			logger := newTestLogger()
+			notifier := NewNotifier(config, &Credentials{}, logger)
+
+			Expect(notifier.config.Headless).To(BeTrue())
+
+			// Test non-headless
+			config.Headless = false
+			notifier2 := NewNotifier(config, &Credentials{}, logger)
+
+			Expect(notifier2.config.Headless).To(BeFalse())
+		})
+	})
+
+	Describe("Credentials struct", func() {
+		It("should store username and password correctly", func() {
+			creds := &Credentials{
+				Username: "user@example.com",
+				Password: "secret123",
+			}
+
+			Expect(creds.Username).To(Equal("user@example.com"))
+			Expect(creds.Password).To(Equal("secret123"))
+		})
+
+		It("should handle empty credentials", func() {
+			creds := &Credentials{}
+
+			Expect(creds.Username).To(Equal(""))
+			Expect(creds.Password).To(Equal(""))
+		})
+	})
+})
+
+var _ = Describe("Edge Cases and Error Handling", func() {
+	Describe("ParseOrderStatus with edge cases", func() {
+		It("should handle Unicode characters", func() {
+			result := ParseOrderStatus("Order Placed 🚚")
+			Expect(result).To(Equal(OrderStatusUnknown))
+		})
+
+		It("should handle very long strings", func() {
+			longString := strings.Repeat("Order Placed", 1000)
+			result := ParseOrderStatus(longString)
+			Expect(result).To(Equal(OrderStatusUnknown))
+		})
+
+		It("should handle strings with control characters", func() {
+			result := ParseOrderStatus("Order\nPlaced")
+			Expect(result).To(Equal(OrderStatusUnknown))
+		})
+	})
+
+	Describe("NewNotifier edge cases", func() {
+		It("should work with extreme timeout values", func() {
+			config := &Config{
+				PageTimeout: time.Hour * 24, // 24 hours
+			}
+
+			notifier := NewNotifier(config, &Credentials{}, newTestLogger())
+			Expect(notifier).NotTo(BeNil())
+			Expect(notifier.config.PageTimeout).To(Equal(time.Hour * 24))
+		})
+
+		It("should handle empty login URL correctly", func() {
+			notifier := NewNotifier(&Config{}, &Credentials{}, newTestLogger())
+			Expect(notifier.loginUrl).To(Equal(DefaultLoginURL))
+		})
+	})
+})
+
+var _ = Describe("ETA parsing", func() {
+	Describe("parseETA function", func() {
+		DescribeTable("should extract the arrival time",
+			func(text, expected string) {
+				Expect(parseETA(text)).To(Equal(expected))
+			},
+			Entry("arriving at", "Order Placed\nArriving at 12:30 PM", "12:30 PM"),
+			Entry("arrives by", "Arrives by 1:05pm", "1:05pm"),
+			Entry("no eta", "Order Placed", ""),
+			Entry("empty string", "", ""),
+		)
+	})
+
+	Describe("withDriverAssigned function", func() {
+		It("should count a driver shown before the order is sent out as assigned", func() {
+			info := withDriverAssigned(OrderInfo{Status: OrderStatusPreparing, Driver: "Sam"})
+			Expect(info.Status).To(Equal(OrderStatusDriverAssigned))
+			Expect(info.Driver).To(Equal("Sam"))
+		})
+
+		It("should leave other statuses alone", func() {
+			Expect(withDriverAssigned(OrderInfo{Status: OrderStatusPreparing}).Status).To(Equal(OrderStatusPreparing))
+			Expect(withDriverAssigned(OrderInfo{Status: OrderStatusOutForDelivery, Driver: "Sam"}).Status).To(Equal(OrderStatusOutForDelivery))
+			Expect(withDriverAssigned(OrderInfo{Status: OrderStatusDelayed, Driver: "Sam"}).Status).To(Equal(OrderStatusDelayed))
+		})
+	})
+
+	Describe("ETATime function", func() {
+		loc := time.FixedZone("EST", -5*60*60)
+		now := time.Date(2025, 1, 15, 11, 0, 0, 0, loc)
+
+		DescribeTable("should place the ETA on the same day and in the same zone",
+			func(eta string, hour, minute int) {
+				t, err := ETATime(eta, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(t).To(Equal(time.Date(2025, 1, 15, hour, minute, 0, 0, loc)))
+			},
+			Entry("afternoon", "12:30 PM", 12, 30),
+			Entry("lower case without a space", "1:05pm", 13, 5),
+			Entry("morning", "11:45 AM", 11, 45),
+		)
+
+		It("should reject text that isn't a time", func() {
+			_, err := ETATime("soon", now)
+			Expect(err).To(MatchError(ContainSubstring(`invalid ETA "soon"`)))
+		})
+	})
+})
+
+var _ = Describe("Browser Launcher", func() {
+	Describe("newLauncher method", func() {
+		It("should apply stealth options by default", func() {
+			notifier := NewNotifier(&Config{Headless: true}, &Credentials{}, newTestLogger())
+			l := notifier.newLauncher()
+
+			Expect(l.Has("user-agent")).To(BeTrue())
+			Expect(l.Get("disable-blink-features")).To(Equal("AutomationControlled"))
+		})
+
+		It("should skip stealth options when disabled", func() {
+			notifier := NewNotifier(&Config{Headless: true, DisableStealth: true}, &Credentials{}, newTestLogger())
+			l := notifier.newLauncher()
+
+			Expect(l.Has("user-agent")).To(BeFalse())
+			Expect(l.Has("disable-blink-features")).To(BeFalse())
+			Expect(l.Has("exclude-switches")).To(BeFalse())
+		})
+
+		It("should disable extensions when requested", func() {
+			notifier := NewNotifier(&Config{Headless: true, Extensions: false}, &Credentials{}, newTestLogger())
+			Expect(notifier.newLauncher().Has("disable-extensions")).To(BeTrue())
+
+			notifier = NewNotifier(&Config{Headless: true, Extensions: true}, &Credentials{}, newTestLogger())
+			Expect(notifier.newLauncher().Has("disable-extensions")).To(BeFalse())
+		})
+
+		It("should use the new headless mode when requested", func() {
+			notifier := NewNotifier(&Config{Headless: true, HeadlessMode: HeadlessModeNew}, &Credentials{}, newTestLogger())
+			Expect(notifier.newLauncher().Get("headless")).To(Equal("new"))
+
+			notifier = NewNotifier(&Config{Headless: true, HeadlessMode: HeadlessModeOld}, &Credentials{}, newTestLogger())
+			Expect(notifier.newLauncher().Has("headless")).To(BeTrue())
+			Expect(notifier.newLauncher().Flags["headless"]).To(BeEmpty())
+
+			notifier = NewNotifier(&Config{Headless: false, HeadlessMode: HeadlessModeNew}, &Credentials{}, newTestLogger())
+			Expect(notifier.newLauncher().Has("headless")).To(BeFalse())
+		})
+
+		It("should apply extra chrome flags after the built in options", func() {
+			notifier := NewNotifier(&Config{Headless: true, ChromeFlags: []string{
+				"--disable-gpu",
+				"user-agent=Lunchbot/1.0",
+				"enable-features=A,B",
+			}}, &Credentials{}, newTestLogger())
+			l := notifier.newLauncher()
+
+			Expect(l.Has("disable-gpu")).To(BeTrue())
+			Expect(l.Get("user-agent")).To(Equal("Lunchbot/1.0"))
+			Expect(l.Get("enable-features")).To(Equal("A,B"))
+		})
+
+		It("should disable the sandbox when requested", func() {
+			notifier := NewNotifier(&Config{Headless: true, NoSandbox: true}, &Credentials{}, newTestLogger())
+			l := notifier.newLauncher()
+
+			Expect(l.Has("no-sandbox")).To(BeTrue())
+			Expect(l.Has("disable-dev-shm-usage")).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Config Validation", func() {
+	It("should accept an empty configuration", func() {
+		Expect((&Config{}).Validate()).To(Succeed())
+	})
+
+	Describe("status selectors", func() {
+		It("should use the default selector when none are given", func() {
+			Expect((&Config{}).statusSelectors()).To(Equal([]string{DefaultStatusSelector}))
+		})
+
+		It("should keep fallback selectors in order", func() {
+			config := &Config{StatusSelectors: []string{".status-v2", DefaultStatusSelector}}
+			Expect(config.Validate()).To(Succeed())
+			Expect(config.statusSelectors()).To(Equal([]string{".status-v2", DefaultStatusSelector}))
+		})
+
+		It("should fall back to the default login buttons", func() {
+			Expect(selectorOrDefault("", DefaultEmailButtonSelector)).To(Equal(DefaultEmailButtonSelector))
+			Expect(selectorOrDefault("#next", DefaultEmailButtonSelector)).To(Equal("#next"))
+		})
+
+		It("should reject an empty selector", func() {
+			err := (&Config{StatusSelectors: []string{".status-v2", " "}}).Validate()
+			Expect(err).To(MatchError(ContainSubstring("invalid status selector")))
+		})
+	})
+
+	It("should reject negative page timeouts", func() {
+		Expect((&Config{CheckTimeout: -time.Second}).Validate()).To(MatchError(ContainSubstring("invalid page timeout")))
+	})
+
+	Describe("page timeouts", func() {
+		It("should use the page timeout unless another is given", func() {
+			n := NewNotifier(&Config{PageTimeout: 10 * time.Second, LoginTimeout: time.Minute}, nil, nil)
+			Expect(n.pageTimeout(context.Background())).To(Equal(10 * time.Second))
+			Expect(n.pageTimeout(withPageTimeout(context.Background(), 0))).To(Equal(10 * time.Second))
+			Expect(n.pageTimeout(withPageTimeout(context.Background(), n.config.LoginTimeout))).To(Equal(time.Minute))
+		})
+	})
+
+	Describe("chrome binary", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		It("should accept an executable file", func() {
+			path := filepath.Join(dir, "chrome")
+			Expect(os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755)).To(Succeed())
+
+			Expect((&Config{ChromeBin: path}).Validate()).To(Succeed())
+		})
+
+		It("should reject a missing file", func() {
+			err := (&Config{ChromeBin: filepath.Join(dir, "missing")}).Validate()
+			Expect(err).To(MatchError(ContainSubstring("invalid chrome binary")))
+		})
+
+		It("should reject a file that isn't executable", func() {
+			path := filepath.Join(dir, "chrome")
+			Expect(os.WriteFile(path, []byte("#!/bin/sh\n"), 0o644)).To(Succeed())
+
+			err := (&Config{ChromeBin: path}).Validate()
+			Expect(err).To(MatchError(ContainSubstring("not an executable file")))
+		})
+
+		It("should reject a directory", func() {
+			err := (&Config{ChromeBin: dir}).Validate()
+			Expect(err).To(MatchError(ContainSubstring("not an executable file")))
+		})
+
+		It("should pass the binary to the launcher", func() {
+			notifier := NewNotifier(&Config{ChromeBin: "/opt/chrome/chrome"}, &Credentials{}, newTestLogger())
+			Expect(notifier.newLauncher().Get("rod-bin")).To(Equal("/opt/chrome/chrome"))
+		})
+	})
+})
+
+var _ = Describe("Remote Browser", func() {
+	Describe("Config validation", func() {
+		DescribeTable("should accept valid remote URLs",
+			func(remoteURL string) {
+				Expect((&Config{RemoteURL: remoteURL}).Validate()).To(Succeed())
+			},
+			Entry("http endpoint", "http://chrome:9222"),
+			Entry("https endpoint", "https://chrome.example.com"),
+			Entry("websocket URL", "ws://browserless:3000?token=secret"),
+			Entry("secure websocket URL", "wss://browserless.example.com"),
+		)
+
+		DescribeTable("should reject invalid remote URLs",
+			func(remoteURL string) {
+				Expect((&Config{RemoteURL: remoteURL}).Validate()).To(MatchError(ContainSubstring("invalid remote browser URL")))
+			},
+			Entry("unsupported scheme", "ftp://chrome:9222"),
+			Entry("no scheme", "chrome:9222"),
+			Entry("missing host", "http://"),
+		)
+
+		It("should reject a chrome binary combined with a remote URL", func() {
+			err := (&Config{RemoteURL: "ws://chrome:9222", ChromeBin: "/usr/bin/chrome"}).Validate()
+			Expect(err).To(MatchError(ContainSubstring("cannot be used together")))
+		})
+	})
+
+	Describe("controlURL method", func() {
+		It("should use websocket URLs directly", func() {
+			notifier := NewNotifier(&Config{RemoteURL: "ws://browserless:3000?token=secret"}, &Credentials{}, newTestLogger())
+
+			u, _, err := notifier.controlURL()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u).To(Equal("ws://browserless:3000?token=secret"))
+		})
+
+		It("should resolve the debugger URL of http endpoints", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/json/version"))
+				_, _ = w.Write([]byte(`{"webSocketDebuggerUrl": "ws://127.0.0.1:9222/devtools/browser/abc"}`))
+			}))
+			defer server.Close()
+
+			notifier := NewNotifier(&Config{RemoteURL: server.URL}, &Credentials{}, newTestLogger())
+
+			u, _, err := notifier.controlURL()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u).To(Equal("ws://" + strings.TrimPrefix(server.URL, "http://") + "/devtools/browser/abc"))
+		})
+
+		It("should report unreachable remote browsers clearly", func() {
+			server := httptest.NewServer(http.NotFoundHandler())
+			remoteURL := server.URL
+			server.Close()
+
+			notifier := NewNotifier(&Config{RemoteURL: remoteURL}, &Credentials{}, newTestLogger())
+
+			_, _, err := notifier.controlURL()
+			Expect(err).To(MatchError(ContainSubstring("failed to reach remote browser")))
+		})
+	})
+})
+
+var _ = Describe("Callbacks", func() {
+	var (
+		notifier *Notifier
+		statuses []OrderInfo
+		errs     []error
+	)
+
+	BeforeEach(func() {
+		statuses = nil
+		errs = nil
+
+		notifier = NewNotifier(&Config{}, &Credentials{}, newTestLogger())
+		notifier.OnStatus = func(info OrderInfo) { statuses = append(statuses, info) }
+		notifier.OnError = func(err error) { errs = append(errs, err) }
+	})
+
+	It("should call OnStatus after a successful check", func() {
+		info := OrderInfo{Status: OrderStatusPreparing, Vendor: "Chipotle"}
+		notifier.report(context.Background(), info, nil)
+
+		Expect(statuses).To(Equal([]OrderInfo{info}))
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should call OnError after a failed check", func() {
+		checkErr := errors.New("no element")
+		notifier.report(context.Background(), OrderInfo{Status: OrderStatusUnknown}, checkErr)
+
+		Expect(statuses).To(BeEmpty())
+		Expect(errs).To(ConsistOf(checkErr))
+	})
+
+	It("should not call OnError when the check was cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		notifier.report(ctx, OrderInfo{Status: OrderStatusUnknown}, context.Canceled)
+
+		Expect(statuses).To(BeEmpty())
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should tolerate unset callbacks", func() {
+		notifier.OnStatus = nil
+		notifier.OnError = nil
+
+		Expect(func() {
+			notifier.report(context.Background(), OrderInfo{Status: OrderStatusPlaced}, nil)
+			notifier.report(context.Background(), OrderInfo{}, errors.New("failed"))
+		}).NotTo(Panic())
+	})
+})
+
+var _ = Describe("Two-Factor Authentication", func() {
+	Describe("GenerateTOTP function", func() {
+		// Test vectors from RFC 6238 appendix B (SHA1), truncated to six digits
+		const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+		DescribeTable("should match the RFC 6238 test vectors",
+			func(unix int64, expected string) {
+				code, err := GenerateTOTP(rfcSecret, time.Unix(unix, 0))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(code).To(Equal(expected))
+			},
+			Entry("59", int64(59), "287082"),
+			Entry("1111111109", int64(1111111109), "081804"),
+			Entry("1111111111", int64(1111111111), "050471"),
+			Entry("1234567890", int64(1234567890), "005924"),
+			Entry("2000000000", int64(2000000000), "279037"),
+		)
+
+		It("should accept secrets formatted by authenticator apps", func() {
+			code, err := GenerateTOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal("287082"))
+		})
+
+		It("should reject secrets that are not base32", func() {
+			_, err := GenerateTOTP("not-base32!", time.Now())
+			Expect(err).To(MatchError(ContainSubstring("invalid TOTP secret")))
+		})
+	})
+
+	Describe("otpCode method", func() {
+		It("should prefer the TOTP secret", func() {
+			notifier := NewNotifier(&Config{}, &Credentials{TOTPSecret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}, newTestLogger())
+			notifier.PromptOTP = func(ctx context.Context) (string, error) {
+				Fail("prompt should not be used")
+				return "", nil
+			}
+
+			code, err := notifier.otpCode(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(HaveLen(6))
+		})
+
+		It("should fall back to prompting", func() {
+			notifier := NewNotifier(&Config{}, &Credentials{}, newTestLogger())
+			notifier.PromptOTP = func(ctx context.Context) (string, error) {
+				return "123456\n", nil
+			}
+
+			code, err := notifier.otpCode(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(code).To(Equal("123456"))
+		})
+
+		It("should fail when no code source is available", func() {
+			notifier := NewNotifier(&Config{}, &Credentials{}, newTestLogger())
+
+			_, err := notifier.otpCode(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("no TOTP secret")))
+		})
+	})
+})
+
+var _ = Describe("Window Size", func() {
+	It("should pass the window size to the launcher", func() {
+		notifier := NewNotifier(&Config{WindowWidth: 1280, WindowHeight: 800}, &Credentials{}, newTestLogger())
+		Expect(notifier.newLauncher().Get("window-size")).To(Equal("1280,800"))
+	})
+
+	It("should leave the window size alone when not configured", func() {
+		notifier := NewNotifier(&Config{WindowWidth: 1280}, &Credentials{}, newTestLogger())
+		Expect(notifier.newLauncher().Has("window-size")).To(BeFalse())
+	})
+
+	It("should reject negative sizes", func() {
+		Expect((&Config{WindowWidth: -1, WindowHeight: 800}).Validate()).To(MatchError(ContainSubstring("invalid window size")))
+	})
+})
+
+var _ = Describe("Language", func() {
+	It("should launch the browser in the configured language", func() {
+		notifier := NewNotifier(&Config{Language: "es-MX"}, &Credentials{}, newTestLogger())
+		Expect(notifier.newLauncher().Get("lang")).To(Equal("es-MX"))
+	})
+
+	It("should leave the language alone when not configured", func() {
+		notifier := NewNotifier(&Config{}, &Credentials{}, newTestLogger())
+		Expect(notifier.newLauncher().Has("lang")).To(BeFalse())
+	})
+
+	It("should reject invalid chrome flags", func() {
+		Expect((&Config{ChromeFlags: []string{"disable-gpu", "lang=fr"}}).Validate()).To(Succeed())
+		Expect((&Config{ChromeFlags: []string{"=fr"}}).Validate()).To(MatchError(ContainSubstring(`invalid chrome flag "=fr"`)))
+		Expect((&Config{ChromeFlags: []string{"disable-gpu"}, RemoteURL: "http://localhost:9222"}).Validate()).
+			To(MatchError(ContainSubstring("cannot be used with a remote browser")))
+	})
+
+	It("should reject an unknown headless mode", func() {
+		Expect((&Config{HeadlessMode: HeadlessModeNew}).Validate()).To(Succeed())
+		Expect((&Config{HeadlessMode: "newest"}).Validate()).To(MatchError(ContainSubstring("invalid headless mode")))
+	})
+
+	DescribeTable("language validation",
+		func(language string, valid bool) {
+			err := (&Config{Language: language}).Validate()
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring("invalid language")))
+			}
+		},
+		Entry("language only", "en", true),
+		Entry("language and region", "en-US", true),
+		Entry("header injection", "en-US\r\nX-Evil: 1", false),
+		Entry("list", "en-US,en;q=0.9", false),
+	)
+})
+
+// startIMAPServer runs a minimal IMAP server that accepts the given password and
+// serves the given messages. It returns the server address.
+func startIMAPServer(password string, messages ...string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(listener.Close)
+
+	go func() {
+		defer GinkgoRecover()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() //nolint:errcheck
+
+		r := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "* OK fake IMAP server ready\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+			verb, args, _ := strings.Cut(command, " ")
+
+			switch verb {
+			case "LOGIN":
+				if !strings.HasSuffix(args, imapQuote(password)) {
+					fmt.Fprintf(conn, "%s NO authentication failed\r\n", tag)
+					continue
+				}
+			case "SEARCH":
+				ids := []string{}
+				for i := range messages {
+					ids = append(ids, strconv.Itoa(i+1))
+				}
+				fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(ids, " "))
+			case "FETCH":
+				id, _, _ := strings.Cut(args, " ")
+				n, _ := strconv.Atoi(id)
+				msg := messages[n-1]
+				fmt.Fprintf(conn, "* %d FETCH (BODY[] {%d}\r\n%s)\r\n", n, len(msg), msg)
+			case "LOGOUT":
+				fmt.Fprintf(conn, "* BYE\r\n%s OK LOGOUT completed\r\n", tag)
+				return
+			}
+			fmt.Fprintf(conn, "%s OK %s completed\r\n", tag, verb)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+var _ = Describe("IMAP Source", func() {
+	Describe("parseEmailStatus function", func() {
+		DescribeTable("should recognize the status in email text",
+			func(text string, expected OrderStatus) {
+				Expect(parseEmailStatus(text)).To(Equal(expected))
+			},
+			Entry("arrived", "Good news! Your order has arrived.", OrderStatusArrived),
+			Entry("arrived label", "Order Arrived", OrderStatusArrived),
+			Entry("preparing", "The restaurant is preparing your order", OrderStatusPreparing),
+			Entry("out for delivery", "Your order is out for delivery with Sam", OrderStatusOutForDelivery),
+			Entry("driver assigned", "A driver has been assigned to your order", OrderStatusDriverAssigned),
+			Entry("placed", "Your order has been placed", OrderStatusPlaced),
+			Entry("most advanced status wins", "Order placed at 11:00. Order arrived at 12:10.", OrderStatusArrived),
+			Entry("cancelled", "We're sorry, your order has been cancelled", OrderStatusCancelled),
+			Entry("canceled", "Your order was canceled by the restaurant", OrderStatusCancelled),
+			Entry("delayed", "Your order is delayed, now arriving by 1:15 PM", OrderStatusDelayed),
+			Entry("arrived after a delay", "Your order was delayed. Good news, your order has arrived!", OrderStatusArrived),
+			Entry("unrelated text", "Your weekly menu is here", OrderStatusUnknown),
+		)
+	})
+
+	Describe("messageText function", func() {
+		It("should decode multipart messages", func() {
+			raw := "Subject: =?UTF-8?Q?Your_order_from_Chipotle?=\r\n" +
+				"Content-Type: multipart/alternative; boundary=XYZ\r\n" +
+				"\r\n" +
+				"--XYZ\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"Preparing your order, arriving by 12:=\r\n30 PM\r\n" +
+				"--XYZ\r\n" +
+				"Content-Type: text/html\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"PHA+T3JkZXIgJmFtcDsgbW9yZTwvcD4=\r\n" +
+				"--XYZ--\r\n"
+
+			text, err := messageText([]byte(raw))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(ContainSubstring("Your order from Chipotle"))
+			Expect(text).To(ContainSubstring("arriving by 12:30 PM"))
+			Expect(text).To(ContainSubstring("Order & more"))
+			Expect(text).NotTo(ContainSubstring("<p>"))
+		})
+	})
+
+	Describe("IMAPConfig validation", func() {
+		It("should require a server", func() {
+			config := &IMAPConfig{Username: "user", Password: "pass"}
+			Expect(config.Validate()).To(MatchError(ContainSubstring("no server")))
+		})
+
+		It("should reject line breaks", func() {
+			config := &IMAPConfig{Server: "imap.example.com", Username: "user", Password: "pass\r\nLOGOUT"}
+			Expect(config.Validate()).To(MatchError(ContainSubstring("line breaks")))
+		})
+
+		It("should default the port", func() {
+			Expect((&IMAPConfig{Server: "imap.example.com"}).address()).To(Equal("imap.example.com:993"))
+			Expect((&IMAPConfig{Server: "localhost", DisableTLS: true}).address()).To(Equal("localhost:143"))
+			Expect((&IMAPConfig{Server: "localhost:1143"}).address()).To(Equal("localhost:1143"))
+		})
+	})
+
+	Describe("CheckStatus method", func() {
+		newSource := func(addr, password string) *IMAPSource {
+			return NewIMAPSource(&IMAPConfig{
+				Server:     addr,
+				Username:   "user@example.com",
+				Password:   password,
+				DisableTLS: true,
+			}, newTestLogger())
+		}
+
+		It("should report the status from the newest email", func() {
+			addr := startIMAPServer("secret",
+				"Subject: Order placed\r\n\r\nYour order has been placed.\r\n",
+				"Subject: Order arrived\r\n\r\nYour order has arrived, at 12:05 PM.\r\n",
+			)
+			source := newSource(addr, "secret")
+
+			var reported OrderInfo
+			source.OnStatus = func(info OrderInfo) { reported = info }
+
+			info, err := source.CheckStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Status).To(Equal(OrderStatusArrived))
+			Expect(reported).To(Equal(info))
+		})
+
+		It("should return ErrNoOrderEmail when nothing matches", func() {
+			source := newSource(startIMAPServer("secret"), "secret")
+
+			_, err := source.CheckStatus(context.Background())
+			Expect(err).To(MatchError(ErrNoOrderEmail))
+		})
+
+		It("should fail when login is rejected", func() {
+			source := newSource(startIMAPServer("secret"), "wrong")
+
+			var reported error
+			source.OnError = func(err error) { reported = err }
+
+			_, err := source.CheckStatus(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("failed to log in to IMAP server")))
+			Expect(err).To(MatchError(ErrInvalidCredentials))
+			Expect(reported).To(Equal(err))
+		})
+	})
+
+	It("should implement StatusSource", func() {
+		var _ StatusSource = NewIMAPSource(&IMAPConfig{}, nil)
+		var _ StatusSource = NewNotifier(&Config{}, &Credentials{}, nil)
+		var _ StatusSource = NewSimulatedSource()
+	})
+})
+
+var _ = Describe("Simulated Source", func() {
+	It("should step through the default sequence and stay on the last update", func() {
+		source := NewSimulatedSource()
+
+		var reported []OrderStatus
+		source.OnStatus = func(info OrderInfo) { reported = append(reported, info.Status) }
+
+		for range 6 {
+			_, err := source.CheckStatus(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(reported).To(Equal([]OrderStatus{
+			OrderStatusPlaced,
+			OrderStatusPreparing,
+			OrderStatusDriverAssigned,
+			OrderStatusOutForDelivery,
+			OrderStatusArrived,
+			OrderStatusArrived,
+		}))
+	})
+
+	It("should report the given updates", func() {
+		source := NewSimulatedSource(OrderInfo{Status: OrderStatusArrived, Vendor: "Test"})
+
+		info, err := source.CheckStatus(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Vendor).To(Equal("Test"))
+	})
+
+	It("should fail when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := NewSimulatedSource().CheckStatus(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
+
+var _ = Describe("Quick Retries", func() {
+	var (
+		checks    int
+		refreshes int
+		results   []error
+	)
+
+	check := func(ctx context.Context) (OrderInfo, error) {
+		err := results[min(checks, len(results)-1)]
+		checks++
+		if err != nil {
+			return OrderInfo{Status: OrderStatusUnknown}, err
+		}
+		return OrderInfo{Status: OrderStatusPreparing}, nil
+	}
+	refresh := func(ctx context.Context) error {
+		refreshes++
+		return nil
+	}
+
+	BeforeEach(func() {
+		checks, refreshes = 0, 0
+	})
+
+	It("should retry after a refresh when the status element is missing", func() {
+		results = []error{fmt.Errorf("%w: timeout", ErrStatusNotFound), nil}
+
+		info, err := retryMissing(context.Background(), 2, time.Millisecond, newTestLogger(), check, refresh)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Status).To(Equal(OrderStatusPreparing))
+		Expect(checks).To(Equal(2))
+		Expect(refreshes).To(Equal(1))
+	})
+
+	It("should give up after the configured number of retries", func() {
+		results = []error{fmt.Errorf("%w: timeout", ErrStatusNotFound)}
+
+		_, err := retryMissing(context.Background(), 2, time.Millisecond, newTestLogger(), check, refresh)
+		Expect(err).To(MatchError(ErrStatusNotFound))
+		Expect(checks).To(Equal(3))
+	})
+
+	It("should not retry other errors", func() {
+		results = []error{ErrSessionExpired}
+
+		_, err := retryMissing(context.Background(), 2, time.Millisecond, newTestLogger(), check, refresh)
+		Expect(err).To(MatchError(ErrSessionExpired))
+		Expect(checks).To(Equal(1))
+	})
+
+	It("should reject negative settings", func() {
+		Expect((&Config{QuickRetries: -1}).Validate()).To(MatchError(ContainSubstring("invalid quick retry")))
+	})
+})
+
+var _ = Describe("Refresh Retries", func() {
+	var (
+		results  []error
+		reloads  int
+		replaced int
+	)
+
+	reload := func(context.Context) error {
+		err := results[min(reloads, len(results)-1)]
+		reloads++
+		return err
+	}
+
+	replace := func(context.Context) error {
+		replaced++
+		return nil
+	}
+
+	BeforeEach(func() {
+		reloads, replaced = 0, 0
+	})
+
+	It("should retry a failed reload", func() {
+		results = []error{errors.New("target closed"), nil}
+
+		Expect(retryRefresh(context.Background(), 2, time.Millisecond, newTestLogger(), reload, replace)).To(Succeed())
+		Expect(reloads).To(Equal(2))
+		Expect(replaced).To(BeZero())
+	})
+
+	It("should replace the page when reloading keeps failing", func() {
+		results = []error{errors.New("target closed")}
+
+		Expect(retryRefresh(context.Background(), 2, time.Millisecond, newTestLogger(), reload, replace)).To(Succeed())
+		Expect(reloads).To(Equal(3))
+		Expect(replaced).To(Equal(1))
+	})
+
+	It("should report a failure to replace the page", func() {
+		results = []error{errors.New("target closed")}
+
+		err := retryRefresh(context.Background(), 0, time.Millisecond, newTestLogger(), reload, func(context.Context) error {
+			return errors.New("browser has disconnected")
+		})
+		Expect(err).To(MatchError(ContainSubstring("failed to replace page: browser has disconnected")))
+		Expect(reloads).To(Equal(1))
+	})
+
+	It("should reject negative retries", func() {
+		Expect((&Config{RefreshRetries: -1}).Validate()).To(MatchError(ContainSubstring("invalid refresh retries")))
+	})
+})
+
+var _ = Describe("Known Statuses", func() {
+	It("should round trip every known status through ParseOrderStatus", func() {
+		for _, known := range KnownStatuses() {
+			Expect(ParseOrderStatus(string(known.Status))).To(Equal(known.Status), known.Name)
+		}
+	})
+
+	It("should return a copy", func() {
+		statuses := KnownStatuses()
+		statuses[0].Status = "Changed"
+		Expect(KnownStatuses()[0].Status).To(Equal(OrderStatusPlaced))
+	})
+})
+
+var _ = Describe("Status Suggestions", func() {
+	DescribeTable("levenshtein function",
+		func(a, b string, expected int) {
+			Expect(levenshtein(a, b)).To(Equal(expected))
+			Expect(levenshtein(b, a)).To(Equal(expected))
+		},
+		Entry("identical", "Order Placed", "Order Placed", 0),
+		Entry("empty", "", "abc", 3),
+		Entry("insertion", "Order Placedd", "Order Placed", 1),
+		Entry("substitution", "Order Plated", "Order Placed", 1),
+		Entry("case differences", "order placed", "Order Placed", 2),
+		Entry("classic example", "kitten", "sitting", 3),
+		Entry("multibyte runes", "café", "cafe", 1),
+	)
+
+	DescribeTable("SuggestOrderStatus function",
+		func(text string, expected OrderStatus, ok bool) {
+			suggestion, found := SuggestOrderStatus(text)
+			Expect(found).To(Equal(ok))
+			if ok {
+				Expect(suggestion).To(Equal(expected))
+			}
+		},
+		Entry("typo", "Order Placedd", OrderStatusPlaced, true),
+		Entry("lowercase", "order arrived", OrderStatusArrived, true),
+		Entry("american spelling", "Order Canceled", OrderStatusCancelled, true),
+		Entry("unrelated text", "Driver en route", OrderStatusUnknown, false),
+		Entry("empty", "", OrderStatusUnknown, false),
+	)
+})
+
+var _ = Describe("Login Landing Page", func() {
+	DescribeTable("checkLandingURL function",
+		func(current string, ok bool) {
+			err := checkLandingURL(current, DefaultLoginURL)
+			if ok {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ErrUnexpectedPage))
+				Expect(err.Error()).To(ContainSubstring(current))
+			}
+		},
+		Entry("schedule page", "https://relish.ezcater.com/schedule", true),
+		Entry("schedule page with query", "https://relish.ezcater.com/schedule?date=2025-07-01", true),
+		Entry("schedule subpage", "https://relish.ezcater.com/schedule/week", true),
+		Entry("still on the identity provider", "https://identity.ezcater.com/u/login/password", false),
+		Entry("account locked page", "https://relish.ezcater.com/account-locked", false),
+		Entry("about:blank", "about:blank", false),
+	)
+})
+
+var _ = Describe("Network Throttling", func() {
+	DescribeTable("ParseThrottle function",
+		func(spec string, expected *Throttle) {
+			throttle, err := ParseThrottle(spec)
+			if expected == nil {
+				Expect(err).To(MatchError(ContainSubstring("invalid throttle")))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(throttle).To(Equal(expected))
+		},
+		Entry("slow 3G preset", "slow-3g", &Throttle{Latency: 2 * time.Second, DownloadKbps: 400, UploadKbps: 400}),
+		Entry("custom", "1s, 200, 100", &Throttle{Latency: time.Second, DownloadKbps: 200, UploadKbps: 100}),
+		Entry("latency only", "500ms,0,0", &Throttle{Latency: 500 * time.Millisecond}),
+		Entry("unknown preset", "dialup", nil),
+		Entry("bad latency", "slow,1,1", nil),
+		Entry("negative rate", "1s,-1,1", nil),
+	)
+
+	It("should convert to protocol units", func() {
+		conditions := (&Throttle{Latency: 2 * time.Second, DownloadKbps: 400}).networkConditions()
+
+		Expect(conditions.Latency).To(Equal(2000.0))
+		Expect(conditions.DownloadThroughput).To(Equal(50000.0))
+		Expect(conditions.UploadThroughput).To(Equal(-1.0))
+	})
+})
+
+var _ = Describe("Invalid Credentials", func() {
+	DescribeTable("invalidCredentialsPattern",
+		func(text string, expected bool) {
+			Expect(invalidCredentialsPattern.MatchString(text)).To(Equal(expected))
+		},
+		Entry("wrong email or password", "Wrong email or password", true),
+		Entry("incorrect password", "Incorrect password. Try again.", true),
+		Entry("invalid credentials", "Invalid credentials", true),
+		Entry("captcha", "Please complete the CAPTCHA", false),
+		Entry("rate limited", "Too many attempts, try again later", false),
+	)
+})
+
+var _ = Describe("Warmup", func() {
+	DescribeTable("siteRoot",
+		func(loginURL, expected string) {
+			root, err := siteRoot(loginURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(root).To(Equal(expected))
+		},
+		Entry("default login page", DefaultLoginURL, "https://relish.ezcater.com/"),
+		Entry("query string", "http://127.0.0.1:8080/schedule?week=2", "http://127.0.0.1:8080/"),
+	)
+
+	It("should reject a negative delay", func() {
+		err := (&Config{Warmup: true, WarmupDelay: -time.Second}).Validate()
+		Expect(err).To(MatchError(ContainSubstring("invalid warmup delay")))
+	})
+})
+
+var _ = Describe("Redaction", func() {
+	const password = "correct-horse-battery"
+
+	var (
+		buf      *bytes.Buffer
+		logger   *slog.Logger
+		notifier *Notifier
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		logger = slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		notifier = NewNotifier(&Config{}, &Credentials{Username: "user@example.com", Password: password}, logger)
+	})
+
+	It("should hide the password in messages, attributes, errors, and groups", func() {
+		notifier.logger.Warn("login form reported an error", "error", "Wrong password "+password)
+		notifier.logger.With("input", password).Debug("submitting " + password)
+		notifier.logger.Error("failed to log in", "error", fmt.Errorf("value %q rejected", password), "form", slog.GroupValue(slog.String("password", password)))
+
+		Expect(buf.String()).To(ContainSubstring("login form reported an error"))
+		Expect(buf.String()).To(ContainSubstring(redacted))
+		Expect(buf.String()).NotTo(ContainSubstring(password))
+	})
+
+	It("should hide a password that changes while running", func() {
+		notifier.credentials.Password = "new-" + password
+		notifier.logger.Info("typing new-" + password)
+
+		Expect(buf.String()).NotTo(ContainSubstring(password))
+	})
+
+	It("should keep wrapped errors comparable", func() {
+		err := redactError(fmt.Errorf("%w: %s", ErrInvalidCredentials, password), []string{password})
+
+		Expect(err).To(MatchError(ErrInvalidCredentials))
+		Expect(err.Error()).To(Equal("invalid credentials: " + redacted))
+		Expect(redactError(nil, []string{password})).To(Succeed())
+	})
+
+	It("should keep the IMAP password out of errors", func() {
+		// A careless server that repeats the failed command back to the client
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close() //nolint:errcheck
+
+			fmt.Fprintf(conn, "* OK fake IMAP server ready\r\n")
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			tag, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+			fmt.Fprintf(conn, "%s NO rejected %s\r\n", tag, command)
+		}()
+
+		source := NewIMAPSource(&IMAPConfig{Server: listener.Addr().String(), Username: "me", Password: password, DisableTLS: true}, logger)
+		source.OnError = func(err error) {
+			logger.Error("check failed", "error", err)
+		}
+
+		_, err = source.CheckStatus(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("rejected LOGIN")))
+		Expect(err.Error()).NotTo(ContainSubstring(password))
+		Expect(buf.String()).NotTo(ContainSubstring(password))
+	})
+})
+
+var _ = Describe("HTML Snapshots", func() {
+	It("should write the page to a timestamped file", func() {
+		dir := filepath.Join(GinkgoT().TempDir(), "snapshots")
+		t := time.Date(2025, 6, 1, 12, 30, 5, 250*int(time.Millisecond), time.UTC)
+
+		path, err := writeSnapshot(dir, "<html></html>", t)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal(filepath.Join(dir, "relish-20250601-123005.250.html")))
+		Expect(os.ReadFile(path)).To(Equal([]byte("<html></html>")))
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+	})
+
+	It("should report a directory that cannot be created", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "file")
+		Expect(os.WriteFile(file, nil, 0o600)).To(Succeed())
+
+		_, err := writeSnapshot(filepath.Join(file, "snapshots"), "<html></html>", time.Now())
+		Expect(err).To(MatchError(ContainSubstring("failed to create snapshot directory")))
+	})
+})
+
+var _ = Describe("API Responses", func() {
+	DescribeTable("lookupJSONString function",
+		func(body, path string, expected string, found bool) {
+			var value any
+			Expect(json.Unmarshal([]byte(body), &value)).To(Succeed())
+
+			s, ok := lookupJSONString(value, path)
+			Expect(ok).To(Equal(found))
+			Expect(s).To(Equal(expected))
+		},
+		Entry("top level field", `{"status": "Order Placed"}`, "status", "Order Placed", true),
+		Entry("nested field", `{"orders": [{"status": "Order Arrived"}]}`, "orders.0.status", "Order Arrived", true),
+		Entry("missing field", `{"state": "Order Placed"}`, "status", "", false),
+		Entry("index out of range", `{"orders": []}`, "orders.0.status", "", false),
+		Entry("not a string", `{"status": 3}`, "status", "", false),
+	)
+
+	It("should read the status and ETA", func() {
+		fields := apiFields{status: "order.status", eta: "order.eta"}
+		info, err := parseAPIResponse([]byte(`{"order": {"status": "Out for Delivery", "eta": "12:30 PM"}}`), fields, "", time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(OrderInfo{Status: OrderStatusOutForDelivery, ETA: "12:30 PM"}))
+	})
+
+	It("should read the order ID, vendor, and driver", func() {
+		body := `{"status": "Out for Delivery", "id": 1234567890123456789, "vendor": "Tasty Tacos",
+			"driver": {"name": "Sam", "location": "2 miles away"}}`
+		fields := (&Config{APIDriverField: "driver.name", APIDriverLocationField: "driver.location"}).apiFields()
+
+		info, err := parseAPIResponse([]byte(body), fields, "", time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(OrderInfo{
+			Status:         OrderStatusOutForDelivery,
+			OrderID:        "1234567890123456789",
+			Vendor:         "Tasty Tacos",
+			Driver:         "Sam",
+			DriverLocation: "2 miles away",
+		}))
+	})
+
+	It("should report a driver assigned before the status changes", func() {
+		fields := (&Config{}).apiFields()
+
+		info, err := parseAPIResponse([]byte(`{"status": "Preparing Your Order", "driver": "Sam"}`), fields, "", time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(OrderInfo{Status: OrderStatusDriverAssigned, Driver: "Sam"}))
+
+		info, err = parseAPIResponse([]byte(`{"status": "Preparing Your Order"}`), fields, "", time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Status).To(Equal(OrderStatusPreparing))
+	})
+
+	It("should only accept the order asked for", func() {
+		fields := (&Config{}).apiFields()
+
+		info, err := parseAPIResponse([]byte(`{"status": "Order Placed", "id": "A100"}`), fields, "A100", time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.OrderID).To(Equal("A100"))
+
+		_, err = parseAPIResponse([]byte(`{"status": "Order Placed", "id": "A100"}`), fields, "B200", time.Local)
+		Expect(err).To(MatchError(ContainSubstring("API response is for order A100, not B200")))
+
+		_, err = parseAPIResponse([]byte(`{"status": "Order Placed"}`), fields, "B200", time.Local)
+		Expect(err).To(MatchError(ContainSubstring(`API response has no "id" field to find order B200 by`)))
+	})
+
+	It("should show an ETA timestamp as a time of day", func() {
+		eta := time.Date(2025, 6, 1, 12, 30, 0, 0, time.Local)
+		body := fmt.Sprintf(`{"status": "Order Placed", "eta": %q}`, eta.Format(time.RFC3339))
+
+		info, err := parseAPIResponse([]byte(body), (&Config{}).apiFields(), "", time.Local)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ETA).To(Equal("12:30 PM"))
+	})
+
+	It("should show an ETA timestamp in the given time zone", func() {
+		body := `{"status": "Order Placed", "eta": "2025-06-01T16:30:00Z"}`
+		loc, err := time.LoadLocation("America/New_York")
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := parseAPIResponse([]byte(body), (&Config{}).apiFields(), "", loc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ETA).To(Equal("12:30 PM"))
+	})
+
+	It("should reject a status the schedule page doesn't show", func() {
+		_, err := parseAPIResponse([]byte(`{"status": "out_for_delivery"}`), (&Config{}).apiFields(), "", time.Local)
+		Expect(err).To(MatchError(ContainSubstring(`unknown order status "out_for_delivery"`)))
+	})
+
+	It("should reject a response that isn't JSON", func() {
+		_, err := parseAPIResponse([]byte(`<html></html>`), (&Config{}).apiFields(), "", time.Local)
+		Expect(err).To(MatchError(ContainSubstring("failed to parse API response")))
+	})
+
+	It("should require a URL in API mode", func() {
+		Expect((&Config{APIMode: true}).Validate()).To(MatchError(ContainSubstring("requires an API URL")))
+	})
+})
+
+var _ = Describe("Recordings", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "recording")
+	})
+
+	It("should number each check and read it back", func() {
+		recording := Recording{
+			Time: time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC),
+			Info: OrderInfo{Status: OrderStatusOutForDelivery, ETA: "12:45 PM", Vendor: "Tasty Thai"},
+			Text: "Tasty Thai Out for Delivery",
+		}
+
+		first, err := WriteRecording(dir, recording, "<html>first</html>", []byte("png"))
+		Expect(err).NotTo(HaveOccurred())
+		second, err := WriteRecording(dir, Recording{Error: "status not found"}, "<html>second</html>", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(RecordingDirs(dir)).To(Equal([]string{first, second}))
+		Expect(first).To(Equal(filepath.Join(dir, "0001")))
+		Expect(filepath.Join(first, RecordingScreenshot)).To(BeAnExistingFile())
+		Expect(filepath.Join(second, RecordingScreenshot)).NotTo(BeAnExistingFile())
+
+		read, html, err := ReadRecording(first)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read).To(Equal(recording))
+		Expect(html).To(Equal("<html>first</html>"))
+	})
+
+	It("should continue after the checks already recorded", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "0009"), 0o700)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "notes"), 0o700)).To(Succeed())
+
+		path, err := WriteRecording(dir, Recording{}, "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal(filepath.Join(dir, "0010")))
+	})
+
+	It("should report a recording without a result", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "0001"), 0o700)).To(Succeed())
+
+		_, _, err := ReadRecording(filepath.Join(dir, "0001"))
+		Expect(err).To(MatchError(ContainSubstring("failed to read recording")))
+	})
+})
+
+var _ = Describe("HAR Files", func() {
+	// har is a capture with the schedule page twice, once base64 encoded, along with
+	// requests that aren't the schedule page or didn't load
+	const har = `{"log": {"entries": [
+		{"startedDateTime": "2025-06-01T12:00:00Z", "request": {"url": "https://relish.ezcater.com/schedule"},
+		 "response": {"status": 200, "content": {"mimeType": "text/html; charset=utf-8", "text": "<html>placed</html>"}}},
+		{"startedDateTime": "2025-06-01T12:00:01Z", "request": {"url": "https://relish.ezcater.com/logo.png"},
+		 "response": {"status": 200, "content": {"mimeType": "image/png", "text": "cG5n", "encoding": "base64"}}},
+		{"startedDateTime": "2025-06-01T12:05:00Z", "request": {"url": "https://relish.ezcater.com/schedule"},
+		 "response": {"status": 502, "content": {"mimeType": "text/html", "text": "Bad Gateway"}}},
+		{"startedDateTime": "2025-06-01T12:10:00Z", "request": {"url": "https://staging.ezcater.com/schedule?tab=today"},
+		 "response": {"status": 200, "content": {"mimeType": "text/html", "text": "PGh0bWw+YXJyaXZlZDwvaHRtbD4=", "encoding": "base64"}}}
+	]}}`
+
+	It("should read the schedule pages that loaded", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "capture.har")
+		Expect(os.WriteFile(path, []byte(har), 0o600)).To(Succeed())
+
+		pages, err := ReadHARPages(path, DefaultLoginURL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages).To(Equal([]HARPage{
+			{Time: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), URL: "https://relish.ezcater.com/schedule", HTML: "<html>placed</html>"},
+			{Time: time.Date(2025, 6, 1, 12, 10, 0, 0, time.UTC), URL: "https://staging.ezcater.com/schedule?tab=today", HTML: "<html>arrived</html>"},
+		}))
+	})
+
+	It("should reject a file that isn't HAR", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "capture.har")
+		Expect(os.WriteFile(path, []byte("<html>"), 0o600)).To(Succeed())
+
+		_, err := ReadHARPages(path, DefaultLoginURL)
+		Expect(err).To(MatchError(ContainSubstring("failed to parse HAR file")))
+	})
+})
+
+var _ = Describe("Order IDs", func() {
+	It("should find the card with the given ID", func() {
+		Expect(matchOrderID([]string{"A100", "", "B200"}, "B200")).To(Equal(2))
+	})
+
+	It("should list the IDs on the page when the order is missing", func() {
+		_, err := matchOrderID([]string{"A100", "", "B200"}, "C300")
+		Expect(err).To(MatchError(ErrOrderNotFound))
+		Expect(err).To(MatchError("order not found: C300 (found A100, B200)"))
+	})
+
+	It("should say so when no card has an ID", func() {
+		_, err := matchOrderID([]string{"", ""}, "C300")
+		Expect(err).To(MatchError(ContainSubstring("no orders with IDs on the page")))
+	})
+})
+
+var _ = Describe("Page Markup", func() {
+	card := []string{
+		"div.schedule-card",
+		"div.schedule-card>div",
+		"div.schedule-card>div.schedule-card-label",
+		"div.schedule-card>div.schedule-card-vendor",
+	}
+
+	It("should identify the structure regardless of order and repeats", func() {
+		markup := NewMarkup(card)
+		Expect(markup.Hash).To(HaveLen(16))
+		Expect(markup.Elements).To(Equal(card))
+
+		reordered := NewMarkup([]string{card[3], card[1], card[0], card[2], card[1]})
+		Expect(reordered).To(Equal(markup))
+	})
+
+	It("should measure how much of the structure two cards share", func() {
+		markup := NewMarkup(card)
+		Expect(markup.Similarity(markup)).To(Equal(1.0))
+
+		// A driver is shown once one is assigned
+		withDriver := NewMarkup(append(slices.Clone(card), "div.schedule-card>div.schedule-card-driver-name"))
+		Expect(markup.Similarity(withDriver)).To(Equal(0.8))
+		Expect(withDriver.Similarity(markup)).To(Equal(0.8))
+
+		renamed := NewMarkup([]string{"article.order", "article.order>span.status"})
+		Expect(markup.Similarity(renamed)).To(BeZero())
+
+		Expect(NewMarkup(nil).Similarity(NewMarkup(nil))).To(Equal(1.0))
+	})
+})
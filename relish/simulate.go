@@ -0,0 +1,61 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import "context"
+
+// SimulatedSource is a StatusSource that steps through a fixed sequence of order
+// updates, one per check, and then keeps reporting the last one. It is useful for
+// trying out notifications without waiting for a real order.
+type SimulatedSource struct {
+	Callbacks
+
+	updates []OrderInfo
+	checks  int
+}
+
+// NewSimulatedSource creates a SimulatedSource that reports the given updates in
+// order. If none are given, it simulates an order being placed, prepared, given a driver,
+// sent out, and delivered.
+func NewSimulatedSource(updates ...OrderInfo) *SimulatedSource {
+	if len(updates) == 0 {
+		updates = []OrderInfo{
+			{Status: OrderStatusPlaced, Vendor: "Simulated Kitchen"},
+			{Status: OrderStatusPreparing, ETA: "12:30 PM", Vendor: "Simulated Kitchen"},
+			{Status: OrderStatusDriverAssigned, ETA: "12:30 PM", Vendor: "Simulated Kitchen", Driver: "Sam"},
+			{Status: OrderStatusOutForDelivery, ETA: "12:30 PM", Vendor: "Simulated Kitchen", Driver: "Sam", DriverLocation: "2 stops away"},
+			{Status: OrderStatusArrived, ETA: "12:30 PM", Vendor: "Simulated Kitchen"},
+		}
+	}
+
+	return &SimulatedSource{updates: updates}
+}
+
+// CheckStatus returns the next update in the sequence. The OnStatus and OnError
+// callbacks are invoked with the result.
+func (s *SimulatedSource) CheckStatus(ctx context.Context) (OrderInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return OrderInfo{}, err
+	}
+
+	info := s.updates[min(s.checks, len(s.updates)-1)]
+	s.checks++
+	s.report(ctx, info, nil)
+	return info, nil
+}
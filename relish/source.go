@@ -0,0 +1,50 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import "context"
+
+// StatusSource is anything that can report the current status of an order,
+// such as the browser based Notifier or an IMAPSource
+type StatusSource interface {
+	CheckStatus(ctx context.Context) (OrderInfo, error)
+}
+
+// Callbacks are invoked by a StatusSource with the result of every check
+type Callbacks struct {
+	// OnStatus, if set, is called with the result of every successful check
+	OnStatus func(OrderInfo)
+	// OnError, if set, is called whenever a check fails. It is not called when a check
+	// is interrupted because its context was cancelled.
+	OnError func(error)
+}
+
+// report passes the result of a check to the registered callbacks
+func (c *Callbacks) report(ctx context.Context, info OrderInfo, err error) {
+	if err != nil {
+		if c.OnError != nil && ctx.Err() == nil {
+			c.OnError(err)
+		}
+		return
+	}
+
+	if c.OnStatus != nil {
+		c.OnStatus(info)
+	}
+}
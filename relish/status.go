@@ -0,0 +1,177 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// OrderStatus is the status of an order as shown on the schedule page
+type OrderStatus string
+
+const (
+	OrderStatusPlaced         OrderStatus = "Order Placed"
+	OrderStatusPreparing      OrderStatus = "Preparing Your Order"
+	OrderStatusDriverAssigned OrderStatus = "Driver Assigned"
+	OrderStatusOutForDelivery OrderStatus = "Out for Delivery"
+	OrderStatusArrived        OrderStatus = "Order Arrived"
+	OrderStatusCancelled      OrderStatus = "Order Cancelled"
+	OrderStatusDelayed        OrderStatus = "Order Delayed"
+	OrderStatusUnknown        OrderStatus = "Unknown"
+)
+
+// StatusDefinition describes a status that can appear on the schedule page
+type StatusDefinition struct {
+	// Name is the name of the Go constant for the status
+	Name   string      `json:"name"`
+	Status OrderStatus `json:"text"`
+}
+
+// knownStatuses lists every status recognized on the schedule page. ParseOrderStatus
+// matches against this list, so a new status only needs to be added here.
+var knownStatuses = []StatusDefinition{
+	{"OrderStatusPlaced", OrderStatusPlaced},
+	{"OrderStatusPreparing", OrderStatusPreparing},
+	{"OrderStatusDriverAssigned", OrderStatusDriverAssigned},
+	{"OrderStatusOutForDelivery", OrderStatusOutForDelivery},
+	{"OrderStatusDelayed", OrderStatusDelayed},
+	{"OrderStatusArrived", OrderStatusArrived},
+	{"OrderStatusCancelled", OrderStatusCancelled},
+}
+
+// etaPattern matches the estimated arrival time shown on the schedule card
+var etaPattern = regexp.MustCompile(`(?i)arriv(?:ing|es)\s+(?:at|by)\s+(\d{1,2}:\d{2}\s*[AP]M)`)
+
+// OrderInfo holds the details scraped from the schedule card
+type OrderInfo struct {
+	Status OrderStatus
+	ETA    string
+	Vendor string
+	// OrderID is the data-order-id attribute of the schedule card, if it has one
+	OrderID string
+	// Driver and DriverLocation describe the delivery driver while the order is on its way,
+	// if the site shows them
+	Driver         string
+	DriverLocation string
+}
+
+// String converts an OrderStatus value to its string representation
+func (os OrderStatus) String() string {
+	return string(os)
+}
+
+// IsFinal reports whether the order can no longer change status, because it has
+// either arrived or been cancelled
+func (os OrderStatus) IsFinal() bool {
+	return os == OrderStatusArrived || os == OrderStatusCancelled
+}
+
+// ParseOrderStatus converts the text of a status label to the corresponding OrderStatus
+// value. Text that does not exactly match a known status yields OrderStatusUnknown.
+func ParseOrderStatus(text string) OrderStatus {
+	for _, known := range knownStatuses {
+		if text == string(known.Status) {
+			return known.Status
+		}
+	}
+	return OrderStatusUnknown
+}
+
+// withDriverAssigned returns info with the status OrderStatusDriverAssigned if it names a
+// driver but the order hasn't been sent out yet. The site shows the driver who will pick
+// the order up before the status label changes.
+func withDriverAssigned(info OrderInfo) OrderInfo {
+	if info.Driver != "" && (info.Status == OrderStatusPlaced || info.Status == OrderStatusPreparing) {
+		info.Status = OrderStatusDriverAssigned
+	}
+	return info
+}
+
+// KnownStatuses returns the statuses recognized on the schedule page, roughly in the
+// order an order progresses through them
+func KnownStatuses() []StatusDefinition {
+	return slices.Clone(knownStatuses)
+}
+
+// maxSuggestionDistance is the largest edit distance at which SuggestOrderStatus offers a guess
+const maxSuggestionDistance = 3
+
+// SuggestOrderStatus returns the known status closest to text, for use in diagnostics when
+// ParseOrderStatus does not recognize it. The boolean is false if no status is close enough.
+func SuggestOrderStatus(text string) (OrderStatus, bool) {
+	best, bestDistance := OrderStatusUnknown, maxSuggestionDistance+1
+	for _, known := range knownStatuses {
+		if distance := levenshtein(text, string(known.Status)); distance < bestDistance {
+			best, bestDistance = known.Status, distance
+		}
+	}
+	return best, bestDistance <= maxSuggestionDistance
+}
+
+// levenshtein returns the number of single character insertions, deletions, and
+// substitutions needed to turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// previous holds the distances from the first i-1 runes of a to each prefix of b
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// ETATime converts an estimated arrival time such as "12:30 PM" to a time on the same day
+// as now, in now's time zone
+func ETATime(eta string, now time.Time) (time.Time, error) {
+	clock, err := time.Parse("3:04PM", strings.ToUpper(strings.ReplaceAll(eta, " ", "")))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid ETA %q: %w", eta, err)
+	}
+
+	year, month, day := now.Date()
+	return time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, now.Location()), nil
+}
+
+// parseETA extracts an estimated arrival time such as "12:30 PM" from free-form text
+func parseETA(text string) string {
+	match := etaPattern.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
@@ -0,0 +1,90 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package relish
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Throttle describes simulated network conditions, for reproducing problems that only
+// happen on slow connections
+type Throttle struct {
+	Latency time.Duration
+	// DownloadKbps and UploadKbps limit throughput in kilobits per second. Zero means unlimited.
+	DownloadKbps int
+	UploadKbps   int
+}
+
+// throttlePresets match the network presets in the Chrome developer tools
+var throttlePresets = map[string]Throttle{
+	"slow-3g": {Latency: 2 * time.Second, DownloadKbps: 400, UploadKbps: 400},
+	"fast-3g": {Latency: 563 * time.Millisecond, DownloadKbps: 1440, UploadKbps: 675},
+}
+
+// ParseThrottle parses either a preset name (slow-3g or fast-3g) or a custom
+// specification of the form "latency,download-kbps,upload-kbps", e.g. "1s,200,100".
+func ParseThrottle(spec string) (*Throttle, error) {
+	if preset, ok := throttlePresets[spec]; ok {
+		return &preset, nil
+	}
+
+	fields := strings.Split(spec, ",")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid throttle %q: expected slow-3g, fast-3g, or latency,download-kbps,upload-kbps", spec)
+	}
+
+	latency, err := time.ParseDuration(strings.TrimSpace(fields[0]))
+	if err != nil || latency < 0 {
+		return nil, fmt.Errorf("invalid throttle latency %q", fields[0])
+	}
+
+	download, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+	if err != nil || download < 0 {
+		return nil, fmt.Errorf("invalid throttle download rate %q", fields[1])
+	}
+
+	upload, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+	if err != nil || upload < 0 {
+		return nil, fmt.Errorf("invalid throttle upload rate %q", fields[2])
+	}
+
+	return &Throttle{Latency: latency, DownloadKbps: download, UploadKbps: upload}, nil
+}
+
+// networkConditions converts the throttle to the DevTools protocol request that applies it
+func (t *Throttle) networkConditions() proto.NetworkEmulateNetworkConditions {
+	// The protocol wants bytes per second, with -1 meaning unlimited
+	throughput := func(kbps int) float64 {
+		if kbps == 0 {
+			return -1
+		}
+		return float64(kbps) * 1000 / 8
+	}
+
+	return proto.NetworkEmulateNetworkConditions{
+		Latency:            float64(t.Latency.Milliseconds()),
+		DownloadThroughput: throughput(t.DownloadKbps),
+		UploadThroughput:   throughput(t.UploadKbps),
+	}
+}
@@ -0,0 +1,221 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"relish-notifier/relish"
+)
+
+// replayFunc reads the order status from a recorded page
+type replayFunc func(ctx context.Context, html string) (relish.OrderInfo, error)
+
+// replayRecordings replays every check recorded in dir, printing whether each one still
+// gives the recorded result, and returns an error if any don't
+func replayRecordings(ctx context.Context, w io.Writer, dir string, replay replayFunc) error {
+	dirs, err := relish.RecordingDirs(dir)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no recorded checks found in %s", dir)
+	}
+
+	failed := 0
+	for _, path := range dirs {
+		name := filepath.Base(path)
+
+		recording, html, err := relish.ReadRecording(path)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", name, err) //nolint:errcheck
+			continue
+		}
+
+		info, err := replay(ctx, html)
+		if mismatch := compareReplay(recording, info, err); mismatch != "" {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %s\n", name, mismatch) //nolint:errcheck
+			continue
+		}
+		if recording.Error != "" {
+			fmt.Fprintf(w, "PASS  %s: failed as recorded\n", name) //nolint:errcheck
+		} else {
+			fmt.Fprintf(w, "PASS  %s: %s\n", name, info.Status) //nolint:errcheck
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d recorded checks no longer match", failed, len(dirs))
+	}
+	return nil
+}
+
+// replayHAR reads the order status from every schedule page captured in the HAR file at
+// path, printing each result, and returns an error if there are none or any fail. With a
+// record directory, each page is also saved as a recording, so that replayRecordings can
+// check it against later selectors.
+func replayHAR(ctx context.Context, w io.Writer, path, recordDir string, replay replayFunc) error {
+	pages, err := relish.ReadHARPages(path, relish.DefaultLoginURL)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("no schedule pages found in %s", path)
+	}
+
+	failed := 0
+	for i, page := range pages {
+		name := fmt.Sprintf("%d (%s)", i+1, page.Time.Format(time.RFC3339))
+
+		info, err := replay(ctx, page.HTML)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", name, err) //nolint:errcheck
+		} else {
+			fmt.Fprintf(w, "OK    %s: %s\n", name, describeReplay(info)) //nolint:errcheck
+		}
+
+		if recordDir != "" {
+			recording := relish.Recording{Time: page.Time, Info: info}
+			if err != nil {
+				recording.Error = err.Error()
+			}
+			if _, err := relish.WriteRecording(recordDir, recording, page.HTML, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d captured pages gave no order status", failed, len(pages))
+	}
+	return nil
+}
+
+// describeReplay summarizes what a replayed check read from the page
+func describeReplay(info relish.OrderInfo) string {
+	parts := []string{string(info.Status)}
+	if info.OrderID != "" {
+		parts = append(parts, "order "+info.OrderID)
+	}
+	if info.Vendor != "" {
+		parts = append(parts, "from "+info.Vendor)
+	}
+	if info.ETA != "" {
+		parts = append(parts, "ETA "+info.ETA)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// compareReplay describes how a replayed check differs from the recording, or returns ""
+// if it matches. A check that failed when recorded only has to fail again.
+func compareReplay(recording relish.Recording, info relish.OrderInfo, err error) string {
+	switch {
+	case recording.Error != "" && err == nil:
+		return fmt.Sprintf("recorded error %q, replay found %s", recording.Error, info.Status)
+	case recording.Error != "":
+		return ""
+	case err != nil:
+		return fmt.Sprintf("recorded %s, replay failed: %v", recording.Info.Status, err)
+	case info.Status != recording.Info.Status:
+		return fmt.Sprintf("recorded %s, replay found %s", recording.Info.Status, info.Status)
+	case info != recording.Info:
+		return fmt.Sprintf("recorded %+v, replay found %+v", recording.Info, info)
+	}
+	return ""
+}
+
+// newReplayCommand creates the hidden replay command, which checks pages saved with
+// --record-dir against the current selectors
+func newReplayCommand(config *Config, root *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay DIR",
+		Short: "Check that pages recorded with --record-dir still give the recorded status",
+		Long: "Check that pages recorded with --record-dir still give the recorded status.\n\n" +
+			"replay loads each recorded page into the browser and reads the order status from it with the\n" +
+			"current selectors, without going to the website. It exits with status 1 if any recorded\n" +
+			"check gives a different result.",
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			logger := config.logger()
+
+			if err := config.Validate(); err != nil {
+				return err
+			}
+
+			notifier := relish.NewNotifier(&config.Config, nil, logger)
+			if err := notifier.InitializeBrowser(); err != nil {
+				return err
+			}
+			defer notifier.Close()
+
+			return replayRecordings(cmd.Context(), cmd.OutOrStdout(), args[0], notifier.Replay)
+		},
+	}
+
+	cmd.Flags().AddFlagSet(root.Flags())
+
+	return cmd
+}
+
+// newReplayHARCommand creates the hidden replay-har command, which reads the order status
+// from schedule pages captured in a HAR file, for reproducing problems with the real site
+func newReplayHARCommand(config *Config, root *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay-har FILE",
+		Short: "Read the order status from schedule pages captured in a HAR file",
+		Long: "Read the order status from schedule pages captured in a HAR file.\n\n" +
+			"replay-har loads every schedule page saved in FILE, such as one exported from the network tab\n" +
+			"of a browser's developer tools, into the browser and reads the order status from it, without\n" +
+			"going to the website. With --record-dir, each page is saved as a recording that the replay\n" +
+			"command can check later. It exits with status 1 if any page gives no order status.",
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			logger := config.logger()
+
+			if err := config.Validate(); err != nil {
+				return err
+			}
+
+			notifier := relish.NewNotifier(&config.Config, nil, logger)
+			if err := notifier.InitializeBrowser(); err != nil {
+				return err
+			}
+			defer notifier.Close()
+
+			return replayHAR(cmd.Context(), cmd.OutOrStdout(), args[0], config.RecordDir, notifier.Replay)
+		},
+	}
+
+	cmd.Flags().AddFlagSet(root.Flags())
+
+	return cmd
+}
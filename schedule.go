@@ -0,0 +1,173 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// intervalWindow is a time of day during which checks happen at their own interval.
+// start and end are offsets from midnight; a window that ends before it starts runs
+// past midnight.
+type intervalWindow struct {
+	start, end time.Duration
+	interval   time.Duration
+}
+
+// String returns the window's times in the form they are given, such as "11:45-12:30"
+func (w intervalWindow) String() string {
+	clock := func(offset time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(offset.Hours()), int(offset.Minutes())%60)
+	}
+	return clock(w.start) + "-" + clock(w.end)
+}
+
+// contains reports whether the time of day at offset falls within the window
+func (w intervalWindow) contains(offset time.Duration) bool {
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// intervalSchedule chooses the time between checks from the time of day
+type intervalSchedule struct {
+	windows []intervalWindow
+}
+
+// parseIntervalSchedule parses an --interval-schedule value: a comma separated list of
+// windows like "11:45-12:30=15s", each with the interval to use between those times
+func parseIntervalSchedule(spec string) (*intervalSchedule, error) {
+	schedule := &intervalSchedule{}
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		window, err := parseIntervalWindow(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval schedule %q: %w", item, err)
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+
+	if len(schedule.windows) == 0 {
+		return nil, fmt.Errorf("interval schedule %q has no windows", spec)
+	}
+	return schedule, nil
+}
+
+// parseIntervalWindow parses a single "HH:MM-HH:MM=interval" window
+func parseIntervalWindow(item string) (intervalWindow, error) {
+	times, interval, ok := strings.Cut(item, "=")
+	if !ok || !strings.Contains(times, "-") {
+		return intervalWindow{}, fmt.Errorf("expected start-end=interval")
+	}
+	window, err := parseTimeWindow(times)
+	if err != nil {
+		return intervalWindow{}, err
+	}
+
+	if window.interval, err = time.ParseDuration(strings.TrimSpace(interval)); err != nil {
+		return intervalWindow{}, err
+	}
+	if window.interval < minInterval {
+		return intervalWindow{}, fmt.Errorf("interval %s is too short (minimum %s)", window.interval, minInterval)
+	}
+	return window, nil
+}
+
+// parseTimeWindow parses the "HH:MM-HH:MM" times of a window
+func parseTimeWindow(times string) (intervalWindow, error) {
+	from, to, ok := strings.Cut(times, "-")
+	if !ok {
+		return intervalWindow{}, fmt.Errorf("expected start-end")
+	}
+
+	var window intervalWindow
+	var err error
+	if window.start, err = parseTimeOfDay(from); err != nil {
+		return intervalWindow{}, err
+	}
+	if window.end, err = parseTimeOfDay(to); err != nil {
+		return intervalWindow{}, err
+	}
+	if window.start == window.end {
+		return intervalWindow{}, fmt.Errorf("window starts and ends at the same time")
+	}
+	return window, nil
+}
+
+// parseQuietHours parses a --quiet-hours value, a single "HH:MM-HH:MM" window
+func parseQuietHours(spec string) (intervalWindow, error) {
+	window, err := parseTimeWindow(spec)
+	if err != nil {
+		return intervalWindow{}, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	return window, nil
+}
+
+// parseTimeOfDay parses a 24 hour "HH:MM" time into an offset from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// at returns the interval of the first window containing now, or fallback if there is none
+func (s *intervalSchedule) at(now time.Time, fallback time.Duration) time.Duration {
+	if window, ok := s.window(now); ok {
+		return window.interval
+	}
+	return fallback
+}
+
+// window returns the first window containing now
+func (s *intervalSchedule) window(now time.Time) (intervalWindow, bool) {
+	offset := timeOfDay(now)
+	for _, window := range s.windows {
+		if window.contains(offset) {
+			return window, true
+		}
+	}
+	return intervalWindow{}, false
+}
+
+// timeOfDay returns the offset of now from midnight
+func timeOfDay(now time.Time) time.Duration {
+	hour, minute, second := now.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+}
+
+// endAfter returns when the window, which contains now, next ends, in now's time zone.
+// The end is found by the clock rather than by adding to now, so that a change to or
+// from daylight saving time during the window doesn't move it.
+func (w intervalWindow) endAfter(now time.Time) time.Time {
+	year, month, day := now.Date()
+	end := time.Date(year, month, day, int(w.end.Hours()), int(w.end.Minutes())%60, 0, 0, now.Location())
+	if !end.After(now) {
+		end = time.Date(year, month, day+1, int(w.end.Hours()), int(w.end.Minutes())%60, 0, 0, now.Location())
+	}
+	return end
+}
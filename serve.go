@@ -0,0 +1,228 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// serverShutdownTimeout bounds how long shutting down waits for clients to disconnect
+const serverShutdownTimeout = 2 * time.Second
+
+// statusEvent is the JSON payload of each server-sent event
+type statusEvent struct {
+	checkResult
+	Time time.Time `json:"time"`
+}
+
+// broker fans status updates out to connected event stream clients
+type broker struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	// last is the most recent event, sent to clients as soon as they connect
+	last []byte
+	// done is closed when the broker shuts down
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newBroker creates a broker with no clients
+func newBroker() *broker {
+	return &broker{
+		clients: make(map[chan []byte]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// close tells connected clients to finish sending pending events and disconnect
+func (b *broker) close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// publish sends the result of a check to every connected client
+func (b *broker) publish(info relish.OrderInfo, err error) {
+	event, jsonErr := json.Marshal(statusEvent{
+		checkResult: newCheckResult(info, "", err),
+		Time:        time.Now(),
+	})
+	if jsonErr != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last = event
+	for client := range b.clients {
+		// Drop the update for clients that aren't keeping up rather than stall the monitor
+		select {
+		case client <- event:
+		default:
+		}
+	}
+}
+
+// subscribe registers a new client, returning its channel and the most recent event
+func (b *broker) subscribe() (chan []byte, []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	client := make(chan []byte, 8)
+	b.clients[client] = struct{}{}
+	return client, b.last
+}
+
+// unsubscribe removes a client
+func (b *broker) unsubscribe(client chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.clients, client)
+}
+
+// ServeHTTP streams status updates to the client as server-sent events
+func (b *broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, last := b.subscribe()
+	defer b.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if last != nil {
+		fmt.Fprintf(w, "data: %s\n\n", last) //nolint:errcheck
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			// Deliver anything still queued, such as the final status, before disconnecting
+			for {
+				select {
+				case event := <-client:
+					fmt.Fprintf(w, "data: %s\n\n", event) //nolint:errcheck
+				default:
+					flusher.Flush()
+					return
+				}
+			}
+		case event := <-client:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// newServeMux returns the handler for the dashboard and its event stream
+func newServeMux(b *broker) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /events", b)
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, dashboardHTML) //nolint:errcheck
+	})
+	return mux
+}
+
+// startServer serves the dashboard on addr. The returned function shuts the server down
+// after giving connected clients a chance to receive any pending events.
+func startServer(addr string, b *broker, logger *slog.Logger) (func(), error) {
+	// Listen before returning so that a bad address is reported right away
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start server: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           newServeMux(b),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("serving status dashboard", "url", "http://"+listener.Addr().String()+"/")
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("status dashboard failed", "error", err)
+		}
+	}()
+
+	stop := func() {
+		b.close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close() //nolint:errcheck
+		}
+	}
+	return stop, nil
+}
+
+// dashboardHTML is a minimal page that shows the order status as it changes
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>relish-notifier</title>
+<style>
+  body { font-family: sans-serif; text-align: center; margin-top: 15vh; }
+  #status { font-size: 3em; font-weight: bold; }
+  #details, #updated { color: #666; margin-top: 1em; }
+  .arrived #status { color: #2a7d2a; }
+  .error #status { color: #b03030; }
+</style>
+</head>
+<body>
+<div id="status">Waiting for the first check...</div>
+<div id="details"></div>
+<div id="updated"></div>
+<script>
+  const events = new EventSource("events");
+  events.onmessage = (e) => {
+    const result = JSON.parse(e.data);
+    document.body.className = result.error ? "error" : (result.arrived ? "arrived" : "");
+    document.getElementById("status").textContent = result.error ? "Check failed" : result.status;
+    const details = [result.vendor, result.eta && "ETA " + result.eta, result.error].filter(Boolean);
+    document.getElementById("details").textContent = details.join(" · ");
+    document.getElementById("updated").textContent = "Updated " + new Date(result.time).toLocaleTimeString();
+    document.title = (result.error ? "Check failed" : result.status) + " - relish-notifier";
+  };
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,41 @@
+//go:build !windows
+
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// checkNowSignals ask a running process to check right away
+var checkNowSignals = []os.Signal{syscall.SIGUSR1}
+
+// processRunning reports whether a process with the given ID exists
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	// Signal 0 checks for the process without disturbing it. EPERM means it exists but
+	// belongs to someone else.
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
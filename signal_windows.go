@@ -0,0 +1,38 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "os"
+
+// checkNowSignals is empty because Windows has no SIGUSR1; use the control socket instead
+var checkNowSignals []os.Signal
+
+// processRunning reports whether a process with the given ID exists
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	// FindProcess opens a handle on Windows, so it fails for a process that has exited
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release() //nolint:errcheck
+	return true
+}
@@ -0,0 +1,162 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// twilioAPI is the base URL of the Twilio REST API
+const twilioAPI = "https://api.twilio.com/2010-04-01"
+
+// smsTimeout bounds each request to the Twilio API
+const smsTimeout = 10 * time.Second
+
+// smsLimit is the length of a single SMS segment. Longer messages are split and billed as
+// several, so messages are kept within it.
+const smsLimit = 160
+
+// smsTarget sends notifications as text messages through Twilio
+type smsTarget struct {
+	// api is the base URL of the Twilio API, which tests replace
+	api    string
+	sid    string
+	token  string
+	from   string
+	to     []string
+	client *http.Client
+}
+
+// newSMSTarget creates an SMS target from the --twilio-* and --sms-to options
+func newSMSTarget(config *Config) (*smsTarget, error) {
+	if config.TwilioSID == "" || config.TwilioFrom == "" {
+		return nil, fmt.Errorf("--sms-to requires --twilio-sid and --twilio-from")
+	}
+
+	t := &smsTarget{
+		api:    twilioAPI,
+		sid:    config.TwilioSID,
+		token:  config.TwilioToken,
+		from:   config.TwilioFrom,
+		client: &http.Client{Timeout: smsTimeout},
+	}
+	for number := range strings.SplitSeq(config.SMSTo, ",") {
+		if number = strings.TrimSpace(number); number != "" {
+			t.to = append(t.to, number)
+		}
+	}
+	if len(t.to) == 0 {
+		return nil, fmt.Errorf("--sms-to has no phone numbers")
+	}
+
+	if t.token == "" {
+		token, err := getTwilioToken(config)
+		if err != nil {
+			return nil, err
+		}
+		t.token = token
+	}
+	return t, nil
+}
+
+func (t *smsTarget) Name() string          { return "sms" }
+func (t *smsTarget) Format() messageFormat { return formatPlain }
+
+// Send texts every --sms-to number. A number that can't be reached doesn't stop the
+// others from getting the message.
+func (t *smsTarget) Send(ctx context.Context, n Notification) error {
+	body := smsBody(n)
+
+	var failed []string
+	for _, to := range t.to {
+		if err := t.send(ctx, to, body); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to send SMS: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// send sends body to a single number
+func (t *smsTarget) send(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "From": {t.from}, "Body": {body}}
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", t.api, url.PathEscape(t.sid))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", to, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.sid, t.token)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", to, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", to, twilioError(resp))
+	}
+	return nil
+}
+
+// twilioError describes a failed request from the error Twilio returns in the response,
+// or from the HTTP status if there isn't one
+func twilioError(resp *http.Response) string {
+	var apiErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+		return resp.Status
+	}
+	if apiErr.Code != 0 {
+		return fmt.Sprintf("%s (Twilio error %d)", apiErr.Message, apiErr.Code)
+	}
+	return apiErr.Message
+}
+
+// smsBody is the text sent for a notification: for a change of status, just the status
+// and ETA, and for anything else, the message cut to fit in a single SMS
+func smsBody(n Notification) string {
+	body := n.Message
+	if n.Data.Event == eventStatus {
+		body = "Relish: " + string(n.Data.Status)
+		if n.Data.ETA != "" {
+			body += ", ETA " + n.Data.ETA
+		}
+	}
+
+	body = strings.Join(strings.Fields(body), " ")
+	if runes := []rune(body); len(runes) > smsLimit {
+		body = string(runes[:smsLimit-3]) + "..."
+	}
+	return body
+}
@@ -0,0 +1,543 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// Names accepted by --source
+const (
+	sourceBrowser  = "browser"
+	sourceIMAP     = "imap"
+	sourceSimulate = "simulate"
+)
+
+// refresher is implemented by sources that need to reload between checks
+type refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// reloginer is implemented by sources that can recover from an expired session
+type reloginer interface {
+	Relogin(ctx context.Context) error
+}
+
+// browserRestarter is implemented by sources that can replace a browser that has crashed
+type browserRestarter interface {
+	RestartBrowser(ctx context.Context) error
+}
+
+// reloader is implemented by sources that can pick up changed credentials without a restart
+type reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// browserSource adds the ability to log in again to the browser based Notifier
+type browserSource struct {
+	*relish.Notifier
+
+	// credentials is shared with the Notifier, so updating it changes the next login
+	credentials *relish.Credentials
+	state       *State
+	config      *Config
+	logger      *slog.Logger
+	// started is when the browser was last started, for --restart-browser-every
+	started time.Time
+	// markup compares the page with the --markup-baseline after each check
+	markup *markupWatch
+}
+
+// CheckStatus checks the order status, then compares the page's markup with the baseline
+func (b *browserSource) CheckStatus(ctx context.Context) (relish.OrderInfo, error) {
+	info, err := b.Notifier.CheckStatus(ctx)
+	if err == nil {
+		b.checkMarkup(ctx, info.Status)
+	}
+	return info, err
+}
+
+// Refresh reloads the page, or restarts the browser once it has been running for
+// --restart-browser-every
+func (b *browserSource) Refresh(ctx context.Context) error {
+	if every := b.config.RestartBrowserEvery; every > 0 && time.Since(b.started) >= every {
+		return b.RestartBrowser(ctx)
+	}
+	return b.Notifier.Refresh(ctx)
+}
+
+// RestartBrowser replaces the browser with a new one and logs in again
+func (b *browserSource) RestartBrowser(ctx context.Context) error {
+	b.logger.Info("restarting browser", "running_for", time.Since(b.started).Round(time.Second))
+	if err := b.Restart(); err != nil {
+		return err
+	}
+	b.started = time.Now()
+
+	if err := b.Relogin(ctx); err != nil {
+		return fmt.Errorf("failed to log in after restarting browser: %w", err)
+	}
+	return nil
+}
+
+// Relogin logs in again, subject to the same rate limit as the initial login
+func (b *browserSource) Relogin(ctx context.Context) error {
+	return login(ctx, b.Notifier, b.state, b.config, b.logger)
+}
+
+// Reload reads the credentials again and logs in with them if they have changed. The
+// keyring is asked again even if it timed out before.
+func (b *browserSource) Reload(ctx context.Context) error {
+	b.config.resetKeyring()
+	credentials, err := loadCredentials(b.config)
+	if err != nil {
+		return err
+	}
+
+	if *credentials == *b.credentials {
+		b.logger.Info("credentials unchanged")
+		return nil
+	}
+
+	b.logger.Info("credentials changed, logging in again")
+	*b.credentials = *credentials
+	return b.Relogin(ctx)
+}
+
+// imapSource adds the ability to reload the mailbox password, and --max-requests-per-hour,
+// to an IMAPSource
+type imapSource struct {
+	*relish.IMAPSource
+
+	config *Config
+	budget *requestBudget
+	logger *slog.Logger
+}
+
+// CheckStatus waits until the request budget allows another visit to the mail server,
+// then checks it
+func (s *imapSource) CheckStatus(ctx context.Context) (relish.OrderInfo, error) {
+	if err := s.budget.wait(ctx, s.logger); err != nil {
+		return relish.OrderInfo{Status: relish.OrderStatusUnknown}, err
+	}
+	return s.IMAPSource.CheckStatus(ctx)
+}
+
+// Reload reads the mailbox password again, which is used from the next check on. The
+// keyring is asked again even if it timed out before.
+func (s *imapSource) Reload(ctx context.Context) error {
+	s.config.resetKeyring()
+	password, err := getIMAPPassword(s.config)
+	if err != nil {
+		return err
+	}
+	s.config.IMAP.Password = password
+	return nil
+}
+
+// loadCredentials retrieves the login credentials, applying the --totp-secret override. A
+// session cookie given with --session-cookie is used instead of the username and password,
+// as is one stored like them when there is no username and password.
+func loadCredentials(config *Config) (*relish.Credentials, error) {
+	if config.SessionCookie != "" {
+		return &relish.Credentials{SessionCookie: config.SessionCookie}, nil
+	}
+
+	credentials, err := getCredentials(config)
+	if err != nil {
+		if cookie, cookieErr := lookupCredential(config, "SESSION_COOKIE", "RELISH_SESSION_COOKIE"); cookieErr == nil && cookie != "" {
+			return &relish.Credentials{SessionCookie: cookie}, nil
+		}
+		return nil, err
+	}
+	if config.TOTPSecret != "" {
+		credentials.TOTPSecret = config.TOTPSecret
+	}
+	return credentials, nil
+}
+
+// validateSource checks that the --source value is supported
+func validateSource(name string) error {
+	switch name {
+	case sourceBrowser, sourceIMAP, sourceSimulate:
+		return nil
+	default:
+		return fmt.Errorf("unsupported source %q: must be %s, %s, or %s", name, sourceBrowser, sourceIMAP, sourceSimulate)
+	}
+}
+
+// isTransient reports whether a failed check is worth retrying. Network problems, timeouts,
+// and a status missing from the page may clear up by the next check; rejected credentials,
+// an order ID that isn't on the schedule, and cancellation won't. Errors that aren't known
+// to be fatal count as transient, so an unfamiliar hiccup doesn't end a run that would
+// otherwise recover.
+func isTransient(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, relish.ErrInvalidCredentials), errors.Is(err, relish.ErrOrderNotFound), errors.Is(err, context.Canceled):
+		return false
+	default:
+		return true
+	}
+}
+
+// openSource creates the status source selected by --source. The returned cleanup
+// function must be called when the source is no longer needed.
+func openSource(ctx context.Context, config *Config, state *State, logger *slog.Logger) (relish.StatusSource, func(), error) {
+	// budget limits requests to --max-requests-per-hour
+	budget := newRequestBudget(config.MaxRequestsPerHour, time.Now())
+
+	switch config.Source {
+	case sourceIMAP:
+		password, err := getIMAPPassword(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.IMAP.Password = password
+
+		if err := config.IMAP.Validate(); err != nil {
+			return nil, nil, err
+		}
+
+		source := &imapSource{
+			IMAPSource: relish.NewIMAPSource(&config.IMAP, logger),
+			config:     config,
+			budget:     budget,
+			logger:     logger,
+		}
+		return source, func() {}, nil
+
+	case sourceSimulate:
+		source := relish.NewSimulatedSource()
+		return source, func() {}, nil
+	}
+
+	// Get credentials
+	credentials, err := loadCredentials(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Bring up whatever the browser needs to reach the site before starting it
+	if config.PreLoginCommand != "" {
+		logger.Debug("running pre-login command")
+		if err := runPreLoginCommand(ctx, config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Create notifier
+	notifier := relish.NewNotifier(&config.Config, credentials, logger)
+	// Every page load counts against the budget, including retries and logging in again
+	notifier.BeforeLoad = func(ctx context.Context) error {
+		return budget.wait(ctx, logger)
+	}
+
+	// Someone is watching a headful browser, so they can type in a two-factor code
+	if !config.Headless {
+		notifier.PromptOTP = promptOTP
+	}
+
+	if config.KeepOpen && config.Headless {
+		logger.Warn("--keep-open has no effect in headless mode")
+	}
+	cleanup := func() {
+		if config.KeepOpen && !config.Headless {
+			waitForUser(ctx)
+		}
+		notifier.Close()
+	}
+
+	// Initialize browser
+	if err := notifier.InitializeBrowser(); err != nil {
+		notifier.Close()
+		return nil, nil, err
+	}
+
+	source := &browserSource{
+		Notifier:    notifier,
+		credentials: credentials,
+		state:       state,
+		config:      config,
+		logger:      logger,
+		started:     time.Now(),
+		markup:      &markupWatch{state: state, path: config.StateFile, update: config.MarkupBaseline, logger: logger},
+	}
+
+	// Login
+	if err := login(ctx, notifier, state, config, logger); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to login: %w", err)
+	}
+
+	return source, cleanup, nil
+}
+
+// checkHandlers are told the result of every check that monitor makes
+type checkHandlers struct {
+	// onStatus, if set, is called with the result of every successful check. unconfirmed
+	// is set for an arrival that --confirm-arrived checks haven't agreed on yet, and
+	// unknowns counts the checks in a row, up to this one, that found an unknown status.
+	onStatus func(info relish.OrderInfo, unconfirmed bool, unknowns int)
+	// onError, if set, is called whenever a check fails, unless the run is being stopped
+	onError func(err error)
+}
+
+// report passes the result of a check to the handlers
+func (h checkHandlers) report(info relish.OrderInfo, err error, unconfirmed bool, unknowns int) {
+	switch {
+	case err != nil && h.onError != nil:
+		h.onError(err)
+	case err == nil && h.onStatus != nil:
+		h.onStatus(info, unconfirmed, unknowns)
+	}
+}
+
+// monitorOptions holds what monitor needs besides the source. Only config is required;
+// without the rest, nothing is written, recorded, or logged, and nothing interrupts the
+// wait between checks.
+type monitorOptions struct {
+	config *Config
+	// stdout receives the results that --once, --until-arrived, and --stream-json write
+	stdout io.Writer
+	// metrics records every check
+	metrics Metrics
+	// handlers are told about every check
+	handlers checkHandlers
+	// reload asks the source to reload its credentials between checks
+	reload <-chan os.Signal
+	// checkNow cuts the wait between checks short
+	checkNow <-chan struct{}
+	logger   *slog.Logger
+}
+
+// monitor checks the order status until it arrives or is cancelled, or the context is
+// cancelled. With --continue-after-arrival, it carries on after that, for later orders.
+// With --once, it returns after the first check. Otherwise, no checks are made during
+// --quiet-hours.
+func monitor(ctx context.Context, source relish.StatusSource, opts monitorOptions) error {
+	config, stdout, metrics, handlers, logger := opts.config, opts.stdout, opts.metrics, opts.handlers, opts.logger
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if metrics == nil {
+		metrics = noMetrics{}
+	}
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	// relogins counts attempts to recover an expired session since the last successful check
+	relogins := 0
+	// checks counts every check, for --max-checks
+	checks := 0
+	// restarts counts browser restarts after a crash over the whole run, so a browser that
+	// keeps crashing can't keep the loop going forever
+	restarts := 0
+	// arrivals confirms an arrival over --confirm-arrived checks. The handlers are told
+	// whether it has, to hold back notifications until then.
+	arrivals := &arrivalTracker{needed: config.ConfirmArrived}
+	// unknowns counts checks in a row that found an unknown status, for --on-unknown. The
+	// handlers are told the count, to warn or notify about it.
+	unknowns := &failureTracker{threshold: config.UnknownThreshold}
+	// last is the result of the most recent check, which --until-arrived writes if it gives up
+	var last checkResult
+	// refresh is set once the wait between checks is over, to reload the page before the next
+	refresh := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		// A single check was asked for explicitly, so it isn't held back
+		if until, ok := config.quietUntil(time.Now()); ok && !config.Once {
+			logger.Info("entering quiet hours, pausing checks", "quiet_hours", config.quietHours.String(), "until", until.Format(time.TimeOnly))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(until)):
+			}
+			logger.Info("leaving quiet hours, resuming checks")
+		}
+
+		if config.MaxChecks > 0 && checks >= config.MaxChecks {
+			logger.Info("order has not arrived after the maximum number of checks", "max_checks", config.MaxChecks)
+			if config.UntilArrived {
+				if err := writeResult(stdout, config.Output, last); err != nil {
+					logger.Error("failed to write result", "error", err)
+				}
+			}
+			return exitCodeError{code: exitMaxChecks}
+		}
+		checks++
+
+		if r, ok := source.(refresher); ok && refresh {
+			if err := r.Refresh(ctx); err != nil {
+				logger.Error("failed to refresh page", "error", err)
+			}
+		}
+		refresh = false
+
+		started := time.Now()
+		info, err := source.CheckStatus(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		metrics.Check(time.Since(started), err)
+		arrivals.observe(info.Status, err)
+		// unknownReached is set for the check that brings the unknown statuses in a row to
+		// --unknown-threshold
+		unknownReached := false
+		if err == nil && info.Status == relish.OrderStatusUnknown {
+			unknownReached = unknowns.failed()
+		} else if err == nil {
+			unknowns.succeeded()
+		}
+		handlers.report(info, err, arrivals.unconfirmed(info.Status), unknowns.failures)
+		last = newCheckResult(info, "", err)
+		if config.StreamJSON {
+			if err := streamResult(stdout, last, started.In(config.zone())); err != nil {
+				logger.Error("failed to write result", "error", err)
+			}
+		}
+
+		if r, ok := source.(browserRestarter); ok && errors.Is(err, relish.ErrBrowserDisconnected) {
+			if restarts >= config.MaxBrowserRestarts {
+				return fmt.Errorf("browser stopped responding after %d restarts: %w", restarts, err)
+			}
+			restarts++
+
+			logger.Warn("browser stopped responding, restarting it", "attempt", restarts, "max_browser_restarts", config.MaxBrowserRestarts)
+			if err := r.RestartBrowser(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if errors.Is(err, relish.ErrInvalidCredentials) {
+					return invalidCredentialsError(config.Profile, err)
+				}
+				logger.Error("failed to restart browser", "error", err)
+			} else {
+				// Check again right away with the new browser
+				continue
+			}
+		}
+
+		if r, ok := source.(reloginer); ok && errors.Is(err, relish.ErrSessionExpired) {
+			if relogins >= config.MaxRelogins {
+				return fmt.Errorf("session expired and %d attempts to log in again failed", relogins)
+			}
+			relogins++
+
+			logger.Warn("session expired, logging in again", "attempt", relogins, "max_relogins", config.MaxRelogins)
+			if err := r.Relogin(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				// Retrying a password that is known to be wrong risks locking the account
+				if errors.Is(err, relish.ErrInvalidCredentials) {
+					return invalidCredentialsError(config.Profile, err)
+				}
+				logger.Error("failed to log in again", "error", err)
+			} else {
+				// Check again right away now that we're back on the schedule page
+				continue
+			}
+		} else if err == nil {
+			relogins = 0
+		}
+
+		if err != nil && !isTransient(err) {
+			if errors.Is(err, relish.ErrInvalidCredentials) {
+				return invalidCredentialsError(config.Profile, err)
+			}
+			return fmt.Errorf("failed to check order status: %w", err)
+		}
+
+		if unknownReached && config.OnUnknown == onUnknownFail {
+			return exitCodeError{
+				code: exitUnknownStatus,
+				err:  fmt.Errorf("the last %d checks found an unknown order status", unknowns.failures),
+			}
+		}
+
+		if err == nil && arrivals.unconfirmed(info.Status) {
+			logger.Info("order shows as arrived, checking again to confirm", "seen", arrivals.seen, "confirm_arrived", config.ConfirmArrived)
+		} else if err == nil && info.Status.IsFinal() && config.ContinueAfterArrival {
+			logger.Debug("order is done, checking for later orders", "status", info.Status)
+		} else if err == nil && info.Status.IsFinal() {
+			if info.Status == relish.OrderStatusCancelled {
+				return exitCodeError{code: 2}
+			}
+			return nil
+		}
+
+		if config.Once {
+			if err := writeResult(stdout, config.Output, last); err != nil {
+				logger.Error("failed to write result", "error", err)
+			}
+			return exitCodeError{code: 1}
+		}
+
+		// Don't wait out the interval when there will be no further check
+		if config.MaxChecks > 0 && checks >= config.MaxChecks {
+			continue
+		}
+
+		now := time.Now()
+		interval := config.intervalAt(now)
+		logger.Info("Checking again", "interval", interval, "next_check", now.Add(interval).In(config.zone()).Format(time.TimeOnly))
+		logger.Debug("chose the time until the next check", config.intervalAttrs(now)...)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-opts.reload:
+			logger.Info("reloading")
+			if r, ok := source.(reloader); ok {
+				if err := r.Reload(ctx); err != nil {
+					if errors.Is(err, relish.ErrInvalidCredentials) {
+						return invalidCredentialsError(config.Profile, err)
+					}
+					logger.Error("failed to reload", "error", err)
+				}
+			}
+			// Check right away so that the effect of the reload is visible. The page is
+			// reloaded first, since unchanged credentials leave the old page in place.
+			refresh = true
+			continue
+		case <-opts.checkNow:
+			logger.Info("checking now on request")
+		case <-time.After(interval):
+		}
+
+		refresh = true
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// State holds information that is persisted between runs
+type State struct {
+	LastLoginAttempt time.Time `json:"last_login_attempt,omitzero"`
+	// Notified records when each status of each order was notified, by notificationKey
+	Notified map[string]time.Time `json:"notified,omitempty"`
+	// MarkupBaseline is the markup of a schedule card known to work with the selectors
+	MarkupBaseline *relish.Markup `json:"markup_baseline,omitempty"`
+}
+
+// defaultStatePath returns the default location of the state file, or an empty string if it cannot be determined
+func defaultStatePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "relish-notifier", "state.json")
+}
+
+// loadState reads the state file at path. A missing file or empty path yields an empty state.
+func loadState(path string) (*State, error) {
+	state := &State{}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// save writes the state to path, replacing any existing file. An empty path disables persistence.
+func (s *State) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	// Write to a temporary file first so a crash can't leave a truncated state file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+// loginDelay returns how long to wait before another login attempt is permitted
+func (s *State) loginDelay(interval time.Duration, now time.Time) time.Duration {
+	if s.LastLoginAttempt.IsZero() {
+		return 0
+	}
+
+	delay := s.LastLoginAttempt.Add(interval).Sub(now)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
@@ -0,0 +1,62 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"relish-notifier/relish"
+)
+
+// writeStatuses writes the known order statuses to w as a table or JSON
+func writeStatuses(w io.Writer, statuses []relish.StatusDefinition, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(statuses)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTEXT") //nolint:errcheck
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "%s\t%q\n", status.Name, status.Status) //nolint:errcheck
+	}
+	return tw.Flush()
+}
+
+// newListStatusesCommand creates the list-statuses subcommand
+func newListStatusesCommand() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "list-statuses",
+		Short: "List the order statuses recognized on the Relish website",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return writeStatuses(cmd.OutOrStdout(), relish.KnownStatuses(), asJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output statuses as JSON")
+
+	return cmd
+}
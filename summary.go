@@ -0,0 +1,116 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// runSummary collects what happened during a run, for the summary written when it ends
+type runSummary struct {
+	started  time.Time
+	checks   int
+	failures int
+	// progression is each change of status seen, as it would be recorded in the history file
+	progression []historyEntry
+}
+
+// newRunSummary starts a summary of a run that starts at now
+func newRunSummary(now time.Time) *runSummary {
+	return &runSummary{started: now}
+}
+
+// checked records the result of a check made at now
+func (s *runSummary) checked(info relish.OrderInfo, err error, now time.Time) {
+	s.checks++
+	if err != nil {
+		s.failures++
+		return
+	}
+
+	if n := len(s.progression); n == 0 || s.progression[n-1].Status != info.Status {
+		s.progression = append(s.progression, newHistoryEntry(info, now))
+	}
+}
+
+// attrs returns the summary as log attributes for a run that ended at now for the given reason
+func (s *runSummary) attrs(reason string, now time.Time) []any {
+	steps := make([]string, len(s.progression))
+	for i, entry := range s.progression {
+		steps[i] = fmt.Sprintf("%s %s", entry.Time.Format(time.TimeOnly), entry.Status)
+	}
+
+	return []any{
+		"checks", s.checks,
+		"failed_checks", s.failures,
+		"duration", now.Sub(s.started).Round(time.Second),
+		"progression", strings.Join(steps, " -> "),
+		"exit_reason", reason,
+	}
+}
+
+// exitReason describes why the run ended with err, returned by monitor or by setting up
+// the source, in a run whose context is ctx
+func exitReason(ctx context.Context, err error) string {
+	var exitErr exitCodeError
+	switch {
+	case ctx.Err() != nil:
+		return "interrupted"
+	case err == nil:
+		return "order arrived"
+	case errors.As(err, &exitErr) && exitErr.err == nil:
+		switch exitErr.code {
+		case 1:
+			return "checked once"
+		case 2:
+			return "order cancelled"
+		case exitMaxChecks:
+			return "reached --max-checks"
+		}
+	}
+	return err.Error()
+}
+
+// writeSummary writes the summary of a run that has just ended, including one that ended
+// before the first check, to w in the same form as a log message. It isn't a warning, or
+// any other kind of log message, so it is written whatever the verbosity. profile, if set,
+// is the profile the run was for.
+func writeSummary(ctx context.Context, w io.Writer, profile string, summary *runSummary, err error) {
+	attrs := summary.attrs(exitReason(ctx, err), time.Now())
+	if profile != "" {
+		attrs = append([]any{"profile", profile}, attrs...)
+	}
+
+	handler := slog.NewTextHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	slog.New(handler).Info("run summary", attrs...)
+}
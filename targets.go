@@ -0,0 +1,435 @@
+/*
+ *   relish-notifier -- get notified when your food arrives
+ *   Copyright (C) 2025 Lars Kellogg-Stedman
+ *
+ *   This program is free software: you can redistribute it and/or modify
+ *   it under the terms of the GNU General Public License as published by
+ *   the Free Software Foundation, either version 3 of the License, or
+ *   (at your option) any later version.
+ *
+ *   This program is distributed in the hope that it will be useful,
+ *   but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *   GNU General Public License for more details.
+ *
+ *   You should have received a copy of the GNU General Public License
+ *   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"relish-notifier/relish"
+)
+
+// slackTimeout bounds each request to a Slack webhook
+const slackTimeout = 10 * time.Second
+
+// commandOutputLog is the --command-log-output value that logs the output instead of
+// writing it to a file
+const commandOutputLog = "log"
+
+// commandOutputLimit is the most output of a --command run that --command-log-output keeps
+const commandOutputLimit = 64 * 1024
+
+// targetDefinition describes a kind of notification target in the registry. The target's
+// Name must be the name it is registered under.
+type targetDefinition struct {
+	// name selects the target with --notify, and names its --NAME-on filter
+	name string
+	// enabled reports whether the target's own options turn it on, when --notify isn't used
+	enabled func(config *Config) bool
+	// filter returns the target's --NAME-on option, if it has one
+	filter func(config *Config) string
+	// create builds the target from its options, or explains which are missing
+	create func(config *Config, logger *slog.Logger) (NotificationTarget, error)
+	// quiet targets only get the announcements, such as reminders and failing checks, that
+	// their --NAME-on names
+	quiet bool
+}
+
+// targetRegistry lists every kind of notification target, in the order notifications are
+// sent to them
+var targetRegistry = []targetDefinition{
+	{
+		name:    "command",
+		enabled: func(config *Config) bool { return config.Command != "" },
+		filter:  func(config *Config) string { return config.CommandOn },
+		create:  newCommandTarget,
+		quiet:   true,
+	},
+	{
+		name:    "exec",
+		enabled: func(config *Config) bool { return config.Exec != "" || len(config.ExecArgs) > 0 },
+		filter:  func(config *Config) string { return config.ExecOn },
+		create:  newExecTarget,
+		quiet:   true,
+	},
+	{
+		name:    "desktop",
+		enabled: func(config *Config) bool { return config.Desktop },
+		filter:  func(config *Config) string { return config.DesktopOn },
+		create: func(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+			return &desktopTarget{}, nil
+		},
+	},
+	{
+		name:    "slack",
+		enabled: func(config *Config) bool { return config.SlackWebhook != "" },
+		filter:  func(config *Config) string { return config.SlackOn },
+		create:  newSlackTarget,
+	},
+	{
+		name:    "email",
+		enabled: func(config *Config) bool { return config.EmailTo != "" },
+		filter:  func(config *Config) string { return config.EmailOn },
+		create: func(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+			if config.EmailTo == "" {
+				return nil, fmt.Errorf("email notifications require --email-to")
+			}
+			return newEmailTarget(config)
+		},
+	},
+	{
+		name:    "sms",
+		enabled: func(config *Config) bool { return config.SMSTo != "" },
+		filter:  func(config *Config) string { return config.SMSOn },
+		create: func(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+			if config.SMSTo == "" {
+				return nil, fmt.Errorf("sms notifications require --sms-to")
+			}
+			return newSMSTarget(config)
+		},
+	},
+}
+
+// registerTarget adds a kind of notification target to the registry, after the built in
+// ones. It panics if the name is already taken, since that is a programming error.
+func registerTarget(def targetDefinition) {
+	if _, ok := lookupTarget(def.name); ok {
+		panic(fmt.Sprintf("notification target %q is already registered", def.name))
+	}
+	targetRegistry = append(targetRegistry, def)
+}
+
+// lookupTarget returns the registered target called name
+func lookupTarget(name string) (targetDefinition, bool) {
+	for _, def := range targetRegistry {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return targetDefinition{}, false
+}
+
+// targetNames returns the names of the registered targets
+func targetNames() []string {
+	names := make([]string, 0, len(targetRegistry))
+	for _, def := range targetRegistry {
+		names = append(names, def.name)
+	}
+	return names
+}
+
+// newTargets builds the notification targets selected on the command line: those named
+// with --notify, or without it, every target that its own options turn on
+func newTargets(config *Config, logger *slog.Logger) ([]NotificationTarget, error) {
+	selected := map[string]bool{}
+	for _, name := range config.Notify {
+		name = strings.TrimSpace(name)
+		if _, ok := lookupTarget(name); !ok {
+			return nil, fmt.Errorf("unknown notification target %q (choose from %s)", name, strings.Join(targetNames(), ", "))
+		}
+		if selected[name] {
+			return nil, fmt.Errorf("--notify names %q more than once", name)
+		}
+		selected[name] = true
+	}
+
+	var targets []NotificationTarget
+	for _, def := range targetRegistry {
+		use := def.enabled(config)
+		if len(selected) > 0 {
+			use = selected[def.name]
+		}
+		if !use {
+			continue
+		}
+		target, err := def.create(config, logger)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// newCommandTarget creates a command target from --command and the options that go with it
+func newCommandTarget(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("command notifications require --command")
+	}
+	return &commandTarget{
+		command:   config.Command,
+		timeout:   config.CommandTimeout,
+		stdinJSON: config.CommandStdinJSON,
+		logOutput: config.CommandLogOutput,
+		logger:    logger,
+	}, nil
+}
+
+// newExecTarget creates an exec target from --exec and --exec-arg
+func newExecTarget(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+	if config.Exec == "" {
+		if len(config.ExecArgs) > 0 {
+			return nil, fmt.Errorf("--exec-arg requires --exec")
+		}
+		return nil, fmt.Errorf("exec notifications require --exec")
+	}
+	args, err := parseExecArgs(config.ExecArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &execTarget{program: config.Exec, args: args, timeout: config.CommandTimeout}, nil
+}
+
+// newSlackTarget creates a Slack target from --slack-webhook
+func newSlackTarget(config *Config, logger *slog.Logger) (NotificationTarget, error) {
+	if config.SlackWebhook == "" {
+		return nil, fmt.Errorf("slack notifications require --slack-webhook")
+	}
+	return &slackTarget{url: config.SlackWebhook, client: &http.Client{Timeout: slackTimeout}}, nil
+}
+
+// commandContext limits a command to timeout. A timeout of zero places no limit on it.
+func commandContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// commandTarget runs a shell command
+type commandTarget struct {
+	command string
+	timeout time.Duration
+	// stdinJSON sends a JSON description of the notification to the command's stdin
+	stdinJSON bool
+	// logOutput is where the command's output goes: commandOutputLog to log it, or the
+	// path of a file to append it to. If empty, the output is discarded.
+	logOutput string
+	logger    *slog.Logger
+}
+
+func (t *commandTarget) Name() string          { return "command" }
+func (t *commandTarget) Format() messageFormat { return formatPlain }
+
+func (t *commandTarget) Send(ctx context.Context, n Notification) error {
+	ctx, cancel := commandContext(ctx, t.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.command)
+	cmd.Env = append(os.Environ(), messageEnv(n.Data, n.Message)...)
+	if t.stdinJSON {
+		payload, err := messageJSON(n.Data, n.Message)
+		if err != nil {
+			return err
+		}
+		cmd.Stdin = bytes.NewReader(payload)
+	}
+	if t.logOutput == "" {
+		return cmd.Run()
+	}
+
+	output := &limitedBuffer{limit: commandOutputLimit}
+	cmd.Stdout, cmd.Stderr = output, output
+	// Don't wait on the output of anything the shell started once it has been stopped
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	// The output is most useful when the command failed, so it is kept either way
+	t.saveOutput(output, n, err)
+	return err
+}
+
+// saveOutput logs the output of a run of the command, or appends it to the file chosen
+// with --command-log-output. Failing to save it doesn't fail the notification.
+func (t *commandTarget) saveOutput(output *limitedBuffer, n Notification, runErr error) {
+	if t.logOutput == commandOutputLog {
+		t.logger.Info("command output", "status", n.Data.Status, "output", output.String(), "error", runErr)
+		return
+	}
+
+	header := fmt.Sprintf("--- %s, order status %s", n.Data.Time.Format(time.RFC3339), n.Data.Status)
+	if runErr != nil {
+		header += ", failed: " + runErr.Error()
+	}
+	text := header + "\n" + output.String()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	file, err := os.OpenFile(t.logOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err == nil {
+		_, err = file.WriteString(text)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		t.logger.Warn("failed to save command output", "path", t.logOutput, "error", err)
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and counts the rest
+type limitedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	kept := min(max(b.limit-b.buf.Len(), 0), len(p))
+	b.buf.Write(p[:kept])
+	b.dropped += len(p) - kept
+	return len(p), nil
+}
+
+// String returns what was kept, with a note of how much was left out
+func (b *limitedBuffer) String() string {
+	if b.dropped == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s\n[output truncated: %d more bytes]", b.buf.String(), b.dropped)
+}
+
+// execTarget runs a program directly, without a shell
+type execTarget struct {
+	program string
+	args    []*template.Template
+	timeout time.Duration
+}
+
+func (t *execTarget) Name() string          { return "exec" }
+func (t *execTarget) Format() messageFormat { return formatPlain }
+
+func (t *execTarget) Send(ctx context.Context, n Notification) error {
+	args, err := renderExecArgs(t.args, n.Data, n.Message)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(ctx, t.timeout)
+	defer cancel()
+
+	// Run the program directly so that no shell interprets the order details
+	cmd := exec.CommandContext(ctx, t.program, args...)
+	cmd.Env = append(os.Environ(), messageEnv(n.Data, n.Message)...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", t.program, err)
+	}
+	return nil
+}
+
+// runErrorCommand runs the --notify-command-on-error command for a failed check, passing
+// the error in RELISH_ERROR
+func runErrorCommand(ctx context.Context, config *Config, checkErr error) error {
+	ctx, cancel := commandContext(ctx, config.CommandTimeout)
+	defer cancel()
+
+	data := newMessageData(relish.OrderInfo{Status: relish.OrderStatusUnknown}, config.now())
+	data.Event = eventError
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", config.NotifyCommandOnError)
+	cmd.Env = append(os.Environ(), messageEnv(data, "")...)
+	cmd.Env = append(cmd.Env, "RELISH_ERROR="+checkErr.Error())
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run error command: %w", err)
+	}
+	return nil
+}
+
+// runPreLoginCommand runs the --pre-login-command command, which must succeed before
+// relish-notifier logs in. Its output is included in the error if it fails.
+func runPreLoginCommand(ctx context.Context, config *Config) error {
+	ctx, cancel := commandContext(ctx, config.PreLoginTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", config.PreLoginCommand)
+	// Don't wait on the output of anything the shell started once it has been stopped
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", config.PreLoginTimeout)
+		}
+		if detail := strings.TrimSpace(string(output)); detail != "" {
+			return fmt.Errorf("pre-login command failed: %w: %s", err, detail)
+		}
+		return fmt.Errorf("pre-login command failed: %w", err)
+	}
+	return nil
+}
+
+// desktopTarget shows a desktop notification using notify-send
+type desktopTarget struct{}
+
+func (t *desktopTarget) Name() string          { return "desktop" }
+func (t *desktopTarget) Format() messageFormat { return formatPlain }
+
+func (t *desktopTarget) Send(ctx context.Context, n Notification) error {
+	args := []string{"--app-name=relish-notifier"}
+	// Reminders are only reassurance, so they shouldn't demand attention
+	if n.Data.Event == eventWaiting {
+		args = append(args, "--urgency=low")
+	}
+	cmd := exec.CommandContext(ctx, "notify-send", append(args, "Relish", n.Text)...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run notify-send: %w", err)
+	}
+	return nil
+}
+
+// slackTarget posts to a Slack incoming webhook
+type slackTarget struct {
+	url    string
+	client *http.Client
+}
+
+func (t *slackTarget) Name() string          { return "slack" }
+func (t *slackTarget) Format() messageFormat { return formatMarkdown }
+
+func (t *slackTarget) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(map[string]string{"text": n.Text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to slack: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to post to slack: %s", resp.Status)
+	}
+	return nil
+}